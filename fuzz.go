@@ -0,0 +1,147 @@
+// Copyright 2021 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+import (
+	"fmt"
+)
+
+// FuzzParseMsg is a fuzzing entry point (go-fuzz compatible).
+// It parses data as a HTTP message, both in one go and piece-wise (adding
+// one byte at a time) and panics if the results are inconsistent or some
+// parsing invariant is broken (see checkMsgInvariants()).
+// It returns 1 if data starts with a valid message and 0 otherwise.
+func FuzzParseMsg(data []byte) int {
+	var msg PMsg
+	var hdrs [20]Hdr
+
+	// one-shot
+	msg.Init(nil, hdrs[:])
+	o, err := ParseMsg(data, 0, &msg, 0)
+	if e := checkMsgInvariants(data, 0, o, err, &msg); e != nil {
+		panic(fmt.Sprintf("ParseMsg(%q, 0, .., 0): %s", data, e))
+	}
+	oneOffs, oneErr := o, err
+
+	// piece-wise, one byte at a time
+	msg.Init(nil, hdrs[:])
+	o = 0
+	err = ErrHdrMoreBytes
+	for end := 0; end <= len(data) && err == ErrHdrMoreBytes; end++ {
+		o, err = ParseMsg(data[:end], o, &msg, 0)
+		if e := checkMsgInvariants(data[:end], 0, o, err, &msg); e != nil {
+			panic(fmt.Sprintf("ParseMsg(%q, 0, .., 0) pieces: %s",
+				data[:end], e))
+		}
+	}
+	if (err == 0) != (oneErr == 0) || (err == 0 && o != oneOffs) {
+		panic(fmt.Sprintf("ParseMsg(%q, 0, .., 0): one-shot [%d, %d(%q)]"+
+			" != pieces [%d, %d(%q)]", data, oneOffs, oneErr, oneErr,
+			o, err, err))
+	}
+
+	// no more data (EOF)
+	msg.Init(nil, hdrs[:])
+	o, err = ParseMsg(data, 0, &msg, MsgNoMoreDataF)
+	if e := checkMsgInvariants(data, 0, o, err, &msg); e != nil {
+		panic(fmt.Sprintf("ParseMsg(%q, 0, .., MsgNoMoreDataF): %s", data, e))
+	}
+	if oneErr == 0 {
+		return 1
+	}
+	return 0
+}
+
+// checkMsgInvariants checks the consistency of a ParseMsg() result.
+// buf, offs are the ParseMsg() parameters and o and err its return values.
+// It returns nil if everything is ok or an error describing the first
+// broken invariant.
+func checkMsgInvariants(buf []byte, offs, o int, err ErrorHdr,
+	msg *PMsg) error {
+	if o < 0 || o > len(buf) {
+		return fmt.Errorf("offset %d out of range [0, %d]", o, len(buf))
+	}
+	switch err {
+	case 0:
+		if o <= offs {
+			return fmt.Errorf("success with offset %d <= start %d", o, offs)
+		}
+		if !msg.ParsedHdrs() && msg.state != MsgHeaders {
+			// (MsgHeaders possible only with MsgStopAfterFLineF)
+			return fmt.Errorf("success, but headers not parsed (state %d)",
+				msg.state)
+		}
+		if len(msg.RawMsg) != o-offs {
+			return fmt.Errorf("RawMsg length %d != %d", len(msg.RawMsg),
+				o-offs)
+		}
+	case ErrHdrMoreBytes, ErrHdrTrunc:
+		if msg.Err() {
+			return fmt.Errorf("error state after %q", err)
+		}
+		return nil // partial values, nothing more to check
+	default:
+		if !msg.Err() {
+			return fmt.Errorf("%q, but state %d", err, msg.state)
+		}
+		return nil
+	}
+	// all the parsed fields must be inside the message
+	chk := func(name string, f PField) error {
+		if f.Empty() {
+			return nil
+		}
+		if int(f.Offs) < offs || f.EndOffs() > o {
+			return fmt.Errorf("%s [%d:%d] outside message [%d:%d]",
+				name, f.Offs, f.EndOffs(), offs, o)
+		}
+		return nil
+	}
+	fl := &msg.FL
+	for _, f := range [...]struct {
+		n string
+		v PField
+	}{
+		{"FL.Method", fl.Method}, {"FL.URI", fl.URI},
+		{"FL.Version", fl.Version}, {"FL.StatusCode", fl.StatusCode},
+		{"FL.Reason", fl.Reason}, {"Body", msg.Body},
+	} {
+		if e := chk(f.n, f.v); e != nil {
+			return e
+		}
+	}
+	if msg.HL.N < 0 {
+		return fmt.Errorf("negative headers number %d", msg.HL.N)
+	}
+	n := msg.HL.N
+	if n > len(msg.HL.Hdrs) {
+		n = len(msg.HL.Hdrs)
+	}
+	for i := 0; i < n; i++ {
+		h := &msg.HL.Hdrs[i]
+		if h.Name.Empty() {
+			return fmt.Errorf("header %d: empty name", i)
+		}
+		if e := chk(fmt.Sprintf("header %d name", i), h.Name); e != nil {
+			return e
+		}
+		if e := chk(fmt.Sprintf("header %d value", i), h.Val); e != nil {
+			return e
+		}
+		if e := chk(fmt.Sprintf("header %d raw", i), h.Raw); e != nil {
+			return e
+		}
+		if h.Type == HdrNone || h.Type > HdrOther {
+			return fmt.Errorf("header %d: invalid type %d", i, h.Type)
+		}
+		if h.Type != HdrOther && !msg.HL.PFlags.Test(h.Type) {
+			return fmt.Errorf("header %d: type %s not in flags 0x%x",
+				i, h.Type, msg.HL.PFlags)
+		}
+	}
+	return nil
+}
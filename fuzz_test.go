@@ -0,0 +1,37 @@
+// Copyright 2021 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+//go:build go1.18
+// +build go1.18
+
+package httpsp_test
+
+import (
+	"testing"
+
+	"github.com/intuitivelabs/httpsp"
+)
+
+// FuzzParseMsg runs httpsp.FuzzParseMsg() under the go fuzzing engine
+// (go test -fuzz FuzzParseMsg).
+func FuzzParseMsg(f *testing.F) {
+	seeds := [...]string{
+		"GET / HTTP/1.1\r\nHost: foo.bar\r\n\r\n",
+		"POST /x HTTP/1.1\r\nContent-Length: 3\r\n\r\nabc",
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"3\r\nabc\r\n0\r\n\r\n",
+		"HTTP/1.0 404 Not Found\r\nContent-Type: text/html;" +
+			" charset=utf-8\r\nVary: accept,\r\n user-agent\r\n\r\n",
+		"HTTP/1.1 401 Unauthorized\r\nContent-Length: 0\r\n" +
+			"Proxy-Authenticate: Basic realm=\"x\", Digest nonce=1\r\n\r\n",
+	}
+	for _, s := range seeds {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		httpsp.FuzzParseMsg(data) // panics on error
+	})
+}
@@ -0,0 +1,378 @@
+// Copyright 2021 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+import (
+	"github.com/intuitivelabs/bytescase"
+)
+
+// AuthVal contains a parsed authentication challenge or credentials
+// (rfc7235 2.1):  auth-scheme [ 1*SP ( token68 / #auth-param ) ].
+type AuthVal struct {
+	V        PField      // complete challenge or credentials
+	Scheme   PField      // auth-scheme (e.g. "Basic", "Digest")
+	Token68  PField      // token68 value (empty if auth-params are used)
+	AllPrms  PField      // complete auth-params string
+	ParamsNo int         // number of auth-params
+	Params   []PTokParam // slice to be filled with parsed auth-params
+	Realm    PField      // "realm" parameter value, without quotes
+}
+
+// Reset re-initializes the parsed value (keeping the Params slice).
+func (v *AuthVal) Reset() {
+	params := v.Params
+	*v = AuthVal{}
+	v.Params = params
+}
+
+// GetParam returns the value of the first auth-param with the given name
+// (case insensitive), without quotes and true, or an empty PField and false
+// if not found.
+// Only the parameters that fit in Params are searched.
+func (v *AuthVal) GetParam(buf []byte, name []byte) (PField, bool) {
+	return getTokParam(buf, v.Params, v.ParamsNo, name)
+}
+
+// IsScheme returns true if the auth-scheme matches s (case insensitive).
+func (v *AuthVal) IsScheme(buf []byte, s []byte) bool {
+	return int(v.Scheme.Len) == len(s) &&
+		bytescase.CmpEq(v.Scheme.Get(buf), s)
+}
+
+// setParam adds a new parsed auth-param.
+func (v *AuthVal) setParam(buf []byte, p *PTokParam) {
+	if v.ParamsNo < len(v.Params) {
+		v.Params[v.ParamsNo] = *p
+	}
+	v.ParamsNo++
+	if v.AllPrms.Empty() {
+		v.AllPrms = p.All
+	} else {
+		v.AllPrms.Extend(p.All.EndOffs())
+	}
+	v.V.Extend(p.All.EndOffs())
+	n := p.Name.Get(buf)
+	if len(n) == 5 && bytescase.CmpEq(n, []byte("realm")) {
+		v.Realm, _ = unquotePField(buf, p.Val)
+	}
+}
+
+// getTokParam returns the value of the first parameter in params (with
+// paramsNo parsed parameters) with the given name (case insensitive),
+// without quotes and true, or an empty PField and false if not found.
+func getTokParam(buf []byte, params []PTokParam, paramsNo int,
+	name []byte) (PField, bool) {
+	n := paramsNo
+	if n > len(params) {
+		n = len(params)
+	}
+	for i := 0; i < n; i++ {
+		if int(params[i].Name.Len) == len(name) &&
+			bytescase.CmpEq(params[i].Name.Get(buf), name) {
+			val, _ := unquotePField(buf, params[i].Val)
+			return val, true
+		}
+	}
+	return PField{}, false
+}
+
+// PAuthChallenges contains the parsed challenges from one or more
+// WWW-Authenticate or Proxy-Authenticate headers (all the challenges in
+// the message that fit in the parsed value array).
+type PAuthChallenges struct {
+	Vals []AuthVal // parsed challenges
+	N    int       // no of  _values_ found, can be >len(Vals)
+	HNo  int       // no of different headers found
+	// parsed hdr content during the last ParseAll... call
+	// (contains a trimmed value or several values, overwritten by each
+	//  ParseAll.. call; it can also be empty, e.g. on ErrHdrMoreByte)
+	LastParsed PField
+	tmp        AuthVal // temporary value (used if Vals is full)
+	first      AuthVal // even if Vals is nil, we remember the first val.
+	hValState
+}
+
+// VNo returns the number of parsed challenges.
+func (a *PAuthChallenges) VNo() int {
+	if a.N > len(a.Vals) {
+		return len(a.Vals)
+	}
+	return a.N
+}
+
+// GetChallenge returns the requested parsed challenge or nil.
+func (a *PAuthChallenges) GetChallenge(n int) *AuthVal {
+	if a.VNo() > n {
+		return &a.Vals[n]
+	}
+	if a.Empty() {
+		return nil
+	}
+	if n == 0 {
+		return &a.first
+	}
+	return nil
+}
+
+// More returns true if there are more values that did not fit in Vals.
+func (a *PAuthChallenges) More() bool {
+	return a.N > len(a.Vals)
+}
+
+// Reset re-initializes the parsed values.
+func (a *PAuthChallenges) Reset() {
+	for i := 0; i < a.VNo(); i++ {
+		a.Vals[i].Reset()
+	}
+	v := a.Vals
+	*a = PAuthChallenges{}
+	a.Vals = v
+}
+
+// Init initializes the parsed challenges buf from an array.
+func (a *PAuthChallenges) Init(valbuf []AuthVal) {
+	a.Vals = valbuf
+}
+
+// Empty returns true if no challenges have been parsed.
+func (a *PAuthChallenges) Empty() bool {
+	return a.N == 0
+}
+
+// Parsed returns true if there are some parsed challenges.
+func (a *PAuthChallenges) Parsed() bool {
+	return a.N > 0
+}
+
+// PAuthCredentials contains parsed Authorization or Proxy-Authorization
+// credentials.
+type PAuthCredentials struct {
+	AuthVal
+	hValState
+	parsed bool
+}
+
+// Reset re-initializes the parsed value and internal parsing state
+// (keeping the Params slice).
+func (a *PAuthCredentials) Reset() {
+	a.AuthVal.Reset()
+	a.hValState = hValState{}
+	a.parsed = false
+}
+
+// Empty returns true if nothing was parsed yet.
+func (a *PAuthCredentials) Empty() bool {
+	return a.state == hvInit && !a.parsed
+}
+
+// Parsed returns true if the value is fully parsed.
+func (a *PAuthCredentials) Parsed() bool {
+	return a.parsed
+}
+
+// ParseAllAuthChallengeValues tries to parse all the challenges in a
+// WWW-Authenticate or Proxy-Authenticate header situated at offs in buf and
+// adds them to the passed PAuthChallenges values.
+// The return values are: a new offset after the parsed value (that can be
+// used to continue parsing), the number of challenges parsed and an error.
+// It can return ErrHdrMoreBytes if more data is needed (the value is not
+// fully contained in buf).
+// The auth-params of each challenge are saved in the corresponding
+// AuthVal.Params (if pre-allocated).
+func ParseAllAuthChallengeValues(buf []byte, offs int,
+	a *PAuthChallenges) (int, int, ErrorHdr) {
+	vNo := 0             // number of values parsed during the current call
+	a.LastParsed.Reset() // clear LastParsed on each call
+	next, end, err := findHdrValEnd(buf, offs, &a.hValState)
+	if err != 0 {
+		return next, 0, err
+	}
+	a.LastParsed.Set(a.vstart, end)
+	pbuf := buf[:end]
+	o := a.vstart
+	var pv *AuthVal
+	for o < len(pbuf) {
+		if a.N < len(a.Vals) {
+			pv = &a.Vals[a.N]
+		} else {
+			pv = &a.tmp
+		}
+		pv.Reset()
+		o, err = parseAuthVal(pbuf, o, pv)
+		if err != 0 {
+			pv.Reset()
+			return o, vNo, err
+		}
+		vNo++
+		a.N++
+		if a.N == 1 && len(a.Vals) == 0 {
+			a.first = *pv
+		}
+	}
+	return next, vNo, 0
+}
+
+// ParseAuthCredentialsVal parses an Authorization or Proxy-Authorization
+// header value, starting at offs in buf and filling a.
+// It returns a new offset pointing after the part that was parsed and
+// an error.
+// It can return ErrHdrMoreBytes if more data is needed (the value is not
+// fully contained in buf). In this case it should be called again
+// with the same a and the returned offset, after more bytes were added.
+// The auth-params are saved in a.Params (if pre-allocated).
+func ParseAuthCredentialsVal(buf []byte, offs int,
+	a *PAuthCredentials) (int, ErrorHdr) {
+	next, end, err := findHdrValEnd(buf, offs, &a.hValState)
+	if err != 0 {
+		return next, err
+	}
+	a.AuthVal.Reset()
+	o, err := parseAuthVal(buf[:end], a.vstart, &a.AuthVal)
+	if err != 0 {
+		a.AuthVal.Reset()
+		return o, err
+	}
+	if o != end {
+		// more then one value
+		a.AuthVal.Reset()
+		return o, ErrHdrBadChar
+	}
+	a.parsed = true
+	return next, 0
+}
+
+// skipAuthSep skips over whitespace (including CR and LF) and if commas
+// is true also over ','.
+func skipAuthSep(buf []byte, offs int, commas bool) int {
+	for ; offs < len(buf); offs++ {
+		switch buf[offs] {
+		case ' ', '\t', '\r', '\n':
+		case ',':
+			if !commas {
+				return offs
+			}
+		default:
+			return offs
+		}
+	}
+	return offs
+}
+
+// token68 characters: ALPHA / DIGIT / "-" / "." / "_" / "~" / "+" / "/"
+func token68Char(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+		(c >= '0' && c <= '9') || c == '-' || c == '.' || c == '_' ||
+		c == '~' || c == '+' || c == '/'
+}
+
+// parseAuthVal parses one challenge or credentials value starting at offs.
+// buf must end at the value end.
+// It returns the offset of the next value start (or len(buf)) and 0 on
+// success, or the offset of the offending character and an error.
+func parseAuthVal(buf []byte, offs int, v *AuthVal) (int, ErrorHdr) {
+	i := skipAuthSep(buf, offs, true)
+	s := i
+	for i < len(buf) && tcharAllowed(buf[i]) {
+		i++
+	}
+	if i == s {
+		return i, ErrHdrBadChar
+	}
+	v.Scheme.Set(s, i)
+	v.V = v.Scheme
+	if i == len(buf) {
+		return i, 0
+	}
+	if buf[i] == ',' {
+		return skipAuthSep(buf, i, true), 0
+	}
+	if buf[i] != ' ' && buf[i] != '\t' && buf[i] != '\r' && buf[i] != '\n' {
+		return i, ErrHdrBadChar
+	}
+	i = skipAuthSep(buf, i, false)
+	if i == len(buf) {
+		return i, 0
+	}
+	if buf[i] == ',' {
+		return skipAuthSep(buf, i, true), 0
+	}
+	// token68 or auth-params
+	s = i
+	for i < len(buf) && (tcharAllowed(buf[i]) || buf[i] == '/') {
+		i++
+	}
+	if i == s {
+		return i, ErrHdrBadChar
+	}
+	j := skipAuthSep(buf, i, false)
+	if j < len(buf) && buf[j] == '=' {
+		// token68 with padding or auth-param
+		k := j
+		for k < len(buf) && buf[k] == '=' {
+			k++
+		}
+		e := skipAuthSep(buf, k, false)
+		if j == i && (e == len(buf) || buf[e] == ',') {
+			for e := s; e < i; e++ {
+				if !token68Char(buf[e]) {
+					return e, ErrHdrBadChar
+				}
+			}
+			v.Token68.Set(s, k)
+			v.V.Extend(k)
+			return skipAuthSep(buf, k, true), 0
+		}
+	} else if j == len(buf) || buf[j] == ',' {
+		// token68 without padding
+		for e := s; e < i; e++ {
+			if !token68Char(buf[e]) {
+				return e, ErrHdrBadChar
+			}
+		}
+		v.Token68.Set(s, i)
+		v.V.Extend(i)
+		return skipAuthSep(buf, j, true), 0
+	} else {
+		return j, ErrHdrBadChar
+	}
+	// auth-params
+	i = s
+	var p PTokParam
+	for {
+		// check for token OWS "=" (else it's the start of a new value)
+		for i < len(buf) && tcharAllowed(buf[i]) {
+			i++
+		}
+		j = skipAuthSep(buf, i, false)
+		if i == s || j >= len(buf) || buf[j] != '=' {
+			if v.ParamsNo == 0 || i == s {
+				return i, ErrHdrBadChar
+			}
+			return s, 0 // new challenge starts at s
+		}
+		p.Reset()
+		n, err := ParseTokenParam(buf, s, &p, PTokCommaSepF|PTokInputEndF)
+		switch err {
+		case ErrHdrOk, ErrHdrEOH:
+			v.setParam(buf, &p)
+		case ErrHdrMoreValues:
+			// ';' used as separator
+			return n, ErrHdrBadChar
+		default:
+			return n, err
+		}
+		if err == ErrHdrEOH {
+			return len(buf), 0
+		}
+		// n points to the ',' separator
+		i = skipAuthSep(buf, n, true)
+		if i >= len(buf) {
+			return i, 0
+		}
+		s = i
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2021 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+import (
+	"github.com/intuitivelabs/bytescase"
+)
+
+// CDispT is the type for the Content-Disposition disposition type
+// converted to a numeric value.
+type CDispT uint8
+
+// Content-Disposition types (rfc6266 & rfc7578).
+const (
+	CDispNone CDispT = iota
+	CDispInline
+	CDispAttachment
+	CDispFormData
+	CDispOther // unknown/other
+)
+
+// pretty names for debugging
+var cdispTStr = [...]string{
+	CDispNone:       "none",
+	CDispInline:     "inline",
+	CDispAttachment: "attachment",
+	CDispFormData:   "form-data",
+	CDispOther:      "other",
+}
+
+// String implements the Stringer interface.
+func (t CDispT) String() string {
+	if int(t) >= len(cdispTStr) {
+		return "invalid"
+	}
+	return cdispTStr[t]
+}
+
+// CDispResolve will try to resolve the disposition type name to a numeric
+// CDispT value.
+func CDispResolve(n []byte) CDispT {
+	for t := CDispInline; t < CDispOther; t++ {
+		if len(n) == len(cdispTStr[t]) &&
+			bytescase.CmpEq(n, []byte(cdispTStr[t])) {
+			return t
+		}
+	}
+	return CDispOther
+}
+
+// PContentDisposition contains a parsed Content-Disposition header value.
+type PContentDisposition struct {
+	Val     PField // complete value (type and parameters)
+	TypeVal PField // disposition type as string
+	Type    CDispT // parsed disposition type
+	Name    PField // "name" parameter value (without quotes)
+	// Filename contains the "filename" parameter value, without quotes
+	// (but with possible quoted-pairs, see FilenameQuoted and
+	//  GetFilename()).
+	Filename       PField
+	FilenameQuoted bool // true if the "filename" value was a quoted string
+	// FilenameExt contains the complete "filename*" parameter value
+	// (rfc5987 charset'[language]'value-chars).
+	FilenameExt     PField
+	FilenameCharset PField // charset part of "filename*"
+	FilenameLang    PField // language part of "filename*" (can be empty)
+	FilenameEnc     PField // percent-encoded part of "filename*"
+	tok             PToken // internal token parsing state
+}
+
+// Reset re-initializes the parsed value and internal parsing state.
+func (cd *PContentDisposition) Reset() {
+	*cd = PContentDisposition{}
+}
+
+// Empty returns true if nothing was parsed yet.
+func (cd *PContentDisposition) Empty() bool {
+	return cd.tok.Empty()
+}
+
+// Parsed returns true if the value is fully parsed.
+func (cd *PContentDisposition) Parsed() bool {
+	return cd.Type != CDispNone
+}
+
+// GetFilename appends the decoded filename to dst and returns the
+// extended slice.
+// If a valid "filename*" parameter is present, its percent-decoded value
+// is used (without any charset conversion), otherwise the "filename" value
+// with the quoted-pairs resolved.
+// buf is the buffer the header was parsed from.
+func (cd *PContentDisposition) GetFilename(dst, buf []byte) []byte {
+	if !cd.FilenameCharset.Empty() {
+		if r, ok := pctDecode(dst, cd.FilenameEnc.Get(buf)); ok {
+			return r
+		}
+	}
+	if cd.FilenameQuoted {
+		return unescapeQuoted(dst, cd.Filename.Get(buf))
+	}
+	return append(dst, cd.Filename.Get(buf)...)
+}
+
+// ParseContentDispositionVal parses a Content-Disposition header value,
+// starting at offs in buf and filling cd.
+// It returns a new offset pointing after the part that was parsed and
+// an error.
+// It can return ErrHdrMoreBytes if more data is needed (the value is not
+// fully contained in buf). In this case it should be called again
+// with the same cd and the returned offset, after more bytes were added.
+func ParseContentDispositionVal(buf []byte, offs int,
+	cd *PContentDisposition) (int, ErrorHdr) {
+	// parsing token flags: single token, with parameters
+	const flags = PTokAllowParamsF
+
+	next, err := ParseTokenLst(buf, offs, &cd.tok, flags)
+	switch err {
+	case 0:
+		// do nothing
+	case ErrHdrMoreBytes:
+		return next, err
+	case ErrHdrMoreValues:
+		// should never happen (no list separators allowed)
+		return next, ErrHdrBadChar
+	default:
+		return next, err
+	}
+	cd.TypeVal = cd.tok.V
+	cd.Val = cd.tok.V
+	if !cd.tok.Params.Empty() {
+		cd.Val.Extend(cd.tok.Params.EndOffs())
+		if perr := cd.parseParams(buf); perr != 0 {
+			return int(cd.tok.Params.Offs), perr
+		}
+	}
+	cd.Type = CDispResolve(cd.TypeVal.Get(buf))
+	return next, 0
+}
+
+// parseParams parses the already found Content-Disposition parameters,
+// filling the known values.
+func (cd *PContentDisposition) parseParams(buf []byte) ErrorHdr {
+	var param PTokParam
+	o := int(cd.tok.Params.Offs)
+	pbuf := buf[:cd.tok.Params.EndOffs()]
+	for o < len(pbuf) {
+		param.Reset()
+		n, err := ParseTokenParam(pbuf, o, &param, PTokInputEndF)
+		switch err {
+		case ErrHdrOk, ErrHdrMoreValues, ErrHdrEOH:
+		case ErrHdrEmpty:
+			return 0
+		default:
+			return err
+		}
+		if !param.All.Empty() {
+			cd.setParam(buf, &param)
+		}
+		if err != ErrHdrMoreValues {
+			break
+		}
+		o = n
+	}
+	return 0
+}
+
+// setParam checks if the parameter is known and sets the corresponding
+// Content-Disposition value.
+func (cd *PContentDisposition) setParam(buf []byte, p *PTokParam) {
+	n := p.Name.Get(buf)
+	v, quoted := unquotePField(buf, p.Val)
+	switch {
+	case len(n) == 4 && bytescase.CmpEq(n, []byte("name")):
+		cd.Name = v
+	case len(n) == 8 && bytescase.CmpEq(n, []byte("filename")):
+		cd.Filename = v
+		cd.FilenameQuoted = quoted
+	case len(n) == 9 && bytescase.CmpEq(n, []byte("filename*")):
+		cd.FilenameExt = p.Val
+		cd.FilenameCharset.Reset()
+		cd.FilenameLang.Reset()
+		cd.FilenameEnc.Reset()
+		// charset ' [ language ] ' value-chars
+		s := int(p.Val.Offs)
+		e := p.Val.EndOffs()
+		q1 := -1
+		for i := s; i < e; i++ {
+			if buf[i] == '\'' {
+				if q1 < 0 {
+					q1 = i
+					continue
+				}
+				if q1 > s {
+					cd.FilenameCharset.Set(s, q1)
+					cd.FilenameLang.Set(q1+1, i)
+					cd.FilenameEnc.Set(i+1, e)
+				}
+				break
+			}
+		}
+	}
+}
+
+// unquotePField returns the field without the enclosing quotes and
+// true if f contains a quoted string, or f unchanged and false otherwise.
+func unquotePField(buf []byte, f PField) (PField, bool) {
+	if f.Len >= 2 && buf[f.Offs] == '"' && buf[f.EndOffs()-1] == '"' {
+		return PField{Offs: f.Offs + 1, Len: f.Len - 2}, true
+	}
+	return f, false
+}
+
+// unescapeQuoted appends the content of a quoted string (without the
+// enclosing quotes) to dst, resolving the quoted-pairs ("\x" -> "x").
+func unescapeQuoted(dst, s []byte) []byte {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && (i+1) < len(s) {
+			i++
+		}
+		dst = append(dst, s[i])
+	}
+	return dst
+}
+
+// pctDecode appends the percent-decoded s to dst.
+// It returns the extended slice and true on success or dst and false if s
+// contains an invalid percent-encoding.
+func pctDecode(dst, s []byte) ([]byte, bool) {
+	l := len(dst)
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' {
+			if (i + 2) >= len(s) {
+				return dst[:l], false
+			}
+			h := hexDigToI(s[i+1])
+			lo := hexDigToI(s[i+2])
+			if h < 0 || lo < 0 {
+				return dst[:l], false
+			}
+			dst = append(dst, byte(h<<4|lo))
+			i += 2
+			continue
+		}
+		dst = append(dst, s[i])
+	}
+	return dst, true
+}
@@ -0,0 +1,119 @@
+// Copyright 2021 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestParseContentDispositionVal(t *testing.T) {
+	type testCase struct {
+		v     string // header value, without the terminating CRLF
+		err   ErrorHdr
+		t     CDispT
+		name  string
+		fname string // filename (raw)
+		dfn   string // decoded filename (GetFilename())
+	}
+
+	tests := [...]testCase{
+		{v: "inline", t: CDispInline},
+		{v: "ATTACHMENT", t: CDispAttachment},
+		{v: "attachment; filename=foo.html", t: CDispAttachment,
+			fname: "foo.html", dfn: "foo.html"},
+		{v: `attachment; filename="foo bar.html"`, t: CDispAttachment,
+			fname: "foo bar.html", dfn: "foo bar.html"},
+		{v: `attachment; filename="a\"b\\c.txt"`, t: CDispAttachment,
+			fname: `a\"b\\c.txt`, dfn: `a"b\c.txt`},
+		{v: `form-data; name="field1"; filename="example.txt"`,
+			t: CDispFormData, name: "field1",
+			fname: "example.txt", dfn: "example.txt"},
+		{v: `form-data ; NAME = upload`, t: CDispFormData, name: "upload"},
+		{v: `attachment; filename="EURO rates";` +
+			` filename*=utf-8''%e2%82%ac%20rates`,
+			t: CDispAttachment, fname: "EURO rates", dfn: "€ rates"},
+		{v: `attachment; filename*=UTF-8'en'a%2`, t: CDispAttachment,
+			dfn: ""},
+		{v: `x-foo; p1=v1`, t: CDispOther},
+		{v: `attachment, inline`, err: ErrHdrBadChar},
+		{v: `attachment; filename="foo`, err: ErrHdrBadChar},
+	}
+
+	for _, c := range tests {
+		buf := []byte(c.v + "\r\n\r\n")
+		var cd PContentDisposition
+		var o int
+		var err ErrorHdr
+		// parse in random pieces
+		for end := rand.Intn(len(buf) + 1); end < len(buf); end += rand.Intn(len(buf)-end) + 1 {
+			o, err = ParseContentDispositionVal(buf[:end], o, &cd)
+			if err != ErrHdrMoreBytes {
+				break
+			}
+		}
+		if err == 0 || err == ErrHdrMoreBytes {
+			o, err = ParseContentDispositionVal(buf, o, &cd)
+		}
+		if err != c.err {
+			t.Errorf("ParseContentDispositionVal(%q, ..)=[%d, %d(%q)]"+
+				" error %s (%q) expected", buf, o, err, err, c.err, c.err)
+			continue
+		}
+		if err != 0 {
+			continue
+		}
+		if o != len(buf)-2 {
+			t.Errorf("ParseContentDispositionVal(%q, ..)=[%d, %d(%q)]"+
+				" offset %d expected", buf, o, err, err, len(buf)-2)
+		}
+		if cd.Type != c.t || !cd.Parsed() {
+			t.Errorf("ParseContentDispositionVal(%q, ..): type %s,"+
+				" expected %s", buf, cd.Type, c.t)
+		}
+		if string(cd.Val.Get(buf)) != c.v {
+			t.Errorf("ParseContentDispositionVal(%q, ..): val %q,"+
+				" expected %q", buf, cd.Val.Get(buf), c.v)
+		}
+		if string(cd.Name.Get(buf)) != c.name {
+			t.Errorf("ParseContentDispositionVal(%q, ..): name %q,"+
+				" expected %q", buf, cd.Name.Get(buf), c.name)
+		}
+		if string(cd.Filename.Get(buf)) != c.fname {
+			t.Errorf("ParseContentDispositionVal(%q, ..): filename %q,"+
+				" expected %q", buf, cd.Filename.Get(buf), c.fname)
+		}
+		if fn := cd.GetFilename(nil, buf); string(fn) != c.dfn {
+			t.Errorf("ParseContentDispositionVal(%q, ..): GetFilename() %q,"+
+				" expected %q", buf, fn, c.dfn)
+		}
+	}
+}
+
+func TestParseHeadersCDispEmpty(t *testing.T) {
+	buf := []byte("Content-Disposition:\r\nX-Foo: 1\r\n" +
+		"Content-Disposition: attachment; filename=a.txt\r\n" +
+		"Content-Length: 3\r\n\r\n")
+	for _, step := range []int{len(buf), 1} {
+		var hl HdrLst
+		var pv PHdrVals
+		o, err := parseHdrsPieces(buf, step, &hl, &pv)
+		if err != 0 || o != len(buf) || hl.N != 4 {
+			t.Errorf("ParseHeaders(%q) step %d = [%d, %d(%q)], %d headers",
+				buf, step, o, err, err, hl.N)
+			continue
+		}
+		cd := &pv.CDisp
+		if !cd.Parsed() || cd.Type != CDispAttachment ||
+			string(cd.Filename.Get(buf)) != "a.txt" ||
+			!hl.GetHdr(HdrContentDisposition).Val.Empty() ||
+			!pv.CLen.Parsed() {
+			t.Errorf("ParseHeaders(%q) step %d: type %s, filename %q",
+				buf, step, cd.Type, cd.Filename.Get(buf))
+		}
+	}
+}
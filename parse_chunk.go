@@ -6,7 +6,9 @@
 
 package httpsp
 
-import ()
+import (
+	"github.com/intuitivelabs/bytescase"
+)
 
 // ChunkVal contains a parsed "chunk" delimiter
 type ChunkVal struct {
@@ -14,6 +16,7 @@ type ChunkVal struct {
 	Size        int64  // chunk size
 	TrailerHdrs HdrLst // trailer headers if last chunk
 	state       uint8  // internal state
+	trOffs      int    // trailer start offset (last chunk)
 }
 
 // Reset  re-initializes the internal parsed token.
@@ -22,6 +25,7 @@ func (v *ChunkVal) Reset() {
 	v.Size = 0
 	v.TrailerHdrs.Reset()
 	v.state = 0
+	v.trOffs = 0
 }
 
 // More returns true if there are more chunks following
@@ -29,6 +33,49 @@ func (v *ChunkVal) More() bool {
 	return v.Size > 0
 }
 
+// ExtParam returns the value of the chunk extension with the given name
+// (case insensitive) and true if found, or an empty PField and false
+// if not. For an extension without value (e.g. ";foo") it returns an
+// empty PField and true. Quoted values are returned without the quotes.
+// buf is the buffer the chunk was parsed from.
+func (v *ChunkVal) ExtParam(buf []byte, name []byte) (PField, bool) {
+	var param PTokParam
+	if v.Val.Params.Empty() {
+		return PField{}, false
+	}
+	o := int(v.Val.Params.Offs)
+	pbuf := buf[:v.Val.Params.EndOffs()]
+	for o < len(pbuf) {
+		param.Reset()
+		n, err := ParseTokenParam(pbuf, o, &param, PTokInputEndF)
+		switch err {
+		case ErrHdrOk, ErrHdrMoreValues, ErrHdrEOH:
+		default:
+			return PField{}, false
+		}
+		if !param.All.Empty() {
+			pn := param.Name.Get(buf)
+			if len(pn) == len(name) && bytescase.CmpEq(pn, name) {
+				val, _ := unquotePField(buf, param.Val)
+				return val, true
+			}
+		}
+		if err != ErrHdrMoreValues {
+			break
+		}
+		o = n
+	}
+	return PField{}, false
+}
+
+// ChunkVal internal parsing states
+const (
+	sCnkParse       = iota // parsing the chunk-size line
+	sCnkPTrailer           // parsing the trailer (last chunk)
+	sCnkSkipTrailer        // skipping the trailer, at a line start
+	sCnkSkipTrLine         // skipping the trailer, inside a line
+)
+
 // ParseChunk parses a chunk "delimiter".
 // (see rfc 7230 section 4.1)
 // The return values are: a new offset after the parsed value that is either
@@ -42,22 +89,31 @@ func (v *ChunkVal) More() bool {
 //  final CRLF)
 // It can return ErrHdrMoreBytes if more data is needed (the value is not
 // fully contained in buf).
+// See also ParseChunkFlags().
 func ParseChunk(buf []byte, offs int, chunk *ChunkVal) (int, int64, ErrorHdr) {
-	// parsing token list flags
-	const flags = PTokAllowParamsF
-	const (
-		sCnkParse = iota
-		sCnkPTrailer
-	)
+	return ParseChunkFlags(buf, offs, chunk, 0)
+}
 
+// ParseChunkFlags is a version of ParseChunk() that accepts ParseMsg()
+// parsing flags. The only flag currently used is MsgSkipTrailersF: if set,
+// the trailer headers following the last chunk are not parsed into
+// chunk.TrailerHdrs, the parser only looks for the trailer end
+// (empty line).
+func ParseChunkFlags(buf []byte, offs int, chunk *ChunkVal,
+	flags MsgFlags) (int, int64, ErrorHdr) {
+	// parsing token list flags
+	const tflags = PTokAllowParamsF
 	var next int
 	var err ErrorHdr
 
+	if len(buf) > MaxBufSize {
+		return offs, -1, ErrHdrTooBig
+	}
 	size := int64(-1)
 retry:
 	switch chunk.state {
 	case sCnkParse:
-		next, err = ParseTokenLst(buf, offs, &chunk.Val, flags)
+		next, err = ParseTokenLst(buf, offs, &chunk.Val, tflags)
 		switch err {
 		case 0:
 			//  chunk size
@@ -69,7 +125,12 @@ retry:
 				chunk.Size = size // save parsed size
 				if size == 0 {
 					// set state to parse-last-chunk-trailer
-					chunk.state = sCnkPTrailer
+					if (flags & MsgSkipTrailersF) != 0 {
+						chunk.state = sCnkSkipTrailer
+					} else {
+						chunk.state = sCnkPTrailer
+					}
+					chunk.trOffs = next
 					offs = next
 					goto retry
 				}
@@ -91,6 +152,43 @@ retry:
 		}
 		size = chunk.Size // restore parsed size
 		// TODO: some error checking on success: error on disallowed headers?
+	case sCnkSkipTrailer, sCnkSkipTrLine:
+		next, err = skipChunkTrailer(buf, offs, chunk)
+		size = chunk.Size // restore parsed size
 	}
 	return next, size, err
 }
+
+// skipChunkTrailer skips over the trailer of the last chunk, without
+// parsing the headers, starting at offs in buf.
+// On success it returns the offset of the final CRLF (like for a parsed
+// trailer) and 0. If the trailer end was not found, it returns an offset
+// from which skipping can be resumed and ErrHdrMoreBytes.
+func skipChunkTrailer(buf []byte, offs int, chunk *ChunkVal) (int, ErrorHdr) {
+	i := offs
+	for i < len(buf) {
+		if chunk.state == sCnkSkipTrailer {
+			// line start: check for the empty line
+			if buf[i] == '\n' {
+				return i - 1, 0 // bare LF
+			}
+			if buf[i] == '\r' {
+				if i+1 >= len(buf) {
+					break
+				}
+				if buf[i+1] == '\n' {
+					return i, 0
+				}
+			}
+			chunk.state = sCnkSkipTrLine
+		}
+		for ; i < len(buf) && buf[i] != '\n'; i++ {
+		}
+		if i >= len(buf) {
+			break
+		}
+		i++ // skip LF
+		chunk.state = sCnkSkipTrailer
+	}
+	return i, ErrHdrMoreBytes
+}
@@ -166,3 +166,77 @@ func testParseChunkPieces(t *testing.T, chHdr, chD []byte,
 	}
 	testParseChunk(t, chHdr, chD, o, cv, tc)
 }
+
+func TestChunkExtParam(t *testing.T) {
+	tests := [...]struct {
+		c     string
+		name  string
+		val   string
+		found bool
+	}{
+		{"1a;sig=abc\r\nx", "sig", "abc", true},
+		{"1a;SIG=abc\r\nx", "sig", "abc", true},
+		{"1a ; foo ; sig = \"a b\"\r\nx", "sig", "a b", true},
+		{"1a;foo;sig=abc\r\nx", "foo", "", true},
+		{"1a;foo;sig=abc\r\nx", "si", "", false},
+		{"1a;foo=1\r\nx", "sig", "", false},
+		{"1a\r\nx", "sig", "", false},
+		{"0;last=1\r\n\r\n", "last", "1", true},
+	}
+	for _, c := range tests {
+		var cv ChunkVal
+		buf := []byte(c.c)
+		if o, _, err := ParseChunk(buf, 0, &cv); err != 0 {
+			t.Errorf("ParseChunk(%q, 0, ..) = [%d, %d(%q)]", buf, o, err, err)
+			continue
+		}
+		v, found := cv.ExtParam(buf, []byte(c.name))
+		if found != c.found || string(v.Get(buf)) != c.val {
+			t.Errorf("ExtParam(%q, %q) = %q, %v, expected %q, %v",
+				buf, c.name, v.Get(buf), found, c.val, c.found)
+		}
+	}
+}
+
+func TestParseChunkSkipTrailers(t *testing.T) {
+	tests := [...]string{
+		"0\r\n\r\n",
+		"0;ext=1\r\n\r\n",
+		"0\r\nTest-Hdr: foo bar\r\n\r\n",
+		"0\r\nFoo: header1\r\nBar: header2\r\n\r\n",
+		"0\r\nFoo: folded\r\n header1\r\nBar: x\r\n\r\n",
+	}
+	for _, c := range tests {
+		buf := []byte(c)
+		var cv, ecv ChunkVal
+		eo, esz, eerr := ParseChunk(buf, 0, &ecv)
+		for _, step := range []int{len(buf), 1} {
+			cv.Reset()
+			o := 0
+			var sz int64
+			err := ErrHdrMoreBytes
+			for end := step; err == ErrHdrMoreBytes && end <= len(buf); end += step {
+				o, sz, err = ParseChunkFlags(buf[:end], o, &cv,
+					MsgSkipTrailersF)
+			}
+			if err != eerr || o != eo || sz != esz || cv.Size != esz ||
+				cv.TrailerHdrs.N != 0 {
+				t.Errorf("ParseChunkFlags(%q, .., %d) = [%d, %d, %d(%q)],"+
+					" %d trailers, expected [%d, %d, %d(%q)], 0 trailers",
+					buf, step, o, sz, err, err, cv.TrailerHdrs.N,
+					eo, esz, eerr, eerr)
+			}
+		}
+	}
+	// full message
+	const m = "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"3\r\nabc\r\n0\r\nFoo: bar\r\nBar: baz\r\n\r\n"
+	var msg PMsg
+	msg.Init(nil, nil)
+	o, err := ParseMsg([]byte(m), 0, &msg, MsgSkipTrailersF)
+	if err != 0 || o != len(m) || !msg.ChunkedComplete() ||
+		msg.LastChunk.TrailerHdrs.N != 0 {
+		t.Errorf("ParseMsg(%q, MsgSkipTrailersF) = [%d, %d(%q)], %d trailers",
+			m, o, err, err, msg.LastChunk.TrailerHdrs.N)
+	}
+}
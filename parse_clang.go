@@ -0,0 +1,139 @@
+// Copyright 2021 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+import (
+	"github.com/intuitivelabs/bytescase"
+)
+
+// PContentLanguage contains the parsed Content-Language header values
+// for one or more different headers (all the language tags in the message
+// that fit in the parsed value array, see rfc7231 3.1.3.2).
+type PContentLanguage struct {
+	Vals []PField // parsed language tags (e.g. "en-US")
+	N    int      // no of  _values_ found, can be >len(Vals)
+	HNo  int      // no of different Content-Language _headers_ found
+	// parsed hdr content during the last ParseAll... call
+	// (contains a trimmed value or several values, overwritten by each
+	//  ParseAll.. call; it can also be empty, e.g. on ErrHdrMoreByte)
+	LastParsed PField
+	tmp        PToken // temporary saved state (between calls)
+	first      PField // even if Vals is nil, we remember the first val.
+}
+
+// VNo returns the number of parsed language tags.
+func (l *PContentLanguage) VNo() int {
+	if l.N > len(l.Vals) {
+		return len(l.Vals)
+	}
+	return l.N
+}
+
+// GetTag returns the requested parsed language tag or an empty PField.
+func (l *PContentLanguage) GetTag(n int) PField {
+	if l.VNo() > n {
+		return l.Vals[n]
+	}
+	if n == 0 && !l.Empty() {
+		return l.first
+	}
+	return PField{}
+}
+
+// More returns true if there are more values that did not fit in Vals.
+func (l *PContentLanguage) More() bool {
+	return l.N > len(l.Vals)
+}
+
+// Reset re-initializes the parsed values.
+func (l *PContentLanguage) Reset() {
+	for i := 0; i < l.VNo(); i++ {
+		l.Vals[i].Reset()
+	}
+	v := l.Vals
+	*l = PContentLanguage{}
+	l.Vals = v
+}
+
+// Init initializes the parsed language tags buf from an array.
+func (l *PContentLanguage) Init(valbuf []PField) {
+	l.Vals = valbuf
+}
+
+// Empty returns true if no Content-Language values have been parsed.
+func (l *PContentLanguage) Empty() bool {
+	return l.N == 0
+}
+
+// Parsed returns true if there are some parsed Content-Language values.
+func (l *PContentLanguage) Parsed() bool {
+	return l.N > 0
+}
+
+// Has returns true if the language tag is present (case insensitive
+// comparison). Only the tags that fit in Vals (or the first one if Vals
+// is nil) are searched.
+func (l *PContentLanguage) Has(buf, tag []byte) bool {
+	n := l.VNo()
+	if n == 0 && l.Parsed() {
+		f := l.first
+		return int(f.Len) == len(tag) && bytescase.CmpEq(f.Get(buf), tag)
+	}
+	for i := 0; i < n; i++ {
+		if int(l.Vals[i].Len) == len(tag) &&
+			bytescase.CmpEq(l.Vals[i].Get(buf), tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseAllContentLanguageValues tries to parse all the values in a
+// Content-Language header situated at offs in buf and adds them to the
+// passed PContentLanguage values.
+// The return values are: a new offset after the parsed value (that can be
+// used to continue parsing), the number of header values parsed and an error.
+// It can return ErrHdrMoreBytes if more data is needed (the value is not
+// fully contained in buf).
+func ParseAllContentLanguageValues(buf []byte, offs int,
+	l *PContentLanguage) (int, int, ErrorHdr) {
+	const flags = PTokCommaSepF // parsing token list flags
+	var next int
+	var err ErrorHdr
+
+	vNo := 0             // number of values parsed during the current call
+	l.LastParsed.Reset() // clear LastParsed on each call
+	for {
+		next, err = ParseTokenLst(buf, offs, &l.tmp, flags)
+		switch err {
+		case 0, ErrHdrMoreValues:
+			if vNo == 0 {
+				l.LastParsed = l.tmp.V
+			} else {
+				l.LastParsed.Extend(int(l.tmp.V.Offs + l.tmp.V.Len))
+			}
+			if l.N < len(l.Vals) {
+				l.Vals[l.N] = l.tmp.V
+			} else if l.N == 0 {
+				l.first = l.tmp.V
+			}
+			vNo++
+			l.N++
+			l.tmp.Reset() // prepare for next value (cleanup tmp state)
+			if err == ErrHdrMoreValues {
+				offs = next
+				continue // get next value
+			}
+		case ErrHdrMoreBytes:
+			// do nothing, just for readability
+		default:
+			l.tmp.Reset() // some error -> clear the crt tmp state
+		}
+		break
+	}
+	return next, vNo, err
+}
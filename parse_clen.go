@@ -4,8 +4,6 @@
 // that can be found in the LICENSE.txt file in the root of the source
 // tree.
 
-// TODO: number of values and number of diff values (if > 1 diff values => err)
-
 package httpsp
 
 // MaxCLenValueSize holds the maximum length of the Content-Length value
@@ -16,9 +14,13 @@ const MaxCLenValueSize = 9
 const MaxClenValue = 1 << 24 // numeric max.
 
 // PUIntBody holds a partial or fully parsed unsigned int header value.
+// For a list of values (see ParseCLenVal()) SVal contains the whole list
+// and UIVal the common value.
 type PUIntBody struct {
 	UIVal uint32
 	SVal  PField
+	N     int // number of values (> 1 only for lists)
+	HNo   int // no of different Content-Length _headers_ found
 	PUIntIState
 }
 
@@ -45,8 +47,11 @@ func (cl PUIntBody) Pending() bool {
 
 // PUIntIState contains ParseUIntVal internal state info (private).
 type PUIntIState struct {
-	state uint8 // internal state
-	soffs int   // saved internal offset
+	state  uint8  // internal state
+	soffs  int    // saved internal offset
+	fstart int    // first value start offset (lists)
+	vmax   int    // maximum value length (lists)
+	prev   uint32 // previous value (lists)
 }
 
 // internal parser state
@@ -59,13 +64,17 @@ const (
 
 // ParseCLenVal parses a Content-Length header value, starting at offs
 // in buf and filling pcl.
+// A comma separated list of identical values (e.g. "42, 42", sent by
+// some servers instead of multiple Content-Length headers) is accepted
+// and the common value is used (rfc7230 3.3.2). A list with different
+// values is rejected with ErrHdrMultiCLen.
 // It returns a new offset pointing after the part that was parsed and
 // an error.
 // For more information see ParseUIntVal().
 func ParseCLenVal(buf []byte, offs int, pcl *PUIntBody) (int, ErrorHdr) {
-	o, err := ParseUIntVal(buf, offs, pcl)
+	o, err := parseUIntVal(buf, offs, pcl, true)
 	if err == 0 &&
-		(pcl.SVal.Len > MaxCLenValueSize || pcl.UIVal > MaxClenValue) {
+		(pcl.vmax > MaxCLenValueSize || pcl.UIVal > MaxClenValue) {
 		return int(pcl.SVal.Offs), ErrHdrNumTooBig
 	}
 	return o, err
@@ -83,6 +92,28 @@ func ParseCLenVal(buf []byte, offs int, pcl *PUIntBody) (int, ErrorHdr) {
 // when more bytes are available, with the same buffer, the returned
 // offset ("continue point") and the same pfrom structure.
 func ParseUIntVal(buf []byte, offs int, pcl *PUIntBody) (int, ErrorHdr) {
+	return parseUIntVal(buf, offs, pcl, false)
+}
+
+// parseUIntVal is the internal version of ParseUIntVal(). If lst is true,
+// a comma separated list of identical values is accepted (a list with
+// different values returns ErrHdrMultiCLen).
+func parseUIntVal(buf []byte, offs int, pcl *PUIntBody,
+	lst bool) (int, ErrorHdr) {
+
+	// valEnd marks the end of the current value in a list
+	valEnd := func(e int) ErrorHdr {
+		if pcl.N > 0 && pcl.UIVal != pcl.prev {
+			return ErrHdrMultiCLen
+		}
+		if e-pcl.soffs > pcl.vmax {
+			pcl.vmax = e - pcl.soffs
+		}
+		pcl.prev = pcl.UIVal
+		pcl.N++
+		pcl.SVal.Set(pcl.fstart, e)
+		return 0
+	}
 
 	if pcl.state == clFIN {
 		// called again after finishing
@@ -97,7 +128,9 @@ func ParseUIntVal(buf []byte, offs int, pcl *PUIntBody) (int, ErrorHdr) {
 		case ' ', '\t', '\n', '\r':
 			switch pcl.state {
 			case clFound:
-				pcl.SVal.Set(pcl.soffs, i)
+				if err = valEnd(i); err != 0 {
+					return i, err
+				}
 				pcl.state = clEnd
 				fallthrough
 			case clInit, clEnd:
@@ -122,6 +155,9 @@ func ParseUIntVal(buf []byte, offs int, pcl *PUIntBody) (int, ErrorHdr) {
 			case clInit:
 				pcl.state = clFound
 				pcl.soffs = i
+				if pcl.N == 0 {
+					pcl.fstart = i
+				}
 				pcl.UIVal = uint32(c - '0')
 			case clFound:
 				v := pcl.UIVal*10 + uint32(c-'0')
@@ -134,6 +170,17 @@ func ParseUIntVal(buf []byte, offs int, pcl *PUIntBody) (int, ErrorHdr) {
 				// error, stuff found after callid end (WS in callid ?)
 				return i, ErrHdrBadChar
 			}
+		case ',':
+			if !lst {
+				return i, ErrHdrBadChar
+			}
+			if pcl.state == clFound {
+				if err = valEnd(i); err != 0 {
+					return i, err
+				}
+			}
+			// (in clInit state: empty list element, ignore it)
+			pcl.state = clInit
 		default:
 			// non-number, non whitespace => error
 			return i, ErrHdrBadChar
@@ -153,10 +200,16 @@ endOfHdr:
 	case clEnd:
 		// do nothing
 	case clFound:
-		// start found => callid is terminated by CRLF
-		pcl.SVal.Set(pcl.soffs, i)
+		// start found => value is terminated by CRLF
+		if err = valEnd(i); err != 0 {
+			return i, err
+		}
 	case clInit:
-		// empty callid
+		if pcl.N > 0 {
+			// list ending in ','
+			break
+		}
+		// empty value
 		return n + crl, ErrHdrBad
 	default:
 		return n + crl, ErrHdrBug
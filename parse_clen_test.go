@@ -38,6 +38,14 @@ func TestParseCLenVal(t *testing.T) {
 			expRes: expRes{err: ErrHdrNumTooBig, val: 16777217}},
 		{clen: "1234 56789",
 			expRes: expRes{err: ErrHdrBadChar, val: 1234}},
+		// lists of identical values
+		{clen: "42, 42", expRes: expRes{err: 0, offs: 8, val: 42}},
+		{clen: "42,42 ,, 042", expRes: expRes{err: 0, offs: 14, val: 42}},
+		{clen: "42, 43", expRes: expRes{err: ErrHdrMultiCLen, offs: 1}},
+		{clen: "1,1,2", expRes: expRes{err: ErrHdrMultiCLen, offs: 1}},
+		{clen: "1, 0000000001",
+			expRes: expRes{err: ErrHdrNumTooBig, offs: 1}},
+		{clen: ",", expRes: expRes{err: ErrHdrBad, offs: -1}},
 	}
 
 	for _, c := range tests {
@@ -0,0 +1,128 @@
+// Copyright 2021 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+import (
+	"github.com/intuitivelabs/bytescase"
+)
+
+// ConnOptT is the type for the Connection options converted to flag values.
+type ConnOptT uint
+
+// Connection options flag values, see rfc7230 6.1.
+const (
+	ConnOptNone    ConnOptT = 0
+	ConnCloseF     ConnOptT = 1 << iota
+	ConnKeepAliveF          // non-standard, but widely used
+	ConnUpgradeF
+	ConnOtherF // unknown/other (e.g. a header name)
+)
+
+// ConnOptResolve will try to resolve the connection option name to a
+// numeric ConnOptT flag.
+func ConnOptResolve(n []byte) ConnOptT {
+	switch len(n) {
+	case 5:
+		if bytescase.CmpEq(n, []byte("close")) {
+			return ConnCloseF
+		}
+	case 7:
+		if bytescase.CmpEq(n, []byte("upgrade")) {
+			return ConnUpgradeF
+		}
+	case 10:
+		if bytescase.CmpEq(n, []byte("keep-alive")) {
+			return ConnKeepAliveF
+		}
+	}
+	return ConnOtherF
+}
+
+// PConnection contains the parsed Connection header values for one or
+// more different Connection headers.
+// Only the option flags are kept: the known options and the known header
+// types listed (that are hop-by-hop for this connection, see HopByHop()).
+type PConnection struct {
+	N    int      // no of  _values_ found
+	HNo  int      // no of different Connection _headers_ found
+	Opts ConnOptT // flags for the known connection options
+	Hdrs HdrFlags // flags for the known header types listed
+	// parsed hdr content during the last ParseAll... call
+	// (contains a trimmed value or several values, overwritten by each
+	//  ParseAll.. call; it can also be empty, e.g. on ErrHdrMoreByte)
+	LastParsed PField
+	tmp        PToken // temporary saved state (between calls)
+}
+
+// Reset re-initializes the parsed values.
+func (c *PConnection) Reset() {
+	*c = PConnection{}
+}
+
+// Empty returns true if no Connection values have been parsed.
+func (c *PConnection) Empty() bool {
+	return c.N == 0
+}
+
+// Parsed returns true if there are some parsed Connection values.
+func (c *PConnection) Parsed() bool {
+	return c.N > 0
+}
+
+// Has returns true if the connection option o is present.
+func (c *PConnection) Has(o ConnOptT) bool {
+	return c.Opts&o != 0
+}
+
+// ParseAllConnectionValues tries to parse all the values in a
+// Connection header situated at offs in buf and adds them to
+// the passed PConnection values.
+// The return values are: a new offset after the parsed value (that can be
+// used to continue parsing), the number of header values parsed and an error.
+// It can return ErrHdrMoreBytes if more data is needed (the value is not
+// fully contained in buf).
+func ParseAllConnectionValues(buf []byte, offs int,
+	c *PConnection) (int, int, ErrorHdr) {
+	const flags = PTokCommaSepF // parsing token list flags
+	var next int
+	var err ErrorHdr
+
+	vNo := 0             // number of values parsed during the current call
+	c.LastParsed.Reset() // clear LastParsed on each call
+	for {
+		next, err = ParseTokenLst(buf, offs, &c.tmp, flags)
+		switch err {
+		case 0, ErrHdrMoreValues:
+			if vNo == 0 {
+				c.LastParsed = c.tmp.V
+			} else {
+				c.LastParsed.Extend(int(c.tmp.V.Offs + c.tmp.V.Len))
+			}
+			v := c.tmp.V.Get(buf)
+			o := ConnOptResolve(v)
+			c.Opts |= o
+			if o == ConnOtherF {
+				if t := GetHdrType(v); t != HdrOther {
+					c.Hdrs.Set(t)
+				}
+			}
+			vNo++
+			c.N++
+			c.tmp.Reset() // prepare for next value (cleanup tmp state)
+			if err == ErrHdrMoreValues {
+				offs = next
+				continue // get next value
+			}
+		case ErrHdrMoreBytes:
+			// do nothing, just for readability
+		default:
+			c.tmp.Reset() // some error -> clear the crt tmp state
+		}
+		break
+	}
+	return next, vNo, err
+}
@@ -0,0 +1,276 @@
+// Copyright 2021 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+// PACReqMethod contains a parsed Access-Control-Request-Method header
+// value (a single method name, see the Fetch standard, CORS protocol).
+type PACReqMethod struct {
+	Val    PField     // method name
+	Method HTTPMethod // numeric method value (MOther if not known)
+	tok    PToken     // internal token parsing state
+}
+
+// Reset re-initializes the parsed value and internal parsing state.
+func (m *PACReqMethod) Reset() {
+	*m = PACReqMethod{}
+}
+
+// Empty returns true if nothing was parsed yet.
+func (m *PACReqMethod) Empty() bool {
+	return m.tok.Empty()
+}
+
+// Parsed returns true if the value is fully parsed.
+func (m *PACReqMethod) Parsed() bool {
+	return m.Method != MUndef
+}
+
+// ParseACReqMethodVal parses an Access-Control-Request-Method header
+// value, starting at offs in buf and filling m.
+// It returns a new offset pointing after the part that was parsed and
+// an error.
+// It can return ErrHdrMoreBytes if more data is needed (the value is not
+// fully contained in buf). In this case it should be called again
+// with the same m and the returned offset, after more bytes were added.
+func ParseACReqMethodVal(buf []byte, offs int,
+	m *PACReqMethod) (int, ErrorHdr) {
+	next, err := ParseTokenLst(buf, offs, &m.tok, 0)
+	switch err {
+	case 0:
+		// do nothing
+	case ErrHdrMoreValues:
+		// should never happen (no list separators allowed)
+		return next, ErrHdrBadChar
+	default:
+		return next, err
+	}
+	m.Val = m.tok.V
+	m.Method = GetMethodNo(m.Val.Get(buf))
+	return next, 0
+}
+
+// PMethodLst contains the parsed method list from one or more
+// Access-Control-Allow-Methods headers.
+// Only the method flags are kept (MOther is set for unknown methods).
+type PMethodLst struct {
+	N       int         // no of  _values_ found
+	HNo     int         // no of different _headers_ found
+	Methods MethodFlags // flags for each method found
+	Any     bool        // "*" found
+	// parsed hdr content during the last ParseAll... call
+	// (contains a trimmed value or several values, overwritten by each
+	//  ParseAll.. call; it can also be empty, e.g. on ErrHdrMoreByte)
+	LastParsed PField
+	tmp        PToken // temporary saved state (between calls)
+}
+
+// Reset re-initializes the parsed values.
+func (l *PMethodLst) Reset() {
+	*l = PMethodLst{}
+}
+
+// Empty returns true if no methods have been parsed.
+func (l *PMethodLst) Empty() bool {
+	return l.N == 0
+}
+
+// Parsed returns true if there are some parsed methods.
+func (l *PMethodLst) Parsed() bool {
+	return l.N > 0
+}
+
+// Allows returns true if the method m is in the list or "*" was present.
+func (l *PMethodLst) Allows(m HTTPMethod) bool {
+	return l.Any || l.Methods.Test(m)
+}
+
+// ParseAllMethodValues tries to parse all the values in a method list
+// header (e.g. Access-Control-Allow-Methods) situated at offs in buf and
+// adds them to the passed PMethodLst.
+// The return values are: a new offset after the parsed value (that can be
+// used to continue parsing), the number of header values parsed and an error.
+// It can return ErrHdrMoreBytes if more data is needed (the value is not
+// fully contained in buf).
+func ParseAllMethodValues(buf []byte, offs int,
+	l *PMethodLst) (int, int, ErrorHdr) {
+	const flags = PTokCommaSepF // parsing token list flags
+	var next int
+	var err ErrorHdr
+
+	vNo := 0             // number of values parsed during the current call
+	l.LastParsed.Reset() // clear LastParsed on each call
+	for {
+		next, err = ParseTokenLst(buf, offs, &l.tmp, flags)
+		switch err {
+		case 0, ErrHdrMoreValues:
+			if vNo == 0 {
+				l.LastParsed = l.tmp.V
+			} else {
+				l.LastParsed.Extend(int(l.tmp.V.Offs + l.tmp.V.Len))
+			}
+			v := l.tmp.V.Get(buf)
+			if len(v) == 1 && v[0] == '*' {
+				l.Any = true
+			} else {
+				l.Methods.Set(GetMethodNo(v))
+			}
+			vNo++
+			l.N++
+			l.tmp.Reset() // prepare for next value (cleanup tmp state)
+			if err == ErrHdrMoreValues {
+				offs = next
+				continue // get next value
+			}
+		case ErrHdrMoreBytes:
+			// do nothing, just for readability
+		default:
+			l.tmp.Reset() // some error -> clear the crt tmp state
+		}
+		break
+	}
+	return next, vNo, err
+}
+
+// PHdrNameLst contains the parsed header names list from one or more
+// Access-Control-Request-Headers or Access-Control-Allow-Headers headers.
+// Only the header type flags are kept (HdrOtherF is set for unknown
+// header names).
+type PHdrNameLst struct {
+	N    int      // no of  _values_ found
+	HNo  int      // no of different _headers_ found
+	Hdrs HdrFlags // flags for the known header types found in the list
+	All  bool     // "*" found
+	// parsed hdr content during the last ParseAll... call
+	// (contains a trimmed value or several values, overwritten by each
+	//  ParseAll.. call; it can also be empty, e.g. on ErrHdrMoreByte)
+	LastParsed PField
+	tmp        PToken // temporary saved state (between calls)
+}
+
+// Reset re-initializes the parsed values.
+func (l *PHdrNameLst) Reset() {
+	*l = PHdrNameLst{}
+}
+
+// Empty returns true if no header names have been parsed.
+func (l *PHdrNameLst) Empty() bool {
+	return l.N == 0
+}
+
+// Parsed returns true if there are some parsed header names.
+func (l *PHdrNameLst) Parsed() bool {
+	return l.N > 0
+}
+
+// Has returns true if the header type t is in the list or "*" was present.
+func (l *PHdrNameLst) Has(t HdrT) bool {
+	return l.All || l.Hdrs.Test(t)
+}
+
+// ParseAllHdrNameValues tries to parse all the values in a header names
+// list header (e.g. Access-Control-Allow-Headers) situated at offs in buf
+// and adds them to the passed PHdrNameLst.
+// The return values are: a new offset after the parsed value (that can be
+// used to continue parsing), the number of header values parsed and an error.
+// It can return ErrHdrMoreBytes if more data is needed (the value is not
+// fully contained in buf).
+func ParseAllHdrNameValues(buf []byte, offs int,
+	l *PHdrNameLst) (int, int, ErrorHdr) {
+	const flags = PTokCommaSepF // parsing token list flags
+	var next int
+	var err ErrorHdr
+
+	vNo := 0             // number of values parsed during the current call
+	l.LastParsed.Reset() // clear LastParsed on each call
+	for {
+		next, err = ParseTokenLst(buf, offs, &l.tmp, flags)
+		switch err {
+		case 0, ErrHdrMoreValues:
+			if vNo == 0 {
+				l.LastParsed = l.tmp.V
+			} else {
+				l.LastParsed.Extend(int(l.tmp.V.Offs + l.tmp.V.Len))
+			}
+			n := l.tmp.V.Get(buf)
+			if len(n) == 1 && n[0] == '*' {
+				l.All = true
+			} else {
+				l.Hdrs.Set(GetHdrType(n))
+			}
+			vNo++
+			l.N++
+			l.tmp.Reset() // prepare for next value (cleanup tmp state)
+			if err == ErrHdrMoreValues {
+				offs = next
+				continue // get next value
+			}
+		case ErrHdrMoreBytes:
+			// do nothing, just for readability
+		default:
+			l.tmp.Reset() // some error -> clear the crt tmp state
+		}
+		break
+	}
+	return next, vNo, err
+}
+
+// PACAllowOrigin contains a parsed Access-Control-Allow-Origin header
+// value: "*", "null" or a single serialized origin
+// (scheme "://" host [ ":" port ]).
+type PACAllowOrigin struct {
+	Val  PField // trimmed value
+	Any  bool   // "*"
+	Null bool   // "null"
+	hValState
+}
+
+// Reset re-initializes the parsed value and internal parsing state.
+func (o *PACAllowOrigin) Reset() {
+	*o = PACAllowOrigin{}
+}
+
+// Empty returns true if nothing was parsed yet.
+func (o *PACAllowOrigin) Empty() bool {
+	return o.state == hvInit && o.Val.Empty()
+}
+
+// Parsed returns true if the value is fully parsed.
+func (o *PACAllowOrigin) Parsed() bool {
+	return !o.Val.Empty()
+}
+
+// Matches returns true if the allowed origin matches the passed request
+// origin (case-sensitive comparison) or if any origin is allowed ("*").
+func (o *PACAllowOrigin) Matches(buf []byte, origin []byte) bool {
+	return o.Any || (!o.Null && string(o.Val.Get(buf)) == string(origin))
+}
+
+// ParseACAllowOriginVal parses an Access-Control-Allow-Origin header value,
+// starting at offs in buf and filling o.
+// It returns a new offset pointing after the part that was parsed and
+// an error.
+// It can return ErrHdrMoreBytes if more data is needed (the value is not
+// fully contained in buf). In this case it should be called again
+// with the same o and the returned offset, after more bytes were added.
+func ParseACAllowOriginVal(buf []byte, offs int,
+	o *PACAllowOrigin) (int, ErrorHdr) {
+	next, end, err := findHdrValEnd(buf, offs, &o.hValState)
+	if err != 0 {
+		return next, err
+	}
+	for i := o.vstart; i < end; i++ {
+		// single value, no white space or list separators allowed
+		if !tokAllowedChar(buf[i]) || buf[i] == ',' || buf[i] == '"' {
+			return i, ErrHdrBadChar
+		}
+	}
+	o.Val.Set(o.vstart, end)
+	v := o.Val.Get(buf)
+	o.Any = len(v) == 1 && v[0] == '*'
+	o.Null = string(v) == "null"
+	return next, 0
+}
@@ -0,0 +1,109 @@
+// Copyright 2022 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+import (
+	"bytes"
+
+	"github.com/intuitivelabs/bytescase"
+)
+
+// PContentRange contains a parsed Content-Range header value
+// (rfc7233 4.2):
+//
+//	Content-Range = byte-content-range / other-content-range
+//	byte-content-range = bytes-unit SP
+//	                     ( byte-range-resp / unsatisfied-range )
+//	byte-range-resp = byte-range "/" ( complete-length / "*" )
+//	byte-range = first-byte-pos "-" last-byte-pos
+//	unsatisfied-range = "*/" complete-length
+//
+// Only the "bytes" unit is supported.
+type PContentRange struct {
+	Val      PField // complete value
+	First    int64  // first byte position (-1 for an unsatisfied range)
+	Last     int64  // last byte position (-1 for an unsatisfied range)
+	Complete int64  // complete length, -1 if unknown ("*")
+}
+
+// Reset re-initializes the parsed value.
+func (cr *PContentRange) Reset() {
+	*cr = PContentRange{}
+}
+
+// Parsed returns true if the value was successfully parsed.
+func (cr *PContentRange) Parsed() bool {
+	return !cr.Val.Empty()
+}
+
+// Unsatisfied returns true for an unsatisfied range ("*/" complete-length,
+// used in 416 replies).
+func (cr *PContentRange) Unsatisfied() bool {
+	return cr.First < 0
+}
+
+// Len returns the number of bytes in the range (0 for an unsatisfied
+// range).
+func (cr *PContentRange) Len() int64 {
+	if cr.Unsatisfied() {
+		return 0
+	}
+	return cr.Last - cr.First + 1
+}
+
+// ParseContentRange parses a complete Content-Range value, found at v in
+// buf (e.g. the Val of a "Content-Range" HdrOther header) and fills cr.
+// It returns ErrHdrValBad for an unsupported unit, a malformed range or a
+// range not fitting in the complete length, ErrHdrValNotNumber for an
+// invalid position or length and ErrHdrNumTooBig on overflow.
+func ParseContentRange(buf []byte, v PField, cr *PContentRange) ErrorHdr {
+	var err ErrorHdr
+	cr.Reset()
+	b := v.Get(buf)
+	// bytes-unit SP
+	if len(b) < 6 || !bytescase.CmpEq(b[:5], []byte("bytes")) ||
+		b[5] != ' ' {
+		return ErrHdrValBad
+	}
+	r := b[6:]
+	i := bytes.IndexByte(r, '/')
+	if i < 0 {
+		return ErrHdrValBad
+	}
+	rng, clen := r[:i], r[i+1:]
+	complete := int64(-1)
+	if len(clen) != 1 || clen[0] != '*' {
+		if complete, err = parseDeltaSeconds(clen); err != 0 {
+			return err
+		}
+	}
+	first, last := int64(-1), int64(-1)
+	if len(rng) == 1 && rng[0] == '*' {
+		if complete < 0 {
+			// "*/*"
+			return ErrHdrValBad
+		}
+	} else {
+		if i = bytes.IndexByte(rng, '-'); i < 0 {
+			return ErrHdrValBad
+		}
+		if first, err = parseDeltaSeconds(rng[:i]); err != 0 {
+			return err
+		}
+		if last, err = parseDeltaSeconds(rng[i+1:]); err != 0 {
+			return err
+		}
+		if last < first || (complete >= 0 && last >= complete) {
+			return ErrHdrValBad
+		}
+	}
+	cr.Val = v
+	cr.First = first
+	cr.Last = last
+	cr.Complete = complete
+	return 0
+}
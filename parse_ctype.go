@@ -0,0 +1,158 @@
+// Copyright 2021 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+import (
+	"github.com/intuitivelabs/bytescase"
+)
+
+// PContentType contains a parsed Content-Type header value
+// ( type "/" subtype *( OWS ";" OWS parameter ), see rfc7231 3.1.1.1).
+type PContentType struct {
+	Val      PField // complete value (media type and parameters)
+	MType    PField // complete media type (type/subtype)
+	Type     PField // type part of the media type (e.g. "multipart")
+	SubType  PField // subtype part of the media type (e.g. "form-data")
+	Charset  PField // "charset" parameter value (without quotes)
+	Boundary PField // "boundary" parameter value (without quotes)
+	tok      PToken // internal token parsing state
+}
+
+// Reset re-initializes the parsed value and internal parsing state.
+func (ct *PContentType) Reset() {
+	*ct = PContentType{}
+}
+
+// Empty returns true if nothing was parsed yet.
+func (ct *PContentType) Empty() bool {
+	return ct.tok.Empty()
+}
+
+// Parsed returns true if the value is fully parsed.
+func (ct *PContentType) Parsed() bool {
+	return !ct.MType.Empty()
+}
+
+// IsMultipart returns true if the parsed media type is "multipart/*".
+// buf is the buffer the header was parsed from.
+func (ct *PContentType) IsMultipart(buf []byte) bool {
+	return ct.Type.Len == 9 &&
+		bytescase.CmpEq(ct.Type.Get(buf), []byte("multipart"))
+}
+
+// IsByteRanges returns true if the parsed media type is
+// "multipart/byteranges" (multiple ranges in a 206 reply, rfc7233 4.1).
+// buf is the buffer the header was parsed from.
+func (ct *PContentType) IsByteRanges(buf []byte) bool {
+	return ct.IsMultipart(buf) && ct.SubType.Len == 10 &&
+		bytescase.CmpEq(ct.SubType.Get(buf), []byte("byteranges"))
+}
+
+// IsText returns true if the parsed media type is "text/*".
+// buf is the buffer the header was parsed from.
+func (ct *PContentType) IsText(buf []byte) bool {
+	return ct.Type.Len == 4 &&
+		bytescase.CmpEq(ct.Type.Get(buf), []byte("text"))
+}
+
+// IsJSON returns true if the parsed media type is "application/json" or
+// a structured syntax "+json" suffix type (e.g. "application/ld+json",
+// see rfc6839).
+// buf is the buffer the header was parsed from.
+func (ct *PContentType) IsJSON(buf []byte) bool {
+	st := ct.SubType.Get(buf)
+	if len(st) > 5 && bytescase.CmpEq(st[len(st)-5:], []byte("+json")) {
+		return true
+	}
+	return ct.Type.Len == 11 &&
+		bytescase.CmpEq(ct.Type.Get(buf), []byte("application")) &&
+		len(st) == 4 && bytescase.CmpEq(st, []byte("json"))
+}
+
+// IsUTF8 returns true if the charset parameter is "utf-8" (or the
+// common "utf8" alias), case insensitive.
+// buf is the buffer the header was parsed from.
+func (ct *PContentType) IsUTF8(buf []byte) bool {
+	cs := ct.Charset.Get(buf)
+	return (len(cs) == 5 && bytescase.CmpEq(cs, []byte("utf-8"))) ||
+		(len(cs) == 4 && bytescase.CmpEq(cs, []byte("utf8")))
+}
+
+// ParseContentTypeVal parses a Content-Type header value,
+// starting at offs in buf and filling ct.
+// It returns a new offset pointing after the part that was parsed and
+// an error.
+// It can return ErrHdrMoreBytes if more data is needed (the value is not
+// fully contained in buf). In this case it should be called again
+// with the same ct and the returned offset, after more bytes were added.
+func ParseContentTypeVal(buf []byte, offs int,
+	ct *PContentType) (int, ErrorHdr) {
+	// parsing token flags: single type/subtype token, with parameters
+	const flags = PTokAllowSlashF | PTokAllowParamsF
+
+	next, err := ParseTokenLst(buf, offs, &ct.tok, flags)
+	switch err {
+	case 0:
+		// do nothing
+	case ErrHdrMoreBytes:
+		return next, err
+	case ErrHdrMoreValues:
+		// should never happen (no list separators allowed)
+		return next, ErrHdrBadChar
+	default:
+		return next, err
+	}
+	if ct.tok.SepOffs == 0 || ct.tok.Suffix().Empty() ||
+		ct.tok.Name().Empty() {
+		// no '/' or empty type or subtype
+		return int(ct.tok.V.Offs), ErrHdrValBad
+	}
+	ct.Val = ct.tok.V
+	if !ct.tok.Params.Empty() {
+		ct.Val.Extend(ct.tok.Params.EndOffs())
+		if perr := ct.parseParams(buf); perr != 0 {
+			return int(ct.tok.Params.Offs), perr
+		}
+	}
+	ct.Type = ct.tok.Name()
+	ct.SubType = ct.tok.Suffix()
+	ct.MType = ct.tok.V
+	return next, 0
+}
+
+// parseParams parses the already found Content-Type parameters,
+// filling the known values.
+func (ct *PContentType) parseParams(buf []byte) ErrorHdr {
+	var param PTokParam
+	o := int(ct.tok.Params.Offs)
+	pbuf := buf[:ct.tok.Params.EndOffs()]
+	for o < len(pbuf) {
+		param.Reset()
+		n, err := ParseTokenParam(pbuf, o, &param, PTokInputEndF)
+		switch err {
+		case ErrHdrOk, ErrHdrMoreValues, ErrHdrEOH:
+		case ErrHdrEmpty:
+			return 0
+		default:
+			return err
+		}
+		if !param.All.Empty() {
+			pn := param.Name.Get(buf)
+			switch {
+			case len(pn) == 7 && bytescase.CmpEq(pn, []byte("charset")):
+				ct.Charset, _ = unquotePField(buf, param.Val)
+			case len(pn) == 8 && bytescase.CmpEq(pn, []byte("boundary")):
+				ct.Boundary, _ = unquotePField(buf, param.Val)
+			}
+		}
+		if err != ErrHdrMoreValues {
+			break
+		}
+		o = n
+	}
+	return 0
+}
@@ -0,0 +1,185 @@
+// Copyright 2021 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+// month names, as used in HTTP-dates (case sensitive)
+var dateMonths = [...]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun",
+	"Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+
+// short day names, as used in IMF-fixdate and asctime dates
+var dateDays = [...]string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+
+// long day names, as used in rfc850 dates
+var dateDaysL = [...]string{"Monday", "Tuesday", "Wednesday", "Thursday",
+	"Friday", "Saturday", "Sunday"}
+
+// ParseHTTPDate parses a HTTP-date (rfc7231 7.1.1.1) in any of the 3
+// allowed formats:
+//
+//	IMF-fixdate: Sun, 06 Nov 1994 08:49:37 GMT
+//	rfc850:      Sunday, 06-Nov-94 08:49:37 GMT
+//	asctime:     Sun Nov  6 08:49:37 1994
+//
+// The whole b must contain only the date (no leading or trailing white
+// space).
+// It returns the date as seconds since the Unix epoch (UTC) and true on
+// success or 0 and false if b is not a valid HTTP-date.
+// For the rfc850 2 digits year, values < 70 are interpreted as 20xx.
+func ParseHTTPDate(b []byte) (int64, bool) {
+	var year, mon, day, hms int
+	var ok bool
+
+	switch {
+	case len(b) == 29 && b[3] == ',': // IMF-fixdate
+		if !dateIsName(b[:3], dateDays[:]) || b[4] != ' ' || b[7] != ' ' ||
+			b[11] != ' ' || b[16] != ' ' || string(b[25:]) != " GMT" {
+			return 0, false
+		}
+		if day, ok = date2Digits(b[5:]); !ok {
+			return 0, false
+		}
+		if mon, ok = dateMonth(b[8:11]); !ok {
+			return 0, false
+		}
+		if year, ok = date4Digits(b[12:]); !ok {
+			return 0, false
+		}
+		if hms, ok = dateTime(b[17:25]); !ok {
+			return 0, false
+		}
+	case len(b) == 24 && b[3] == ' ': // asctime
+		if !dateIsName(b[:3], dateDays[:]) || b[7] != ' ' ||
+			b[10] != ' ' || b[19] != ' ' {
+			return 0, false
+		}
+		if mon, ok = dateMonth(b[4:7]); !ok {
+			return 0, false
+		}
+		if b[8] == ' ' { // 1 digit day, padded with SP
+			if b[9] < '1' || b[9] > '9' {
+				return 0, false
+			}
+			day = int(b[9] - '0')
+		} else if day, ok = date2Digits(b[8:]); !ok {
+			return 0, false
+		}
+		if hms, ok = dateTime(b[11:19]); !ok {
+			return 0, false
+		}
+		if year, ok = date4Digits(b[20:]); !ok {
+			return 0, false
+		}
+	default: // rfc850 (variable length day name)
+		i := 0
+		for i < len(b) && b[i] != ',' {
+			i++
+		}
+		if len(b) != i+24 || !dateIsName(b[:i], dateDaysL[:]) ||
+			b[i+1] != ' ' || b[i+4] != '-' || b[i+8] != '-' ||
+			b[i+11] != ' ' || string(b[i+20:]) != " GMT" {
+			return 0, false
+		}
+		if day, ok = date2Digits(b[i+2:]); !ok {
+			return 0, false
+		}
+		if mon, ok = dateMonth(b[i+5 : i+8]); !ok {
+			return 0, false
+		}
+		if year, ok = date2Digits(b[i+9:]); !ok {
+			return 0, false
+		}
+		if year < 70 {
+			year += 2000
+		} else {
+			year += 1900
+		}
+		if hms, ok = dateTime(b[i+12 : i+20]); !ok {
+			return 0, false
+		}
+	}
+	if day < 1 || day > dateMonthDays(year, mon) {
+		return 0, false
+	}
+	return dateDaysFromCivil(year, mon, day)*86400 + int64(hms), true
+}
+
+// dateIsName returns true if n is one of the names in lst.
+func dateIsName(n []byte, lst []string) bool {
+	for _, s := range lst {
+		if string(n) == s {
+			return true
+		}
+	}
+	return false
+}
+
+// dateMonth returns the month number (1-12) for a 3 letters month name.
+func dateMonth(n []byte) (int, bool) {
+	for i, s := range dateMonths {
+		if string(n) == s {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+// date2Digits converts the first 2 digits in b to int.
+func date2Digits(b []byte) (int, bool) {
+	if len(b) < 2 || b[0] < '0' || b[0] > '9' || b[1] < '0' || b[1] > '9' {
+		return 0, false
+	}
+	return int(b[0]-'0')*10 + int(b[1]-'0'), true
+}
+
+// date4Digits converts the first 4 digits in b to int.
+func date4Digits(b []byte) (int, bool) {
+	h, ok1 := date2Digits(b)
+	l, ok2 := date2Digits(b[2:])
+	return h*100 + l, ok1 && ok2
+}
+
+// dateTime converts a "hh:mm:ss" time to seconds since midnight.
+func dateTime(b []byte) (int, bool) {
+	if len(b) != 8 || b[2] != ':' || b[5] != ':' {
+		return 0, false
+	}
+	h, ok1 := date2Digits(b)
+	m, ok2 := date2Digits(b[3:])
+	s, ok3 := date2Digits(b[6:])
+	if !ok1 || !ok2 || !ok3 || h > 23 || m > 59 || s > 60 {
+		return 0, false
+	}
+	return h*3600 + m*60 + s, true
+}
+
+// dateMonthDays returns the number of days in the month m (1-12) of year y.
+func dateMonthDays(y, m int) int {
+	switch m {
+	case 2:
+		if (y%4 == 0 && y%100 != 0) || y%400 == 0 {
+			return 29
+		}
+		return 28
+	case 4, 6, 9, 11:
+		return 30
+	}
+	return 31
+}
+
+// dateDaysFromCivil returns the number of days since 1970-01-01 for the
+// given (proleptic Gregorian) date.
+func dateDaysFromCivil(y, m, d int) int64 {
+	if m <= 2 {
+		y--
+	}
+	era := y / 400 // y >= 0 for HTTP-dates
+	yoe := y - era*400
+	mp := (m + 9) % 12 // March based month
+	doy := (153*mp+2)/5 + d - 1
+	doe := yoe*365 + yoe/4 - yoe/100 + doy
+	return int64(era)*146097 + int64(doe) - 719468
+}
@@ -33,7 +33,17 @@ const (
 	ErrHdrNoCLen // no Content-Length header and Content-Length required
 	ErrHdrBug
 	ErrHdrTooManyVals
-	ErrConvBug // always last
+	ErrHdrBadTrEnc       // invalid or ambiguous Transfer-Encoding
+	ErrHdrTooBig         // input too big (offsets > OffsT) or header name too long
+	ErrHdrMissingHost    // no Host header in a HTTP/1.1 request
+	ErrHdrMultiHost      // more than one Host header in a request
+	ErrHdrBadFraming     // message body length cannot be reliably determined
+	ErrHdrUnexpectedBody // body present on a request method without body
+	ErrHdrStopped        // parsing stopped on request (e.g. by a callback)
+	ErrHdrTooManyChunks  // chunked body with too many chunks
+	ErrHdrMultiCLen      // Content-Length list with different values
+	ErrHdrMissingCRange  // no Content-Range in a multipart/byteranges part
+	ErrConvBug           // always last
 )
 
 // error values corresp. to each ErrorHdr value: this way the interface
@@ -57,28 +67,48 @@ var err2ErrorVal = [...]error{
 	ErrHdrNoCLen,
 	ErrHdrBug,
 	ErrHdrTooManyVals,
+	ErrHdrBadTrEnc,
+	ErrHdrTooBig,
+	ErrHdrMissingHost,
+	ErrHdrMultiHost,
+	ErrHdrBadFraming,
+	ErrHdrUnexpectedBody,
+	ErrHdrStopped,
+	ErrHdrTooManyChunks,
+	ErrHdrMultiCLen,
+	ErrHdrMissingCRange,
 	ErrConvBug,
 }
 
 var errHdrStr = [...]string{
-	ErrHdrOk:           "no error",
-	ErrHdrEmpty:        "empty header",
-	ErrHdrEOH:          "end of header",
-	ErrHdrMoreBytes:    "more bytes needed",
-	ErrHdrMoreValues:   "more header values present",
-	ErrHdrNoCR:         "CR expected",
-	ErrHdrBadChar:      "invalid character in header",
-	ErrHdrParams:       "error parsing header parameter",
-	ErrHdrBad:          "bad header",
-	ErrHdrValNotNumber: "header value is not a number",
-	ErrHdrValTooLong:   "header value is too long",
-	ErrHdrValBad:       "bad header value",
-	ErrHdrNumTooBig:    "numeric header value too big",
-	ErrHdrTrunc:        "incomplete/truncated data",
-	ErrHdrNoCLen:       "no Content-Length header in message",
-	ErrHdrBug:          "internal BUG while parsing header",
-	ErrHdrTooManyVals:  "too many values for the header",
-	ErrConvBug:         "error conversion BUG",
+	ErrHdrOk:             "no error",
+	ErrHdrEmpty:          "empty header",
+	ErrHdrEOH:            "end of header",
+	ErrHdrMoreBytes:      "more bytes needed",
+	ErrHdrMoreValues:     "more header values present",
+	ErrHdrNoCR:           "CR expected",
+	ErrHdrBadChar:        "invalid character in header",
+	ErrHdrParams:         "error parsing header parameter",
+	ErrHdrBad:            "bad header",
+	ErrHdrValNotNumber:   "header value is not a number",
+	ErrHdrValTooLong:     "header value is too long",
+	ErrHdrValBad:         "bad header value",
+	ErrHdrNumTooBig:      "numeric header value too big",
+	ErrHdrTrunc:          "incomplete/truncated data",
+	ErrHdrNoCLen:         "no Content-Length header in message",
+	ErrHdrBug:            "internal BUG while parsing header",
+	ErrHdrTooManyVals:    "too many values for the header",
+	ErrHdrBadTrEnc:       "invalid Transfer-Encoding",
+	ErrHdrTooBig:         "input too big",
+	ErrHdrMissingHost:    "missing Host header",
+	ErrHdrMultiHost:      "multiple Host headers",
+	ErrHdrBadFraming:     "invalid message framing",
+	ErrHdrUnexpectedBody: "unexpected message body",
+	ErrHdrStopped:        "parsing stopped",
+	ErrHdrTooManyChunks:  "too many body chunks",
+	ErrHdrMultiCLen:      "different Content-Length values",
+	ErrHdrMissingCRange:  "missing Content-Range header",
+	ErrConvBug:           "error conversion BUG",
 }
 
 func (e ErrorHdr) Error() string {
@@ -0,0 +1,121 @@
+// Copyright 2021 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+import (
+	"github.com/intuitivelabs/bytescase"
+)
+
+// PExpectCT contains a parsed Expect-CT header value (rfc9163 2.1):
+//
+//	Expect-CT = expect-ct-directive *( OWS "," OWS expect-ct-directive )
+//	expect-ct-directive = directive-name [ "=" directive-value ]
+//
+// The known directives are max-age, report-uri and enforce. Unknown
+// directives are ignored (only counted in Unknown).
+type PExpectCT struct {
+	Val       PField // trimmed value
+	MaxAge    int64  // max-age value in seconds (valid if HasMaxAge)
+	HasMaxAge bool   // max-age directive present
+	Enforce   bool   // enforce directive present
+	ReportURI PField // report-uri value, without the quotes
+	Unknown   int    // number of unknown directives
+	hValState
+}
+
+// Reset re-initializes the parsed value and internal parsing state.
+func (e *PExpectCT) Reset() {
+	*e = PExpectCT{}
+}
+
+// Empty returns true if nothing was parsed yet.
+func (e *PExpectCT) Empty() bool {
+	return e.state == hvInit && e.Val.Empty()
+}
+
+// Parsed returns true if the value is fully parsed.
+func (e *PExpectCT) Parsed() bool {
+	return !e.Val.Empty()
+}
+
+// ParseExpectCTVal parses an Expect-CT header value, starting at offs in
+// buf and filling e.
+// It returns a new offset pointing after the part that was parsed and
+// an error.
+// An invalid max-age value is rejected with ErrHdrValNotNumber (or
+// ErrHdrNumTooBig).
+// It can return ErrHdrMoreBytes if more data is needed (the value is not
+// fully contained in buf). In this case it should be called again
+// with the same e and the returned offset, after more bytes were added.
+func ParseExpectCTVal(buf []byte, offs int, e *PExpectCT) (int, ErrorHdr) {
+	next, end, err := findHdrValEnd(buf, offs, &e.hValState)
+	if err != 0 {
+		return next, err
+	}
+	var v PField
+	var derr ErrorHdr
+	v.Set(e.vstart, end)
+	err = ParseDirectiveList(buf, v, ',', func(name, val PField) bool {
+		if derr = e.setDirective(buf, name, val); derr != 0 {
+			next = int(val.Offs)
+			return false
+		}
+		return true
+	})
+	if err != 0 {
+		return e.vstart, err
+	}
+	if derr != 0 {
+		return next, derr
+	}
+	e.Val = v
+	return next, 0
+}
+
+// setDirective checks if the parsed directive is known and sets the
+// corresponding Expect-CT value.
+func (e *PExpectCT) setDirective(buf []byte, name, val PField) ErrorHdr {
+	n := name.Get(buf)
+	v, _ := unquotePField(buf, val)
+	switch {
+	case len(n) == 7 && bytescase.CmpEq(n, []byte("max-age")):
+		s, err := parseDeltaSeconds(v.Get(buf))
+		if err != 0 {
+			return err
+		}
+		e.MaxAge = s
+		e.HasMaxAge = true
+	case len(n) == 7 && bytescase.CmpEq(n, []byte("enforce")):
+		e.Enforce = true
+	case len(n) == 10 && bytescase.CmpEq(n, []byte("report-uri")):
+		e.ReportURI = v
+	default:
+		e.Unknown++
+	}
+	return 0
+}
+
+// parseDeltaSeconds converts a delta-seconds value (1*DIGIT) to int64.
+// It returns ErrHdrValNotNumber if v is empty or contains non-digits and
+// ErrHdrNumTooBig on overflow.
+func parseDeltaSeconds(v []byte) (int64, ErrorHdr) {
+	const max = int64(^uint64(0) >> 1)
+	var s int64
+	if len(v) == 0 {
+		return 0, ErrHdrValNotNumber
+	}
+	for _, c := range v {
+		if c < '0' || c > '9' {
+			return 0, ErrHdrValNotNumber
+		}
+		if s > (max-int64(c-'0'))/10 {
+			return 0, ErrHdrNumTooBig
+		}
+		s = s*10 + int64(c-'0')
+	}
+	return s, 0
+}
@@ -19,6 +19,10 @@ type PFLine struct {
 	Version      PField // http version (e..g HTTP/1.0), common
 	StatusCode   PField // reply status as string (empty for requests)
 	Reason       PField // reply reason
+	VerMajor     uint8  // numeric major version (e.g. 1 for HTTP/1.0)
+	VerMinor     uint8  // numeric minor version (0 if missing or invalid)
+	HTTP09       bool   // HTTP/0.9 simple request or response (no version)
+	absHost      PField // absolute-form target host (see AbsoluteTargetHost)
 	PFLineIState        // internal parsing state
 }
 
@@ -49,6 +53,98 @@ func (fl *PFLine) Pending() bool {
 	return fl.state != flFIN && fl.state != flInit
 }
 
+// TargetFormT is the type for the request target forms (rfc7230 5.3).
+type TargetFormT uint8
+
+// Request target forms.
+const (
+	TargetUnknown   TargetFormT = iota // not a request or invalid target
+	TargetOrigin                       // absolute-path [ "?" query ]
+	TargetAbsolute                     // absolute-URI (e.g. to proxies)
+	TargetAuthority                    // authority (CONNECT only)
+	TargetAsterisk                     // "*" (OPTIONS only)
+)
+
+// TargetForm returns the form of the request target (URI) or
+// TargetUnknown if the first line is not a request line or if the target
+// does not match any known form.
+// Note that targets containing a fragment (see URIHasFragment()) are
+// still reported as one of the known forms.
+func (fl *PFLine) TargetForm(buf []byte) TargetFormT {
+	if !fl.Request() || fl.URI.Empty() {
+		return TargetUnknown
+	}
+	u := fl.URI.Get(buf)
+	switch {
+	case len(u) == 1 && u[0] == '*':
+		return TargetAsterisk
+	case u[0] == '/':
+		return TargetOrigin
+	case fl.MethodNo == MConnect:
+		return TargetAuthority
+	}
+	if uriSchemeEnd(u) > 0 {
+		return TargetAbsolute
+	}
+	return TargetUnknown
+}
+
+// AbsoluteTargetHost returns the authority part (host [":" port], without
+// any userinfo) of an absolute-form request target
+// (e.g. "foo.bar:8080" for "http://user@foo.bar:8080/x"), or an empty
+// PField if the request target is not in absolute-form or has no
+// authority.
+func (fl *PFLine) AbsoluteTargetHost() PField {
+	return fl.absHost
+}
+
+// uriSchemeEnd returns the offset of the ':' ending the scheme in an
+// absolute-URI (scheme ":" hier-part) or -1, where
+//  scheme = ALPHA *( ALPHA / DIGIT / "+" / "-" / "." ).
+func uriSchemeEnd(u []byte) int {
+	for i, c := range u {
+		switch {
+		case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		case i > 0 && ((c >= '0' && c <= '9') || c == '+' || c == '-' ||
+			c == '.'):
+		case i > 0 && c == ':':
+			return i
+		default:
+			return -1
+		}
+	}
+	return -1
+}
+
+// absTargetHost returns the authority part, without userinfo, of the
+// absolute-form request target u (scheme "://" authority ...) or an empty
+// PField.
+func absTargetHost(buf []byte, u PField) PField {
+	var h PField
+	v := u.Get(buf)
+	s := uriSchemeEnd(v)
+	if s <= 0 || len(v) < s+3 || v[s+1] != '/' || v[s+2] != '/' {
+		return h
+	}
+	start := s + 3
+	end := start
+	for ; end < len(v); end++ {
+		if c := v[end]; c == '/' || c == '?' || c == '#' {
+			break
+		} else if c == '@' {
+			start = end + 1 // skip over userinfo
+		}
+	}
+	h.Set(int(u.Offs)+start, int(u.Offs)+end)
+	return h
+}
+
+// URIHasFragment returns true if the request target (URI) contains
+// a fragment ('#'), which is not allowed in a request line (rfc7230 5.1).
+func (fl *PFLine) URIHasFragment(buf []byte) bool {
+	return fragOffs(buf, fl.URI) >= 0
+}
+
 // PFLineIState contains internal parsing state associated to a PFLine.
 type PFLineIState struct {
 	state uint8 // internal parser state
@@ -79,20 +175,87 @@ var httpVerSP = []byte("HTTP/1.0 ") // http version including space
 // buf[offs:] ErrHdrMoreBytes will be returned and this function can be called
 // again when more bytes are available, with the same buffer, the returned
 // offset ("continue point") and the same PFLine structure.
+// It is equivalent to ParseFLineFlags(buf, offs, pl, 0).
 func ParseFLine(buf []byte, offs int, pl *PFLine) (int, ErrorHdr) {
+	return ParseFLineFlags(buf, offs, pl, 0)
+}
+
+// ParseFLineFlags is similar to ParseFLine(), but it allows passing
+// parsing flags. The flags are a subset of the ParseMsg() flags:
+//  MsgStrictF - reject control characters in the reply reason phrase,
+//               status codes outside the 100-599 range, request
+//               targets containing a fragment ('#') and unknown or
+//               malformed versions (only HTTP/0.9, HTTP/1.x, HTTP/2[.x]
+//               and HTTP/3[.x] are accepted).
+//  MsgLenientF - skip over empty lines (CRLF) before the first line and
+//               accept non-conformant reply status codes with 1 to 5
+//               digits instead of 3 (ErrHdrNumTooBig if > 65535).
+//  MsgAllowHTTP09F - accept HTTP/0.9 simple request lines (method SP uri,
+//               without a version), see PFLine.HTTP09.
+//  MsgTrimReasonF - remove leading and trailing whitespace (SP and HTAB)
+//               from the reply reason phrase (PFLine.Reason).
+// For more information see ParseFLine().
+func ParseFLineFlags(buf []byte, offs int, pl *PFLine, flags MsgFlags) (int, ErrorHdr) {
+	return parseFLine(buf, offs, pl, flags, flAuto)
+}
+
+// ParseRequestLine is similar to ParseFLineFlags(), but it parses only
+// request lines (no auto-detection, the line is always interpreted as a
+// request line, even if the method starts like a HTTP version).
+// It returns ErrHdrBadChar if the line is not a valid request line.
+func ParseRequestLine(buf []byte, offs int, pl *PFLine, flags MsgFlags) (int, ErrorHdr) {
+	return parseFLine(buf, offs, pl, flags, flRequest)
+}
+
+// ParseStatusLine is similar to ParseFLineFlags(), but it parses only
+// status lines (replies).
+// It returns ErrHdrBadChar if the line is not a valid status line.
+func ParseStatusLine(buf []byte, offs int, pl *PFLine, flags MsgFlags) (int, ErrorHdr) {
+	return parseFLine(buf, offs, pl, flags, flReply)
+}
+
+// first line types for parseFLine()
+const (
+	flAuto    uint8 = iota // auto-detect request or reply
+	flRequest              // request line only
+	flReply                // status line only
+)
+
+// parseFLine parses a first line, of the type specified by role
+// (flAuto, flRequest or flReply).
+func parseFLine(buf []byte, offs int, pl *PFLine, flags MsgFlags,
+	role uint8) (int, ErrorHdr) {
 
 	// grammar:
 	//	request: method SP   uri   SP version CRLF
 	//	reply:   version SP status SP reason  CRLF
 	// where SP == single space
+	if len(buf) > MaxBufSize {
+		return offs, ErrHdrTooBig
+	}
 	i := offs
 	switch pl.state {
 	case flInit:
+		if (flags & MsgLenientF) != 0 {
+			// ignore empty lines before the first line (rfc7230 3.5)
+			var err ErrorHdr
+			if i, err = skipEmptyLines(buf, i); err != 0 {
+				return i, err
+			}
+		}
 		if (len(buf) - i) < (len(httpVerSP) + 3 /*SP+CRLF*/ + 3 /* status */) {
-			// message too small
-			goto moreBytes
+			// message too small, but HTTP/0.9 requests can be shorter
+			// than a status line (e.g. "GET /\r\n")
+			if (flags&MsgAllowHTTP09F) == 0 || role == flReply ||
+				(role == flAuto && httpVerPrefPart(buf[i:])) {
+				goto moreBytes
+			}
 		}
-		if l, match := bytescase.Prefix(httpVerPref, buf[i:]); match {
+		l, match := bytescase.Prefix(httpVerPref, buf[i:])
+		if role == flReply && !match {
+			return i + l, ErrHdrBadChar
+		}
+		if match && role != flRequest {
 			// matched HTTP/   => likley is a reply, parse version numbers
 			// (l points _after_ '/')
 			var majorV, minorV PField
@@ -124,33 +287,66 @@ func ParseFLine(buf []byte, offs int, pl *PFLine) (int, ErrorHdr) {
 					break verloop
 				case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
 					// do nothing
-					// TODO: parse a numeric version ?
 				default:
 					// non numeric => error
 					return l, ErrHdrBadChar
 				}
 			}
-			// TODO: save majorV & minorV ?
 			// l points to the space after version here
-			pl.Version.Set(i, l)
-			pl.state = flRplStatus
-			if (l + 1) >= len(buf) {
-				// end of buf
+			if (l + 5) > len(buf) {
+				// end of buf before the version end or before
+				// the status + SP => restart from the line start
 				goto moreBytes
 			}
+			pl.Version.Set(i, l)
+			pl.VerMajor = verNo(majorV.Get(buf))
+			pl.VerMinor = verNo(minorV.Get(buf))
+			if (flags&MsgStrictF) != 0 && !validVersion(pl.Version.Get(buf)) {
+				return i, ErrHdrBadChar
+			}
 			i = l + 1
-			if buf[i+3] != ' ' ||
-				!((buf[i] >= '0' && buf[i] <= '9') &&
-					(buf[i+1] >= '0' && buf[i+1] <= '9') &&
-					(buf[i+2] >= '0' && buf[i+2] <= '9')) {
-				// non numerical, too big or too small status
+			if (flags & MsgLenientF) != 0 {
+				// non-conformant status codes: accept 1 to 5 digits
+				e := i
+				st := uint32(0)
+				for ; e < len(buf) && buf[e] >= '0' && buf[e] <= '9'; e++ {
+					if e-i >= 5 {
+						return i, ErrHdrNumTooBig
+					}
+					st = st*10 + uint32(buf[e]-'0')
+				}
+				if e >= len(buf) {
+					// restart from the line start
+					i = int(pl.Version.Offs)
+					goto moreBytes
+				}
+				if e == i || buf[e] != ' ' {
+					return i, ErrHdrBadChar
+				}
+				if st > uint32(^uint16(0)) {
+					return i, ErrHdrNumTooBig
+				}
+				pl.StatusCode.Set(i, e)
+				pl.Status = uint16(st)
+			} else {
+				if buf[i+3] != ' ' ||
+					!((buf[i] >= '0' && buf[i] <= '9') &&
+						(buf[i+1] >= '0' && buf[i+1] <= '9') &&
+						(buf[i+2] >= '0' && buf[i+2] <= '9')) {
+					// non numerical, too big or too small status
+					return i, ErrHdrBadChar
+				}
+				pl.StatusCode.Set(i, i+3)
+				pl.Status =
+					uint16(buf[i]-'0')*100 + uint16(buf[i+1]-'0')*10 +
+						uint16(buf[i+2]-'0')
+			}
+			if (flags&MsgStrictF) != 0 &&
+				(pl.Status < 100 || pl.Status > 599) {
+				// status code out of the 1xx-5xx range (rfc7231 6)
 				return i, ErrHdrBadChar
 			}
-			pl.StatusCode.Set(i, i+3)
-			pl.Status =
-				uint16(buf[i]-'0')*100 + uint16(buf[i+1]-'0')*10 +
-					uint16(buf[i+2]-'0')
-			i += 4 // skip over status + space
+			i = pl.StatusCode.EndOffs() + 1 // skip over status + space
 			pl.Reason.Set(i, i)
 			pl.state = flRplReason
 			var crl int
@@ -158,7 +354,7 @@ func ParseFLine(buf []byte, offs int, pl *PFLine) (int, ErrorHdr) {
 				return i, err // could be moreBytes
 			}
 			pl.Reason.Extend(i - crl)
-			goto endOk
+			goto endReason
 		}
 		// request => skip over the 1st token
 		pl.state = flReqMethod
@@ -176,6 +372,10 @@ func ParseFLine(buf []byte, offs int, pl *PFLine) (int, ErrorHdr) {
 		if pl.Method.Empty() {
 			goto errEmptyTok
 		}
+		if e := badTCharOffs(buf, pl.Method); e >= 0 {
+			// method = token (rfc7230 3.1.1)
+			return e, ErrHdrBadChar
+		}
 		pl.MethodNo = GetMethodNo(pl.Method.Get(buf))
 		i++
 		pl.state = flReqURI
@@ -186,6 +386,27 @@ func ParseFLine(buf []byte, offs int, pl *PFLine) (int, ErrorHdr) {
 		if i >= len(buf) {
 			goto moreBytes
 		}
+		if (flags&MsgAllowHTTP09F) != 0 && (buf[i] == '\r' || buf[i] == '\n') {
+			// HTTP/0.9 simple request: method SP uri CRLF
+			pl.URI.Extend(i)
+			if pl.URI.Empty() {
+				goto errEmptyTok
+			}
+			if e := fragOffs(buf, pl.URI); e >= 0 && (flags&MsgStrictF) != 0 {
+				// no fragment allowed in the request target
+				return e, ErrHdrBadChar
+			}
+			pl.absHost = absTargetHost(buf, pl.URI)
+			pl.HTTP09 = true
+			pl.VerMajor, pl.VerMinor = 0, 9
+			pl.state = flCRLF
+			end, _, err := skipCRLF(buf, i)
+			if err != 0 {
+				return end, err // could be moreBytes
+			}
+			i = end
+			goto endOk
+		}
 		if buf[i] != ' ' { // '\t' , CR or LF => error
 			return i, ErrHdrBadChar
 		}
@@ -193,6 +414,11 @@ func ParseFLine(buf []byte, offs int, pl *PFLine) (int, ErrorHdr) {
 		if pl.URI.Empty() {
 			goto errEmptyTok
 		}
+		if e := fragOffs(buf, pl.URI); e >= 0 && (flags&MsgStrictF) != 0 {
+			// no fragment allowed in the request target (rfc7230 5.1)
+			return e, ErrHdrBadChar
+		}
+		pl.absHost = absTargetHost(buf, pl.URI)
 		i++
 		pl.state = flReqVer
 		pl.Version.Set(i, i)
@@ -209,6 +435,10 @@ func ParseFLine(buf []byte, offs int, pl *PFLine) (int, ErrorHdr) {
 		if pl.Version.Empty() {
 			goto errEmptyTok
 		}
+		pl.VerMajor, pl.VerMinor = parseVerNo(pl.Version.Get(buf))
+		if (flags&MsgStrictF) != 0 && !validVersion(pl.Version.Get(buf)) {
+			return int(pl.Version.Offs), ErrHdrBadChar
+		}
 		pl.state = flCRLF
 		fallthrough
 	case flCRLF:
@@ -227,6 +457,15 @@ func ParseFLine(buf []byte, offs int, pl *PFLine) (int, ErrorHdr) {
 		}
 		pl.Reason.Extend(i - crl)
 	}
+endReason:
+	if flags&MsgTrimReasonF != 0 {
+		pl.Reason = trimWS(buf, pl.Reason)
+	}
+	if flags&MsgStrictF != 0 {
+		if e := badReasonChar(buf, pl.Reason); e >= 0 {
+			return e, ErrHdrBadChar
+		}
+	}
 endOk:
 	pl.state = flFIN
 	return i, 0
@@ -235,3 +474,119 @@ moreBytes:
 errEmptyTok:
 	return i, ErrHdrBadChar
 }
+
+// verNo converts a version number string to an integer (saturating at 255).
+// It returns 0 for empty or non-numeric strings.
+func verNo(n []byte) uint8 {
+	var v uint
+	for _, c := range n {
+		if c < '0' || c > '9' {
+			return 0
+		}
+		if v < 255 {
+			v = v*10 + uint(c-'0')
+		}
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
+
+// parseVerNo returns the numeric major and minor version from a version
+// string of the form HTTP/major[.minor] (0, 0 if invalid).
+func parseVerNo(v []byte) (uint8, uint8) {
+	if len(v) <= len(httpVerPref) ||
+		!bytescase.CmpEq(v[:len(httpVerPref)], httpVerPref) {
+		return 0, 0
+	}
+	v = v[len(httpVerPref):]
+	for i, c := range v {
+		if c == '.' {
+			return verNo(v[:i]), verNo(v[i+1:])
+		}
+	}
+	return verNo(v), 0
+}
+
+// validVersion returns true if v is a known HTTP version:
+// HTTP/0.9, HTTP/1.x (a single digit minor version, rfc7230 2.6),
+// HTTP/2 or HTTP/3 (with an optional single digit minor version).
+// The "HTTP" prefix is compared case insensitive.
+func validVersion(v []byte) bool {
+	if len(v) <= len(httpVerPref) ||
+		!bytescase.CmpEq(v[:len(httpVerPref)], httpVerPref) {
+		return false
+	}
+	v = v[len(httpVerPref):]
+	switch {
+	case len(v) == 1:
+		return v[0] == '2' || v[0] == '3'
+	case len(v) == 3 && v[1] == '.' && v[2] >= '0' && v[2] <= '9':
+		return v[0] == '1' || v[0] == '2' || v[0] == '3' ||
+			(v[0] == '0' && v[2] == '9')
+	}
+	return false
+}
+
+// PeekKind checks if buf[offs:] starts with a request or a response,
+// looking only at the "HTTP/" prefix (a response status line starts with
+// it, a request line cannot). It does not validate the first line (use
+// ParseFLine() for that).
+// It returns ok=false if there are not enough bytes to decide
+// (buf[offs:] is a possibly incomplete "HTTP/" prefix).
+// Note that empty lines before the message are not skipped.
+func PeekKind(buf []byte, offs int) (isRequest bool, ok bool) {
+	if offs >= len(buf) {
+		return false, false
+	}
+	if len(buf)-offs < len(httpVerPref) && httpVerPrefPart(buf[offs:]) {
+		return false, false
+	}
+	return !httpVerPrefPart(buf[offs:]), true
+}
+
+// httpVerPrefPart returns true if buf starts with httpVerPref or with
+// a part of it (case insensitive), e.g. "HT" or "".
+func httpVerPrefPart(buf []byte) bool {
+	n := len(buf)
+	if n > len(httpVerPref) {
+		n = len(httpVerPref)
+	}
+	return bytescase.CmpEq(buf[:n], httpVerPref[:n])
+}
+
+// fragOffs returns the offset in buf of the fragment start ('#') inside
+// the uri field u or -1 if there is no fragment.
+func fragOffs(buf []byte, u PField) int {
+	for i := int(u.Offs); i < u.EndOffs(); i++ {
+		if buf[i] == '#' {
+			return i
+		}
+	}
+	return -1
+}
+
+// trimWS returns f (inside buf) without the leading and trailing
+// whitespace (SP and HTAB).
+func trimWS(buf []byte, f PField) PField {
+	s, e := int(f.Offs), f.EndOffs()
+	for ; s < e && (buf[s] == ' ' || buf[s] == '\t'); s++ {
+	}
+	for ; e > s && (buf[e-1] == ' ' || buf[e-1] == '\t'); e-- {
+	}
+	f.Set(s, e)
+	return f
+}
+
+// badReasonChar returns the offset in buf of the first invalid character
+// in the reason phrase r or -1 if the reason phrase is valid.
+// reason-phrase = *( HTAB / SP / VCHAR / obs-text ), see rfc7230 3.1.2.
+func badReasonChar(buf []byte, r PField) int {
+	for i := int(r.Offs); i < r.EndOffs(); i++ {
+		if (buf[i] < 0x20 && buf[i] != '\t') || buf[i] == 0x7f {
+			return i
+		}
+	}
+	return -1
+}
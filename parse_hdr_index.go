@@ -0,0 +1,233 @@
+// Copyright 2022 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+import (
+	"encoding/binary"
+)
+
+// HdrIndexVersion is the version of the format used by
+// HdrLst.MarshalIndex() (the first byte of the serialized index).
+const HdrIndexVersion = 1
+
+// MarshalIndex serializes the parsed headers index: the header types,
+// the offsets of the header names, values and lines (and not the header
+// bytes), PFlags, DupFlags, N, Skipped and EndHdrsOffs.
+// The result can be used later to re-create the HdrLst, without parsing
+// the headers again, with UnmarshalIndex() (e.g. for caching). It is
+// valid only for the buffer the headers were parsed from (same
+// offsets).
+// The configuration (HdrFilter and MaxNameLen) is not included.
+// It should be called only after the headers are fully parsed.
+//
+// The format is: the version byte (HdrIndexVersion), followed by
+// varints, with the offsets stored as differences from the previous
+// header end (so that most of them fit in 1 byte).
+func (hl *HdrLst) MarshalIndex() []byte {
+	n := hl.N
+	if n > len(hl.Hdrs) {
+		n = len(hl.Hdrs)
+	}
+	b := make([]byte, 0, 16+n*8)
+	b = append(b, HdrIndexVersion)
+	b = appendUvarint(b, uint64(hl.PFlags))
+	b = appendUvarint(b, uint64(hl.DupFlags))
+	b = appendUvarint(b, uint64(hl.N))
+	b = appendUvarint(b, uint64(hl.Skipped))
+	b = appendUvarint(b, uint64(hl.EndHdrsOffs))
+	b = appendUvarint(b, uint64(n))
+	var stored HdrFlags
+	prev := 0
+	for i := 0; i < n; i++ {
+		b = hl.Hdrs[i].appendIndex(b, prev)
+		prev = hl.Hdrs[i].Raw.EndOffs()
+		stored.Set(hl.Hdrs[i].Type)
+	}
+	// "shortcuts" for the types with all the headers dropped (not in Hdrs)
+	var extra HdrFlags
+	for t := HdrNone + 1; t < HdrOther; t++ {
+		if !stored.Test(t) && !hl.GetHdr(t).Missing() {
+			extra.Set(t)
+		}
+	}
+	b = appendUvarint(b, uint64(extra))
+	for t := HdrNone + 1; t < HdrOther; t++ {
+		if extra.Test(t) {
+			b = hl.GetHdr(t).appendIndex(b, 0)
+		}
+	}
+	return b
+}
+
+// UnmarshalIndex re-creates a HdrLst from an index serialized with
+// HdrLst.MarshalIndex(). The returned HdrLst uses a newly allocated Hdrs
+// slice and it should be used only with the buffer the original headers
+// were parsed from.
+// It returns ErrHdrBad for an unknown format version or invalid content
+// and ErrHdrTrunc for a truncated index.
+func UnmarshalIndex(b []byte) (HdrLst, error) {
+	var hl HdrLst
+	if len(b) == 0 {
+		return hl, ErrHdrTrunc
+	}
+	if b[0] != HdrIndexVersion {
+		return hl, ErrHdrBad
+	}
+	d := hdrIndexDec{b: b, i: 1}
+	hl.PFlags = HdrFlags(d.uvarint(uint64(^HdrFlags(0))))
+	hl.DupFlags = HdrFlags(d.uvarint(uint64(^HdrFlags(0))))
+	hl.N = int(d.uvarint(uint64(MaxBufSize)))
+	hl.Skipped = int(d.uvarint(uint64(MaxBufSize)))
+	hl.EndHdrsOffs = int(d.uvarint(uint64(MaxBufSize)))
+	n := int(d.uvarint(uint64(MaxBufSize)))
+	if d.err == 0 && n > hl.N {
+		d.err = ErrHdrBad
+	}
+	if d.err != 0 {
+		return HdrLst{}, d.err
+	}
+	hl.Hdrs = make([]Hdr, n)
+	prev := 0
+	for i := 0; i < n; i++ {
+		h := &hl.Hdrs[i]
+		if !d.hdr(h, prev) {
+			return HdrLst{}, d.err
+		}
+		prev = h.Raw.EndOffs()
+		hl.SetHdr(h)
+	}
+	extra := HdrFlags(d.uvarint(uint64(^HdrFlags(0))))
+	for t := HdrNone + 1; t < HdrOther && d.err == 0; t++ {
+		if extra.Test(t) {
+			var h Hdr
+			if d.hdr(&h, 0) && (h.Type != t || !hl.SetHdr(&h)) {
+				d.err = ErrHdrBad
+			}
+		}
+	}
+	if d.err == 0 && d.i != len(b) {
+		d.err = ErrHdrBad // trailing garbage
+	}
+	if d.err != 0 {
+		return HdrLst{}, d.err
+	}
+	return hl, nil
+}
+
+// appendIndex appends the serialized header index to b, with the offsets
+// relative to prev (see HdrLst.MarshalIndex()).
+func (h *Hdr) appendIndex(b []byte, prev int) []byte {
+	t := uint64(h.Type) << 1
+	if h.Folded {
+		t |= 1
+	}
+	b = appendUvarint(b, t)
+	b = appendVarint(b, int64(int(h.Name.Offs)-prev))
+	b = appendUvarint(b, uint64(h.Name.Len))
+	b = appendVarint(b, int64(int(h.Val.Offs)-h.Name.EndOffs()))
+	b = appendUvarint(b, uint64(h.Val.Len))
+	b = appendVarint(b, int64(int(h.Raw.Offs)-int(h.Name.Offs)))
+	b = appendUvarint(b, uint64(h.Raw.Len))
+	return b
+}
+
+// appendUvarint appends v to b, encoded as unsigned varint.
+func appendUvarint(b []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(b, tmp[:n]...)
+}
+
+// appendVarint appends v to b, encoded as signed (zig-zag) varint.
+func appendVarint(b []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], v)
+	return append(b, tmp[:n]...)
+}
+
+// hdrIndexDec holds the UnmarshalIndex() decoding state.
+// After the first error all the decoding functions return 0.
+type hdrIndexDec struct {
+	b   []byte
+	i   int
+	err ErrorHdr
+}
+
+// uvarint decodes the next unsigned varint, checking that it is <= max.
+func (d *hdrIndexDec) uvarint(max uint64) uint64 {
+	if d.err != 0 {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b[d.i:])
+	if n <= 0 {
+		d.err = d.varintErr(n)
+		return 0
+	}
+	d.i += n
+	if v > max {
+		d.err = ErrHdrBad
+		return 0
+	}
+	return v
+}
+
+// offs decodes the next offset, stored as a difference from base.
+func (d *hdrIndexDec) offs(base int) int {
+	if d.err != 0 {
+		return 0
+	}
+	v, n := binary.Varint(d.b[d.i:])
+	if n <= 0 {
+		d.err = d.varintErr(n)
+		return 0
+	}
+	d.i += n
+	o := int64(base) + v
+	if o < 0 || o > int64(MaxBufSize) {
+		d.err = ErrHdrBad
+		return 0
+	}
+	return int(o)
+}
+
+// varintErr returns the error corresponding to a failed varint decode
+// (n returned by binary.Uvarint() or binary.Varint()).
+func (d *hdrIndexDec) varintErr(n int) ErrorHdr {
+	if n == 0 {
+		return ErrHdrTrunc
+	}
+	return ErrHdrBad // overflow
+}
+
+// field decodes a PField starting at offset start.
+func (d *hdrIndexDec) field(f *PField, start int) {
+	l := int(d.uvarint(uint64(MaxBufSize)))
+	if d.err == 0 && start+l > MaxBufSize {
+		d.err = ErrHdrBad
+	}
+	if d.err == 0 {
+		f.Set(start, start+l)
+	}
+}
+
+// hdr decodes a header, with the offsets relative to prev, into h.
+// It returns false on error (see d.err).
+func (d *hdrIndexDec) hdr(h *Hdr, prev int) bool {
+	t := d.uvarint(uint64(HdrOther)<<1 | 1)
+	if d.err == 0 && HdrT(t>>1) == HdrNone {
+		d.err = ErrHdrBad
+	}
+	if d.err != 0 {
+		return false
+	}
+	h.Type = HdrT(t >> 1)
+	h.Folded = t&1 != 0
+	d.field(&h.Name, d.offs(prev))
+	d.field(&h.Val, d.offs(h.Name.EndOffs()))
+	d.field(&h.Raw, d.offs(int(h.Name.Offs)))
+	return d.err == 0
+}
@@ -14,7 +14,9 @@ import (
 type HdrT uint16
 
 // HdrFlags packs several header values into bit flags.
-type HdrFlags uint16
+// Each header type (up to and including HdrOther) uses one bit, so the
+// number of header types is limited by the HdrFlags size (64).
+type HdrFlags uint64
 
 // Reset initializes a HdrFlags.
 func (f *HdrFlags) Reset() {
@@ -73,44 +75,160 @@ const (
 	HdrWSockAccept
 	HdrWSockVer
 	HdrWSockExt
+	HdrContentDisposition
+	HdrContentType
+	HdrVary
+	HdrPragma
+	HdrWarning
+	HdrLink
+	HdrProxyAuthenticate
+	HdrProxyAuthorization
+	HdrACReqMethod
+	HdrACReqHeaders
+	HdrACAllowOrigin
+	HdrACAllowMethods
+	HdrACAllowHeaders
+	HdrContentLanguage
+	HdrIfRange
+	HdrExpectCT
+	HdrSTS
 	HdrOther // generic, not recognized header
 )
 
 // HdrFlags constants for each header type.
 const (
-	HdrCLenF        HdrFlags = 1 << HdrCLen
-	HdrTrEncodingF  HdrFlags = 1 << HdrTrEncoding
-	HdrUpgradeF     HdrFlags = 1 << HdrUpgrade
-	HdrCEncodingF   HdrFlags = 1 << HdrCEncoding
-	HdrHostF        HdrFlags = 1 << HdrHost
-	HdrServerF      HdrFlags = 1 << HdrServer
-	HdrOriginF      HdrFlags = 1 << HdrOrigin
-	HdrConnectionF  HdrFlags = 1 << HdrConnection
-	HdrWSockKeyF    HdrFlags = 1 << HdrWSockKey
-	HdrWSockProtoF  HdrFlags = 1 << HdrWSockProto
-	HdrWSockAcceptF HdrFlags = 1 << HdrWSockAccept
-	HdrWSockVerF    HdrFlags = 1 << HdrWSockVer
-	HdrWSockExtF    HdrFlags = 1 << HdrWSockExt
-	HdrOtherF       HdrFlags = 1 << HdrOther
+	HdrCLenF               HdrFlags = 1 << HdrCLen
+	HdrTrEncodingF         HdrFlags = 1 << HdrTrEncoding
+	HdrUpgradeF            HdrFlags = 1 << HdrUpgrade
+	HdrCEncodingF          HdrFlags = 1 << HdrCEncoding
+	HdrHostF               HdrFlags = 1 << HdrHost
+	HdrServerF             HdrFlags = 1 << HdrServer
+	HdrOriginF             HdrFlags = 1 << HdrOrigin
+	HdrConnectionF         HdrFlags = 1 << HdrConnection
+	HdrWSockKeyF           HdrFlags = 1 << HdrWSockKey
+	HdrWSockProtoF         HdrFlags = 1 << HdrWSockProto
+	HdrWSockAcceptF        HdrFlags = 1 << HdrWSockAccept
+	HdrWSockVerF           HdrFlags = 1 << HdrWSockVer
+	HdrWSockExtF           HdrFlags = 1 << HdrWSockExt
+	HdrContentDispositionF HdrFlags = 1 << HdrContentDisposition
+	HdrContentTypeF        HdrFlags = 1 << HdrContentType
+	HdrVaryF               HdrFlags = 1 << HdrVary
+	HdrPragmaF             HdrFlags = 1 << HdrPragma
+	HdrWarningF            HdrFlags = 1 << HdrWarning
+	HdrLinkF               HdrFlags = 1 << HdrLink
+	HdrProxyAuthenticateF  HdrFlags = 1 << HdrProxyAuthenticate
+	HdrProxyAuthorizationF HdrFlags = 1 << HdrProxyAuthorization
+	HdrACReqMethodF        HdrFlags = 1 << HdrACReqMethod
+	HdrACReqHeadersF       HdrFlags = 1 << HdrACReqHeaders
+	HdrACAllowOriginF      HdrFlags = 1 << HdrACAllowOrigin
+	HdrACAllowMethodsF     HdrFlags = 1 << HdrACAllowMethods
+	HdrACAllowHeadersF     HdrFlags = 1 << HdrACAllowHeaders
+	HdrContentLanguageF    HdrFlags = 1 << HdrContentLanguage
+	HdrIfRangeF            HdrFlags = 1 << HdrIfRange
+	HdrExpectCTF           HdrFlags = 1 << HdrExpectCT
+	HdrSTSF                HdrFlags = 1 << HdrSTS
+	HdrOtherF              HdrFlags = 1 << HdrOther
 )
 
+// compile-time check that all the header types fit in HdrFlags: adding
+// a header type that does not fit would make this constant overflow
+const _ HdrFlags = 1 << HdrOther
+
+// hdrValLaxF contains the header types whose values are parsed only for
+// information purposes: an invalid value is ignored and the header is
+// kept as a generic header (unparsed value), instead of making the whole
+// message invalid (as for the framing, protocol upgrade or message body
+// description headers).
+const hdrValLaxF = HdrConnectionF | HdrVaryF | HdrPragmaF | HdrWarningF |
+	HdrLinkF | HdrACReqMethodF | HdrACReqHeadersF | HdrACAllowOriginF |
+	HdrACAllowMethodsF | HdrACAllowHeadersF | HdrContentLanguageF |
+	HdrIfRangeF | HdrExpectCTF | HdrSTSF
+
+// HdrTrailerForbiddenF contains the flags for the known headers that
+// must not be used in a chunked body trailer: framing, routing,
+// authentication, request modifiers, response control data and
+// payload processing headers (rfc7230 4.1.2).
+const HdrTrailerForbiddenF = HdrCLenF | HdrTrEncodingF | HdrUpgradeF |
+	HdrCEncodingF | HdrHostF | HdrOriginF | HdrConnectionF | HdrWSockKeyF |
+	HdrWSockProtoF | HdrWSockAcceptF | HdrWSockVerF | HdrWSockExtF |
+	HdrContentDispositionF | HdrContentTypeF | HdrVaryF | HdrPragmaF |
+	HdrWarningF | HdrProxyAuthenticateF | HdrProxyAuthorizationF |
+	HdrACReqMethodF | HdrACReqHeadersF | HdrACAllowOriginF |
+	HdrACAllowMethodsF | HdrACAllowHeadersF | HdrIfRangeF
+
+// HdrSingletonF contains the flags for the known header types that are
+// not comma-separated lists (rfc7230 3.2.2) and so multiple headers of
+// the same type cannot be combined into one.
+const HdrSingletonF = HdrCLenF | HdrHostF | HdrServerF | HdrOriginF |
+	HdrWSockKeyF | HdrWSockAcceptF | HdrContentDispositionF |
+	HdrContentTypeF | HdrProxyAuthorizationF | HdrACReqMethodF |
+	HdrACAllowOriginF | HdrIfRangeF
+
+// Combinable returns true if multiple headers of type t can be combined
+// into a single header, with the values separated by commas
+// (rfc7230 3.2.2). For HdrOther it returns true: unknown headers are
+// assumed to be lists (since they can appear multiple times), with the
+// exception of Set-Cookie (see HdrCombinable()).
+func (t HdrT) Combinable() bool {
+	return t > HdrNone && t <= HdrOther && !HdrSingletonF.Test(t)
+}
+
+// HdrCombinable returns true if multiple h headers can be combined into
+// a single header (see HdrT.Combinable()). buf is the buffer the header
+// was parsed from.
+func HdrCombinable(buf []byte, h *Hdr) bool {
+	if h.Type == HdrOther {
+		n := h.Name.Get(buf)
+		return !(len(n) == 10 && bytescase.CmpEq(n, []byte("set-cookie")))
+	}
+	return h.Type.Combinable()
+}
+
+// HdrHopByHopF contains the flags for the known hop-by-hop headers
+// (rfc7230 6.1, rfc7235 4.3 & 4.4), that must not be forwarded by a proxy.
+// Any other header listed in Connection is also hop-by-hop.
+const HdrHopByHopF = HdrConnectionF | HdrTrEncodingF | HdrUpgradeF |
+	HdrProxyAuthenticateF | HdrProxyAuthorizationF
+
+// HopByHop returns true if the header type is a known hop-by-hop header.
+func (t HdrT) HopByHop() bool {
+	return t > HdrNone && t < HdrOther && HdrHopByHopF.Test(t)
+}
+
 // pretty names for debugging and error reporting
 var hdrTStr = [...]string{
-	HdrNone:        "nil",
-	HdrCLen:        "Content-Length",
-	HdrTrEncoding:  "Transfer-Encoding",
-	HdrUpgrade:     "Upgrade",
-	HdrCEncoding:   "Content-Encoding",
-	HdrHost:        "Host",
-	HdrServer:      "Server",
-	HdrOrigin:      "Origin",
-	HdrConnection:  "Connection",
-	HdrWSockKey:    "Sec-WebSocket-Key",
-	HdrWSockProto:  "Sec-WebSocket-Protocol",
-	HdrWSockAccept: "Sec-WebSocket-Accept",
-	HdrWSockVer:    "Sec-WebSocket-Version",
-	HdrWSockExt:    "Sec-WebSocket-Extensions",
-	HdrOther:       "Generic",
+	HdrNone:               "nil",
+	HdrCLen:               "Content-Length",
+	HdrTrEncoding:         "Transfer-Encoding",
+	HdrUpgrade:            "Upgrade",
+	HdrCEncoding:          "Content-Encoding",
+	HdrHost:               "Host",
+	HdrServer:             "Server",
+	HdrOrigin:             "Origin",
+	HdrConnection:         "Connection",
+	HdrWSockKey:           "Sec-WebSocket-Key",
+	HdrWSockProto:         "Sec-WebSocket-Protocol",
+	HdrWSockAccept:        "Sec-WebSocket-Accept",
+	HdrWSockVer:           "Sec-WebSocket-Version",
+	HdrWSockExt:           "Sec-WebSocket-Extensions",
+	HdrContentDisposition: "Content-Disposition",
+	HdrContentType:        "Content-Type",
+	HdrVary:               "Vary",
+	HdrPragma:             "Pragma",
+	HdrWarning:            "Warning",
+	HdrLink:               "Link",
+	HdrProxyAuthenticate:  "Proxy-Authenticate",
+	HdrProxyAuthorization: "Proxy-Authorization",
+	HdrACReqMethod:        "Access-Control-Request-Method",
+	HdrACReqHeaders:       "Access-Control-Request-Headers",
+	HdrACAllowOrigin:      "Access-Control-Allow-Origin",
+	HdrACAllowMethods:     "Access-Control-Allow-Methods",
+	HdrACAllowHeaders:     "Access-Control-Allow-Headers",
+	HdrContentLanguage:    "Content-Language",
+	HdrIfRange:            "If-Range",
+	HdrExpectCT:           "Expect-CT",
+	HdrSTS:                "Strict-Transport-Security",
+	HdrOther:              "Generic",
 }
 
 // String implements the Stringer interface.
@@ -121,6 +239,58 @@ func (t HdrT) String() string {
 	return hdrTStr[t]
 }
 
+// AllHdrTypes returns a newly allocated slice with all the recognized
+// header types, in increasing order (HdrNone and HdrOther are not
+// included). It can be used to build per header type configuration
+// (e.g. allow/deny lists).
+func AllHdrTypes() []HdrT {
+	t := make([]HdrT, 0, HdrOther-HdrNone-1)
+	for i := HdrNone + 1; i < HdrOther; i++ {
+		t = append(t, i)
+	}
+	return t
+}
+
+// CanonicalName returns the canonical spelling of the header name
+// (e.g. "Content-Length") for the known header types or nil for HdrNone,
+// HdrOther and invalid values.
+// The returned slice should not be modified.
+func (t HdrT) CanonicalName() []byte {
+	if t > HdrNone && t < HdrOther {
+		return hdrTCanonical[t]
+	}
+	return nil
+}
+
+// canonical header names as byte slices (initialised from hdrTStr)
+var hdrTCanonical [len(hdrTStr)][]byte
+
+// CanonicalizeHdrName appends the canonical form of the header name to dst
+// and returns the extended slice.
+// The canonical form has the first letter and any letter following a
+// hyphen in upper case and the rest in lower case (e.g. "content-type"
+// becomes "Content-Type"), similar to net/textproto.
+// If name contains characters not allowed inside a header name, it is
+// appended unchanged.
+func CanonicalizeHdrName(dst, name []byte) []byte {
+	for _, c := range name {
+		if !tcharAllowed(c) {
+			return append(dst, name...)
+		}
+	}
+	upper := true
+	for _, c := range name {
+		if upper {
+			c = bytescase.ByteToUpper(c)
+		} else {
+			c = bytescase.ByteToLower(c)
+		}
+		dst = append(dst, c)
+		upper = c == '-'
+	}
+	return dst
+}
+
 // associates header name (as byte slice) to HdrT header type
 type hdr2Type struct {
 	n []byte
@@ -143,10 +313,27 @@ var hdrName2Type = [...]hdr2Type{
 	{n: []byte("sec-websocket-version"), t: HdrWSockVer},
 	{n: []byte("sec-websocket-extensions"), t: HdrWSockExt},
 	{n: []byte("origin"), t: HdrOrigin},
+	{n: []byte("content-disposition"), t: HdrContentDisposition},
+	{n: []byte("content-type"), t: HdrContentType},
+	{n: []byte("vary"), t: HdrVary},
+	{n: []byte("pragma"), t: HdrPragma},
+	{n: []byte("warning"), t: HdrWarning},
+	{n: []byte("link"), t: HdrLink},
+	{n: []byte("proxy-authenticate"), t: HdrProxyAuthenticate},
+	{n: []byte("proxy-authorization"), t: HdrProxyAuthorization},
+	{n: []byte("access-control-request-method"), t: HdrACReqMethod},
+	{n: []byte("access-control-request-headers"), t: HdrACReqHeaders},
+	{n: []byte("access-control-allow-origin"), t: HdrACAllowOrigin},
+	{n: []byte("access-control-allow-methods"), t: HdrACAllowMethods},
+	{n: []byte("access-control-allow-headers"), t: HdrACAllowHeaders},
+	{n: []byte("content-language"), t: HdrContentLanguage},
+	{n: []byte("if-range"), t: HdrIfRange},
+	{n: []byte("expect-ct"), t: HdrExpectCT},
+	{n: []byte("strict-transport-security"), t: HdrSTS},
 }
 
 const (
-	hnBitsLen   uint = 2 // after changing this re-run testing
+	hnBitsLen   uint = 3 // after changing this re-run testing
 	hnBitsFChar uint = 5
 )
 
@@ -164,17 +351,83 @@ func hashHdrName(n []byte) int {
 		((len(n) & mL) << hnBitsFChar)
 }
 
+// hdrTrieNode is a node in the header names trie, used as an alternative
+// to the hdrNameLookup hash (see UseHdrNameTrie()).
+type hdrTrieNode struct {
+	c    byte           // lowercase char leading to this node
+	t    HdrT           // header type if a name ends here, else HdrNone
+	next []*hdrTrieNode // children
+}
+
+// child returns the child node for the lowercase char c or nil.
+func (n *hdrTrieNode) child(c byte) *hdrTrieNode {
+	for _, nxt := range n.next {
+		if nxt.c == c {
+			return nxt
+		}
+	}
+	return nil
+}
+
+// add adds a lowercase header name to the trie.
+func (n *hdrTrieNode) add(name []byte, t HdrT) {
+	for _, c := range name {
+		nxt := n.child(c)
+		if nxt == nil {
+			nxt = &hdrTrieNode{c: c}
+			n.next = append(n.next, nxt)
+		}
+		n = nxt
+	}
+	n.t = t
+}
+
+// lookup returns the header type for name (case-insensitive) or HdrOther.
+func (n *hdrTrieNode) lookup(name []byte) HdrT {
+	for _, c := range name {
+		if n = n.child(bytescase.ByteToLower(c)); n == nil {
+			return HdrOther
+		}
+	}
+	if n.t == HdrNone {
+		return HdrOther
+	}
+	return n.t
+}
+
+var hdrNameTrie hdrTrieNode
+
+// use hdrNameTrie instead of hdrNameLookup in GetHdrType()
+var hdrUseTrie bool
+
+// UseHdrNameTrie selects the header name lookup method used by
+// GetHdrType(): a case-insensitive trie on the full name (on == true) or
+// the default hash on the first char and the length.
+// The trie lookup is O(name length) and has no collisions, independent of
+// the number of known header names.
+// It should be called only at init time, before any parsing.
+func UseHdrNameTrie(on bool) {
+	hdrUseTrie = on
+}
+
 func init() {
+	for t := HdrNone + 1; t < HdrOther; t++ {
+		hdrTCanonical[t] = []byte(hdrTStr[t])
+	}
 	// init lookup arrays
 	for _, h := range hdrName2Type {
 		i := hashHdrName(h.n)
 		hdrNameLookup[i] = append(hdrNameLookup[i], h)
+		hdrNameTrie.add(h.n, h.t)
 	}
 }
 
 // GetHdrType returns the corresponding HdrT type for a given header name.
 // The header name should not contain any leading or ending white space.
 func GetHdrType(name []byte) HdrT {
+	if hdrUseTrie {
+		return hdrNameTrie.lookup(name)
+	}
 	i := hashHdrName(name)
 	for _, h := range hdrNameLookup[i] {
 		if bytescase.CmpEq(name, h.n) {
@@ -184,11 +437,44 @@ func GetHdrType(name []byte) HdrT {
 	return HdrOther
 }
 
+// legacy WebSocket header names (hixie-75, hixie-76 and the early hybi
+// drafts), recognized only with MsgLegacyWSHdrsF
+var hdrLegacyWSName2Type = [...]hdr2Type{
+	{n: []byte("sec-websocket-origin"), t: HdrOrigin},
+	{n: []byte("websocket-origin"), t: HdrOrigin},
+	{n: []byte("websocket-protocol"), t: HdrWSockProto},
+}
+
+// GetHdrTypeFlags is a version of GetHdrType() that accepts ParseMsg()
+// parsing flags. The only flag used is MsgLegacyWSHdrsF: if set, the
+// obsolete header names used by old WebSocket drafts are mapped to the
+// corresponding current header types ("Sec-WebSocket-Origin" and
+// "WebSocket-Origin" to HdrOrigin and "WebSocket-Protocol" to
+// HdrWSockProto).
+func GetHdrTypeFlags(name []byte, flags MsgFlags) HdrT {
+	t := GetHdrType(name)
+	if t == HdrOther && (flags&MsgLegacyWSHdrsF) != 0 {
+		for _, h := range hdrLegacyWSName2Type {
+			if len(name) == len(h.n) && bytescase.CmpEq(name, h.n) {
+				return h.t
+			}
+		}
+	}
+	return t
+}
+
 // Hdr contains a partial or fully parsed header.
+// Name always points to the original header name bytes inside the parsed
+// buffer, as received (the case is never changed, canonicalization is
+// opt-in, see HdrT.CanonicalName() and CanonicalizeHdrName()).
 type Hdr struct {
 	Type HdrT
 	Name PField
 	Val  PField
+	Raw  PField // complete header line, from the name start to after CRLF
+	// Folded is set if the header value spans multiple lines
+	// (obsolete line folding, CRLF followed by whitespace)
+	Folded bool
 	HdrIState
 }
 
@@ -197,11 +483,63 @@ func (h *Hdr) Reset() {
 	*h = Hdr{}
 }
 
+// OrigName returns the header name exactly as it appears in buf (the
+// buffer the header was parsed from), preserving the original case.
+func (h *Hdr) OrigName(buf []byte) []byte {
+	return h.Name.Get(buf)
+}
+
+// setRaw sets the complete header line (Raw), ending at offset end and
+// checks if the header value was folded.
+func (h *Hdr) setRaw(buf []byte, end int) {
+	h.Raw.Set(int(h.Name.Offs), end)
+	h.Folded = false
+	// look for CR or LF followed by whitespace, after the header name
+	// (the header line terminator is followed by something outside Raw)
+	for i := h.Name.EndOffs(); i < (end - 1); i++ {
+		if (buf[i] == '\r' || buf[i] == '\n') &&
+			(buf[i+1] == ' ' || buf[i+1] == '\t') {
+			h.Folded = true
+			break
+		}
+	}
+}
+
 // Missing returns true if the header is empty (not parsed).
 func (h *Hdr) Missing() bool {
 	return h.Type == HdrNone
 }
 
+// RedactValue overwrites the header value bytes in buf with mask (e.g. for
+// logging messages without sensitive values like credentials).
+// buf should be a writable copy of the buffer the header was parsed from
+// (same offsets). For folded values the line terminators and the
+// whitespace starting the continuation lines are preserved, so that the
+// message structure remains unchanged.
+// If the header value does not fit inside buf, buf is not modified.
+func (h *Hdr) RedactValue(buf []byte, mask byte) {
+	v, ok := h.Val.SafeGet(buf)
+	if !ok {
+		return
+	}
+	nl := false
+	for i, c := range v {
+		switch {
+		case c == '\r' || c == '\n':
+			nl = true
+		case nl && (c == ' ' || c == '\t'):
+			// continuation line start
+		default:
+			nl = false
+			v[i] = mask
+		}
+	}
+}
+
+// DefaultMaxHdrNameLen is the default maximum header name length
+// (see HdrLst.MaxNameLen).
+const DefaultMaxHdrNameLen = 256
+
 // HdrIState contains internal header parsing state.
 type HdrIState struct {
 	state uint8
@@ -209,27 +547,170 @@ type HdrIState struct {
 
 // HdrLst groups a list of parsed headers.
 type HdrLst struct {
-	PFlags HdrFlags               // parsed headers as flags
-	N      int                    // total numbers of headers found (can be > len(Hdrs))
-	Hdrs   []Hdr                  // all parsed headers, that fit in the slice.
-	h      [int(HdrOther) - 1]Hdr // list of type -> hdr, pointing to the
+	PFlags   HdrFlags               // parsed headers as flags
+	DupFlags HdrFlags               // duplicated headers types as flags
+	N        int                    // total numbers of headers found (can be > len(Hdrs))
+	Skipped  int                    // malformed header lines skipped (MsgLenientHdrsF)
+	Hdrs     []Hdr                  // all parsed headers, that fit in the slice.
+	h        [int(HdrOther) - 1]Hdr // list of type -> hdr, pointing to the
 	// first hdr with the corresponding type.
+
+	// HdrFilter, if non-zero, selects the header types that will be fully
+	// parsed and stored in Hdrs (the framing headers, Content-Length and
+	// Transfer-Encoding, are always included). The other headers are
+	// only skipped over: their types are recorded in PFlags and DupFlags,
+	// but they are not stored in Hdrs, not counted in N and their values
+	// are not parsed. It is kept by Reset().
+	HdrFilter HdrFlags
+	// EndHdrsOffs is the offset of the empty line (CRLF) terminating the
+	// headers, set when the end of headers is found. The header lines are
+	// buf[start:EndHdrsOffs] (including the CRLF of the last header) and
+	// new headers can be inserted at EndHdrsOffs, before the terminator.
+	EndHdrsOffs int
+	// MaxNameLen is the maximum header name length accepted (longer names
+	// are rejected with ErrHdrTooBig). 0 means DefaultMaxHdrNameLen and
+	// a negative value disables the check. It is kept by Reset().
+	MaxNameLen int
 	HdrLstIState
 }
 
 // HdrLstIState contains internal HdrLst parsing state.
 type HdrLstIState struct {
-	hdr Hdr // tmp. header used for saving the state
+	hdr  Hdr   // tmp. header used for saving the state
+	skip uint8 // skipping a malformed header line (MsgLenientHdrsF)
 }
 
 // Reset re-initializes the parsing state and values.
 func (hl *HdrLst) Reset() {
 	hdrs := hl.Hdrs
+	filter := hl.HdrFilter
+	maxName := hl.MaxNameLen
 	*hl = HdrLst{}
 	for i := 0; i < len(hdrs); i++ {
 		hdrs[i].Reset()
 	}
 	hl.Hdrs = hdrs
+	hl.HdrFilter = filter
+	hl.MaxNameLen = maxName
+}
+
+// Dropped returns the number of parsed headers that did not fit in Hdrs
+// (max(0, N - len(Hdrs))). Their values are not available (except for
+// the type "shortcuts", see GetHdr(), and for the parsed header
+// bodies).
+func (hl *HdrLst) Dropped() int {
+	if hl.N > len(hl.Hdrs) {
+		return hl.N - len(hl.Hdrs)
+	}
+	return 0
+}
+
+// Overflowed returns true if some parsed headers did not fit in Hdrs
+// (a bigger Hdrs slice would be needed to keep all of them).
+func (hl *HdrLst) Overflowed() bool {
+	return hl.N > len(hl.Hdrs)
+}
+
+// AppendCombined appends the parsed headers (only the ones that fit in
+// Hdrs) to dst, one header per line, combining the values of the
+// duplicate combinable headers (see HdrCombinable()) into one
+// comma-separated line, placed at the position of the first occurrence
+// (rfc7230 3.2.2). The non-combinable duplicates (e.g. Set-Cookie) are
+// kept as separate lines.
+// The original header names are used and obsolete line folding inside
+// values is replaced by a single space. The terminating empty line is not
+// added. buf is the buffer the headers were parsed from.
+// It returns the extended slice.
+func (hl *HdrLst) AppendCombined(dst, buf []byte) []byte {
+	n := hl.N
+	if n > len(hl.Hdrs) {
+		n = len(hl.Hdrs)
+	}
+	var done HdrFlags // known header types already added (combined)
+	for i := 0; i < n; i++ {
+		h := &hl.Hdrs[i]
+		comb := HdrCombinable(buf, h)
+		if comb && h.Type != HdrOther && done.Test(h.Type) {
+			continue
+		}
+		if comb && h.Type == HdrOther && hl.otherSeen(buf, i) {
+			continue
+		}
+		dst = append(dst, h.Name.Get(buf)...)
+		dst = append(dst, ':', ' ')
+		dst = appendUnfolded(dst, h.Val.Get(buf))
+		if comb {
+			done.Set(h.Type)
+			sep := !h.Val.Empty()
+			for j := i + 1; j < n; j++ {
+				d := &hl.Hdrs[j]
+				if d.Type != h.Type || d.Val.Empty() ||
+					(h.Type == HdrOther && (d.Name.Len != h.Name.Len ||
+						!bytescase.CmpEq(d.Name.Get(buf), h.Name.Get(buf)))) {
+					continue
+				}
+				if sep {
+					dst = append(dst, ',', ' ')
+				}
+				dst = appendUnfolded(dst, d.Val.Get(buf))
+				sep = true
+			}
+		}
+		dst = append(dst, '\r', '\n')
+	}
+	return dst
+}
+
+// otherSeen returns true if a HdrOther header with the same name as
+// Hdrs[i] is present before i.
+func (hl *HdrLst) otherSeen(buf []byte, i int) bool {
+	h := &hl.Hdrs[i]
+	for j := 0; j < i; j++ {
+		if hl.Hdrs[j].Type == HdrOther && hl.Hdrs[j].Name.Len == h.Name.Len &&
+			bytescase.CmpEq(hl.Hdrs[j].Name.Get(buf), h.Name.Get(buf)) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendUnfolded appends the header value v to dst, replacing any
+// obsolete line folding (CRLF followed by white space) with a single
+// space.
+func appendUnfolded(dst, v []byte) []byte {
+	for i := 0; i < len(v); i++ {
+		if v[i] == '\r' || v[i] == '\n' {
+			for i+1 < len(v) && (v[i+1] == '\r' || v[i+1] == '\n' ||
+				v[i+1] == ' ' || v[i+1] == '\t') {
+				i++
+			}
+			dst = append(dst, ' ')
+			continue
+		}
+		dst = append(dst, v[i])
+	}
+	return dst
+}
+
+// InvalidUTF8 checks the values of the headers with the types in the
+// types flags (only the headers that fit in Hdrs) and returns the first
+// header with a value that is not valid UTF-8 or nil if all of them are
+// valid (see PField.IsValidUTF8()).
+// It is an opt-in check, intended for applications requiring UTF-8
+// values for some headers (HTTP allows any non-ASCII bytes).
+// buf is the buffer the headers were parsed from.
+func (hl *HdrLst) InvalidUTF8(buf []byte, types HdrFlags) *Hdr {
+	n := hl.N
+	if n > len(hl.Hdrs) {
+		n = len(hl.Hdrs)
+	}
+	for i := 0; i < n; i++ {
+		h := &hl.Hdrs[i]
+		if types.Test(h.Type) && !h.Val.IsValidUTF8(buf) {
+			return h
+		}
+	}
+	return nil
 }
 
 // GetHdr returns the first parsed header of the requested type.
@@ -241,6 +722,25 @@ func (hl *HdrLst) GetHdr(t HdrT) *Hdr {
 	return nil
 }
 
+// GetHdrs returns all the parsed headers of the requested type (including
+// duplicates and HdrOther headers), in the order in which they appear
+// in the message.
+// Only the headers that fit in Hdrs are returned (see N).
+// If no corresponding header was parsed it returns nil.
+func (hl *HdrLst) GetHdrs(t HdrT) []*Hdr {
+	n := hl.N
+	if n > len(hl.Hdrs) {
+		n = len(hl.Hdrs)
+	}
+	var hdrs []*Hdr
+	for i := 0; i < n; i++ {
+		if hl.Hdrs[i].Type == t {
+			hdrs = append(hdrs, &hl.Hdrs[i])
+		}
+	}
+	return hdrs
+}
+
 // SetHdr adds a new header to the  internal "first" header list (see GetHdr)
 // if not already present.
 // It returns true if successful and false if a header of the same type was
@@ -261,17 +761,53 @@ type PHBodies interface {
 	GetTrEnc() *PTrEnc
 	GetWSProto() *PWSProto
 	GetWSExt() *PWSExt
+	GetCDisp() *PContentDisposition
+	GetCType() *PContentType
+	GetVary() *PVary
+	GetPragma() *PPragma
+	GetWarning() *PWarning
+	GetLink() *PLink
+	GetProxyAuthn() *PAuthChallenges
+	GetProxyAuthz() *PAuthCredentials
+	GetACReqMethod() *PACReqMethod
+	GetACReqHdrs() *PHdrNameLst
+	GetACAllowOrigin() *PACAllowOrigin
+	GetACAllowMethods() *PMethodLst
+	GetACAllowHdrs() *PHdrNameLst
+	GetCLang() *PContentLanguage
+	GetConn() *PConnection
+	GetIfRange() *PIfRange
+	GetExpectCT() *PExpectCT
+	GetSTS() *PSTS
 	Reset()
 }
 
 // PHdrVals holds all the header specific parsed values structures.
 // (implements PHBodies)
 type PHdrVals struct {
-	CLen    PUIntBody
-	Upgrade PUpgrade
-	TrEnc   PTrEnc
-	WSProto PWSProto
-	WSExt   PWSExt
+	CLen           PUIntBody
+	Upgrade        PUpgrade
+	TrEnc          PTrEnc
+	WSProto        PWSProto
+	WSExt          PWSExt
+	CDisp          PContentDisposition
+	CType          PContentType
+	Vary           PVary
+	Pragma         PPragma
+	Warning        PWarning
+	Link           PLink
+	ProxyAuthn     PAuthChallenges
+	ProxyAuthz     PAuthCredentials
+	ACReqMethod    PACReqMethod
+	ACReqHdrs      PHdrNameLst
+	ACAllowOrigin  PACAllowOrigin
+	ACAllowMethods PMethodLst
+	ACAllowHdrs    PHdrNameLst
+	CLang          PContentLanguage
+	Conn           PConnection
+	IfRange        PIfRange
+	ExpectCT       PExpectCT
+	STS            PSTS
 }
 
 // Reset re-initializes all the parsed values.
@@ -281,6 +817,65 @@ func (hv *PHdrVals) Reset() {
 	hv.TrEnc.Reset()
 	hv.WSProto.Reset()
 	hv.WSExt.Reset()
+	hv.CDisp.Reset()
+	hv.CType.Reset()
+	hv.Vary.Reset()
+	hv.Pragma.Reset()
+	hv.Warning.Reset()
+	hv.Link.Reset()
+	hv.ProxyAuthn.Reset()
+	hv.ProxyAuthz.Reset()
+	hv.ACReqMethod.Reset()
+	hv.ACReqHdrs.Reset()
+	hv.ACAllowOrigin.Reset()
+	hv.ACAllowMethods.Reset()
+	hv.ACAllowHdrs.Reset()
+	hv.CLang.Reset()
+	hv.Conn.Reset()
+	hv.IfRange.Reset()
+	hv.ExpectCT.Reset()
+	hv.STS.Reset()
+}
+
+// ParsedFlags returns the header types for which the corresponding
+// specific parsed value is filled (e.g. HdrCLenF if CLen was parsed).
+// Compared to HdrLst.PFlags, it contains only the headers with a
+// specific parser, whose values were successfully parsed.
+func (hv *PHdrVals) ParsedFlags() HdrFlags {
+	var f HdrFlags
+	for _, v := range [...]struct {
+		t HdrT
+		p bool
+	}{
+		{HdrCLen, hv.CLen.Parsed()},
+		{HdrUpgrade, hv.Upgrade.Parsed()},
+		{HdrTrEncoding, hv.TrEnc.Parsed()},
+		{HdrWSockProto, hv.WSProto.Parsed()},
+		{HdrWSockExt, hv.WSExt.Parsed()},
+		{HdrContentDisposition, hv.CDisp.Parsed()},
+		{HdrContentType, hv.CType.Parsed()},
+		{HdrVary, hv.Vary.Parsed()},
+		{HdrPragma, hv.Pragma.Parsed()},
+		{HdrWarning, hv.Warning.Parsed()},
+		{HdrLink, hv.Link.Parsed()},
+		{HdrProxyAuthenticate, hv.ProxyAuthn.Parsed()},
+		{HdrProxyAuthorization, hv.ProxyAuthz.Parsed()},
+		{HdrACReqMethod, hv.ACReqMethod.Parsed()},
+		{HdrACReqHeaders, hv.ACReqHdrs.Parsed()},
+		{HdrACAllowOrigin, hv.ACAllowOrigin.Parsed()},
+		{HdrACAllowMethods, hv.ACAllowMethods.Parsed()},
+		{HdrACAllowHeaders, hv.ACAllowHdrs.Parsed()},
+		{HdrContentLanguage, hv.CLang.Parsed()},
+		{HdrConnection, hv.Conn.Parsed()},
+		{HdrIfRange, hv.IfRange.Parsed()},
+		{HdrExpectCT, hv.ExpectCT.Parsed()},
+		{HdrSTS, hv.STS.Parsed()},
+	} {
+		if v.p {
+			f.Set(v.t)
+		}
+	}
+	return f
 }
 
 // GetCLen returns a pointer to the parsed content-length body.
@@ -313,6 +908,119 @@ func (hv *PHdrVals) GetWSExt() *PWSExt {
 	return &hv.WSExt
 }
 
+// GetCDisp returns a pointer to the parsed Content-Disposition body.
+// It implements the PHBodies interface.
+func (hv *PHdrVals) GetCDisp() *PContentDisposition {
+	return &hv.CDisp
+}
+
+// GetCType returns a pointer to the parsed Content-Type body.
+// It implements the PHBodies interface.
+func (hv *PHdrVals) GetCType() *PContentType {
+	return &hv.CType
+}
+
+// GetVary returns a pointer to the parsed Vary body.
+// It implements the PHBodies interface.
+func (hv *PHdrVals) GetVary() *PVary {
+	return &hv.Vary
+}
+
+// GetPragma returns a pointer to the parsed Pragma body.
+// It implements the PHBodies interface.
+func (hv *PHdrVals) GetPragma() *PPragma {
+	return &hv.Pragma
+}
+
+// GetWarning returns a pointer to the parsed Warning body.
+// It implements the PHBodies interface.
+func (hv *PHdrVals) GetWarning() *PWarning {
+	return &hv.Warning
+}
+
+// GetLink returns a pointer to the parsed Link body.
+// It implements the PHBodies interface.
+func (hv *PHdrVals) GetLink() *PLink {
+	return &hv.Link
+}
+
+// GetProxyAuthn returns a pointer to the parsed Proxy-Authenticate body.
+// It implements the PHBodies interface.
+func (hv *PHdrVals) GetProxyAuthn() *PAuthChallenges {
+	return &hv.ProxyAuthn
+}
+
+// GetProxyAuthz returns a pointer to the parsed Proxy-Authorization body.
+// It implements the PHBodies interface.
+func (hv *PHdrVals) GetProxyAuthz() *PAuthCredentials {
+	return &hv.ProxyAuthz
+}
+
+// GetACReqMethod returns a pointer to the parsed
+// Access-Control-Request-Method body.
+// It implements the PHBodies interface.
+func (hv *PHdrVals) GetACReqMethod() *PACReqMethod {
+	return &hv.ACReqMethod
+}
+
+// GetACReqHdrs returns a pointer to the parsed
+// Access-Control-Request-Headers body.
+// It implements the PHBodies interface.
+func (hv *PHdrVals) GetACReqHdrs() *PHdrNameLst {
+	return &hv.ACReqHdrs
+}
+
+// GetACAllowOrigin returns a pointer to the parsed
+// Access-Control-Allow-Origin body.
+// It implements the PHBodies interface.
+func (hv *PHdrVals) GetACAllowOrigin() *PACAllowOrigin {
+	return &hv.ACAllowOrigin
+}
+
+// GetACAllowMethods returns a pointer to the parsed
+// Access-Control-Allow-Methods body.
+// It implements the PHBodies interface.
+func (hv *PHdrVals) GetACAllowMethods() *PMethodLst {
+	return &hv.ACAllowMethods
+}
+
+// GetACAllowHdrs returns a pointer to the parsed
+// Access-Control-Allow-Headers body.
+// It implements the PHBodies interface.
+func (hv *PHdrVals) GetACAllowHdrs() *PHdrNameLst {
+	return &hv.ACAllowHdrs
+}
+
+// GetCLang returns a pointer to the parsed Content-Language body.
+// It implements the PHBodies interface.
+func (hv *PHdrVals) GetCLang() *PContentLanguage {
+	return &hv.CLang
+}
+
+// GetConn returns a pointer to the parsed Connection body.
+// It implements the PHBodies interface.
+func (hv *PHdrVals) GetConn() *PConnection {
+	return &hv.Conn
+}
+
+// GetIfRange returns a pointer to the parsed If-Range body.
+// It implements the PHBodies interface.
+func (hv *PHdrVals) GetIfRange() *PIfRange {
+	return &hv.IfRange
+}
+
+// GetExpectCT returns a pointer to the parsed Expect-CT body.
+// It implements the PHBodies interface.
+func (hv *PHdrVals) GetExpectCT() *PExpectCT {
+	return &hv.ExpectCT
+}
+
+// GetSTS returns a pointer to the parsed Strict-Transport-Security body.
+// It implements the PHBodies interface.
+func (hv *PHdrVals) GetSTS() *PSTS {
+	return &hv.STS
+}
+
 // ParseHdrLine parses a header from a HTTP message.
 // The parameters are: a message buffer, the offset in the buffer where the
 // parsing should start (or continue), a pointer to a Hdr structure that will
@@ -328,12 +1036,28 @@ func (hv *PHdrVals) GetWSExt() *PWSExt {
 // Another special error value is ErrHdrEmpty. It is returned if the header
 // is empty ( CR LF). If previous headers were parsed, this means the end of
 // headers was encountered. The offset returned is after the CRLF.
+// Header names longer than DefaultMaxHdrNameLen are rejected with
+// ErrHdrTooBig and header names containing characters not allowed in a
+// token (rfc7230 "tchar", e.g. '@', '/' or control characters) or followed
+// by whitespace before the ':' (rfc7230 3.2.4) with ErrHdrBadChar.
+// Invalid values of the headers parsed only for information purposes
+// (e.g. Connection) do not cause an error: the header is kept, but its
+// value is not added to hb (see hdrValLaxF).
 func ParseHdrLine(buf []byte, offs int, h *Hdr, hb PHBodies) (int, ErrorHdr) {
-	// grammar:  Name SP* : LWS* val LWS* CRLF
+	return parseHdrLine(buf, offs, h, hb, 0, DefaultMaxHdrNameLen, 0)
+}
+
+// parseHdrLine is the internal version of ParseHdrLine(). If filter is
+// non-zero, only the values of the header types in filter are parsed
+// into hb (the other values are only skipped over). Header names longer
+// than maxName are rejected (maxName < 0 disables the check). flags are
+// ParseMsg() flags (only MsgLegacyWSHdrsF is used, see GetHdrTypeFlags()).
+func parseHdrLine(buf []byte, offs int, h *Hdr, hb PHBodies,
+	filter HdrFlags, maxName int, flags MsgFlags) (int, ErrorHdr) {
+	// grammar:  Name : LWS* val LWS* CRLF
 	const (
 		hInit uint8 = iota
 		hName
-		hNameEnd
 		hBodyStart
 		hVal
 		hValEnd
@@ -342,19 +1066,46 @@ func ParseHdrLine(buf []byte, offs int, h *Hdr, hb PHBodies) (int, ErrorHdr) {
 		hTrEncoding
 		hWSockProto
 		hWSockExt
+		hCDisp
+		hCType
+		hVary
+		hPragma
+		hWarning
+		hLink
+		hProxyAuthn
+		hProxyAuthz
+		hACReqMethod
+		hACReqHdrs
+		hACAllowOrigin
+		hACAllowMethods
+		hACAllowHdrs
+		hCLang
+		hConnection
+		hIfRange
+		hExpectCT
+		hSTS
 		hFIN
 	)
 
+	if len(buf) > MaxBufSize {
+		return offs, ErrHdrTooBig
+	}
+
 	// helper internal function for parsing header specific values if
 	//  header specific parser are available (else fall back to generic
 	//  value parsing)
 	parseBody := func(buf []byte, o int, h *Hdr, hb PHBodies) (int, ErrorHdr) {
 		var err ErrorHdr
 		n := o
-		if hb != nil {
+		if hb != nil && (filter == 0 || filter.Test(h.Type)) {
 			switch h.Type {
 			case HdrCLen:
-				if clenb := hb.GetCLen(); clenb != nil && !clenb.Parsed() {
+				clenb := hb.GetCLen()
+				if clenb != nil && h.state != hCLen {
+					// new Content-Length header found
+					clenb.HNo++
+				}
+				if clenb != nil && !clenb.Parsed() {
 					h.state = hCLen
 					n, err = ParseCLenVal(buf, o, clenb)
 					if err == 0 { /* fix hdr.Val */
@@ -405,11 +1156,228 @@ func ParseHdrLine(buf []byte, offs int, h *Hdr, hb PHBodies) (int, ErrorHdr) {
 					// fix hdr.Val
 					h.Val = wsExt.LastParsed
 				}
+			case HdrContentDisposition:
+				if cd := hb.GetCDisp(); cd != nil && !cd.Parsed() {
+					h.state = hCDisp
+					n, err = ParseContentDispositionVal(buf, o, cd)
+					if err == 0 { /* fix hdr.Val */
+						h.Val = cd.Val
+					}
+				}
+			case HdrContentType:
+				if ct := hb.GetCType(); ct != nil && !ct.Parsed() {
+					h.state = hCType
+					n, err = ParseContentTypeVal(buf, o, ct)
+					if err == 0 { /* fix hdr.Val */
+						h.Val = ct.Val
+					}
+				}
+			case HdrVary:
+				if vary := hb.GetVary(); vary != nil {
+					if h.state != hVary {
+						// new Vary header found
+						vary.HNo++
+					}
+					h.state = hVary
+					n, _, err = ParseAllVaryValues(buf, o, vary)
+					// fix hdr.Val
+					h.Val = vary.LastParsed
+				}
+			case HdrPragma:
+				if pragma := hb.GetPragma(); pragma != nil {
+					if h.state != hPragma {
+						// new Pragma header found
+						pragma.HNo++
+					}
+					h.state = hPragma
+					n, _, err = ParseAllPragmaValues(buf, o, pragma)
+					// fix hdr.Val
+					h.Val = pragma.LastParsed
+				}
+			case HdrWarning:
+				if warning := hb.GetWarning(); warning != nil {
+					if h.state != hWarning {
+						// new Warning header found
+						warning.HNo++
+					}
+					h.state = hWarning
+					n, _, err = ParseAllWarningValues(buf, o, warning)
+					// fix hdr.Val
+					h.Val = warning.LastParsed
+				}
+			case HdrLink:
+				if link := hb.GetLink(); link != nil {
+					if h.state != hLink {
+						// new Link header found
+						link.HNo++
+					}
+					h.state = hLink
+					n, _, err = ParseAllLinkValues(buf, o, link)
+					// fix hdr.Val
+					h.Val = link.LastParsed
+				}
+			case HdrProxyAuthenticate:
+				if proxyAuthn := hb.GetProxyAuthn(); proxyAuthn != nil {
+					if h.state != hProxyAuthn {
+						// new Proxy-Authenticate header found
+						proxyAuthn.HNo++
+					}
+					h.state = hProxyAuthn
+					n, _, err = ParseAllAuthChallengeValues(buf, o, proxyAuthn)
+					// fix hdr.Val
+					h.Val = proxyAuthn.LastParsed
+				}
+			case HdrProxyAuthorization:
+				if proxyAuthz := hb.GetProxyAuthz(); proxyAuthz != nil && !proxyAuthz.Parsed() {
+					h.state = hProxyAuthz
+					n, err = ParseAuthCredentialsVal(buf, o, proxyAuthz)
+					if err == 0 { /* fix hdr.Val */
+						h.Val = proxyAuthz.V
+					}
+				}
+			case HdrACReqMethod:
+				if acReqMethod := hb.GetACReqMethod(); acReqMethod != nil &&
+					!acReqMethod.Parsed() {
+					h.state = hACReqMethod
+					n, err = ParseACReqMethodVal(buf, o, acReqMethod)
+					if err == 0 { /* fix hdr.Val */
+						h.Val = acReqMethod.Val
+					}
+				}
+			case HdrACReqHeaders:
+				if acReqHdrs := hb.GetACReqHdrs(); acReqHdrs != nil {
+					if h.state != hACReqHdrs {
+						// new Access-Control-Request-Headers header found
+						acReqHdrs.HNo++
+					}
+					h.state = hACReqHdrs
+					n, _, err = ParseAllHdrNameValues(buf, o, acReqHdrs)
+					// fix hdr.Val
+					h.Val = acReqHdrs.LastParsed
+				}
+			case HdrACAllowOrigin:
+				if acAllowOrigin := hb.GetACAllowOrigin(); acAllowOrigin != nil &&
+					!acAllowOrigin.Parsed() {
+					h.state = hACAllowOrigin
+					n, err = ParseACAllowOriginVal(buf, o, acAllowOrigin)
+					if err == 0 { /* fix hdr.Val */
+						h.Val = acAllowOrigin.Val
+					}
+				}
+			case HdrACAllowMethods:
+				if acAllowMethods := hb.GetACAllowMethods(); acAllowMethods != nil {
+					if h.state != hACAllowMethods {
+						// new Access-Control-Allow-Methods header found
+						acAllowMethods.HNo++
+					}
+					h.state = hACAllowMethods
+					n, _, err = ParseAllMethodValues(buf, o, acAllowMethods)
+					// fix hdr.Val
+					h.Val = acAllowMethods.LastParsed
+				}
+			case HdrACAllowHeaders:
+				if acAllowHdrs := hb.GetACAllowHdrs(); acAllowHdrs != nil {
+					if h.state != hACAllowHdrs {
+						// new Access-Control-Allow-Headers header found
+						acAllowHdrs.HNo++
+					}
+					h.state = hACAllowHdrs
+					n, _, err = ParseAllHdrNameValues(buf, o, acAllowHdrs)
+					// fix hdr.Val
+					h.Val = acAllowHdrs.LastParsed
+				}
+			case HdrContentLanguage:
+				if cLang := hb.GetCLang(); cLang != nil {
+					if h.state != hCLang {
+						// new Content-Language header found
+						cLang.HNo++
+					}
+					h.state = hCLang
+					n, _, err = ParseAllContentLanguageValues(buf, o, cLang)
+					// fix hdr.Val
+					h.Val = cLang.LastParsed
+				}
+			case HdrConnection:
+				if conn := hb.GetConn(); conn != nil {
+					if h.state != hConnection {
+						// new Connection header found
+						conn.HNo++
+					}
+					h.state = hConnection
+					n, _, err = ParseAllConnectionValues(buf, o, conn)
+					// fix hdr.Val
+					h.Val = conn.LastParsed
+				}
+			case HdrIfRange:
+				if ifRange := hb.GetIfRange(); ifRange != nil &&
+					!ifRange.Parsed() {
+					h.state = hIfRange
+					n, err = ParseIfRangeVal(buf, o, ifRange)
+					if err == 0 { /* fix hdr.Val */
+						h.Val = ifRange.Val
+					}
+				}
+			case HdrExpectCT:
+				if expectCT := hb.GetExpectCT(); expectCT != nil &&
+					!expectCT.Parsed() {
+					h.state = hExpectCT
+					n, err = ParseExpectCTVal(buf, o, expectCT)
+					if err == 0 { /* fix hdr.Val */
+						h.Val = expectCT.Val
+					}
+				}
+			case HdrSTS:
+				if sts := hb.GetSTS(); sts != nil && !sts.Parsed() {
+					h.state = hSTS
+					n, err = ParseSTSVal(buf, o, sts)
+					if err == 0 { /* fix hdr.Val */
+						h.Val = sts.Val
+					}
+				}
 			}
 		}
 		return n, err
 	}
 
+	// helper internal function for handling the end of a header specific
+	// value parsing (n & err returned by the value parser).
+	// An empty value (ErrHdrEmpty) ends only the current header line: the
+	// empty line marking the end of headers is detected only in hInit
+	// (treating it as end of headers would allow request smuggling).
+	// An invalid value for a header type in hdrValLaxF is ignored:
+	// the header is kept as a generic header (the value is not parsed) and
+	// parsing continues from the value start, with h.state set to
+	// hBodyStart.
+	valEnd := func(n int, err ErrorHdr) (int, ErrorHdr) {
+		switch err {
+		case 0:
+		case ErrHdrEmpty:
+			if h.Type == HdrTrEncoding {
+				// framing header, at least one transfer-coding required
+				return n, ErrHdrBadTrEnc
+			}
+			hdrValAbort(hb, h.Type, false)
+			h.Val.Reset()
+		case ErrHdrMoreBytes, ErrHdrBug:
+			return n, err
+		default:
+			if !hdrValLaxF.Test(h.Type) {
+				// invalid value: clean up the partial parsing state
+				// (the header line might be skipped, see MsgLenientHdrsF)
+				hdrValAbort(hb, h.Type, true)
+				return n, err
+			}
+			// fall back to generic value parsing
+			hdrValAbort(hb, h.Type, true)
+			h.Val.Reset()
+			h.state = hBodyStart
+			return h.Name.EndOffs() + 1, 0 // after ':'
+		}
+		h.state = hFIN
+		h.setRaw(buf, n)
+		return n, 0
+	}
+
 	var crl int
 	i := offs
 	for i < len(buf) {
@@ -437,54 +1405,34 @@ func ParseHdrLine(buf []byte, offs int, h *Hdr, hb PHBodies) (int, ErrorHdr) {
 			h.Name.Set(i, i)
 			fallthrough
 		case hName:
-			i = skipTokenDelim(buf, i, ':')
+			// field-name = token (rfc7230 3.2): stop at the first non-tchar
+			for i < len(buf) && tcharAllowed(buf[i]) {
+				i++
+			}
+			if maxName >= 0 && i-int(h.Name.Offs) > maxName {
+				return i, ErrHdrTooBig
+			}
 			if i >= len(buf) {
 				goto moreBytes
 			}
-			if buf[i] == ' ' || buf[i] == '\t' {
-				h.state = hNameEnd
-				h.Name.Extend(i)
-				if h.Name.Empty() {
-					goto errEmptyTok
-				}
-				i++
-			} else if buf[i] == ':' {
+			if buf[i] == ':' {
 				h.state = hBodyStart
 				h.Name.Extend(i)
 				if h.Name.Empty() {
 					goto errEmptyTok
 				}
-				h.Type = GetHdrType(h.Name.Get(buf))
+				h.Type = GetHdrTypeFlags(h.Name.Get(buf), flags)
 				i++
 				n, err := parseBody(buf, i, h, hb)
 				if h.state != hBodyStart {
-					if err == 0 {
-						h.state = hFIN
+					if n, err = valEnd(n, err); h.state != hBodyStart {
+						return n, err
 					}
-					return n, err
+					i = n
 				}
 			} else {
-				// non WS after seeing a token => error
-				goto errBadChar
-			}
-		case hNameEnd:
-			i = skipWS(buf, i)
-			if i >= len(buf) {
-				goto moreBytes
-			}
-			if buf[i] == ':' {
-				h.state = hBodyStart
-				h.Type = GetHdrType(h.Name.Get(buf))
-				i++
-				n, err := parseBody(buf, i, h, hb)
-				if h.state != hBodyStart {
-					if err == 0 {
-						h.state = hFIN
-					}
-					return n, err
-				}
-			} else {
-				// non WS after seing a token => error
+				// invalid name char or whitespace before ':' => error
+				// (rfc7230 3.2.4, request smuggling vector)
 				goto errBadChar
 			}
 		case hBodyStart:
@@ -532,9 +1480,11 @@ func ParseHdrLine(buf []byte, offs int, h *Hdr, hb PHBodies) (int, ErrorHdr) {
 			n, err := ParseCLenVal(buf, i, clenb)
 			if err == 0 { /* fix hdr.Val */
 				h.Val = clenb.SVal
-				h.state = hFIN
 			}
-			return n, err
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
+			}
+			i = n
 		case hUpgrade: // continue Upgrade parsing (multiple vals possible)
 			upgrades := hb.GetUpgrade()
 			n, _, err := ParseAllUpgradeValues(buf, i, upgrades)
@@ -545,10 +1495,10 @@ func ParseHdrLine(buf []byte, offs int, h *Hdr, hb PHBodies) (int, ErrorHdr) {
 				// add the last parsed part to current header content
 				h.Val.Extend(upgrades.LastParsed.EndOffs())
 			}
-			if err == 0 {
-				h.state = hFIN
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
 			}
-			return n, err
+			i = n
 		case hTrEncoding: // continue Tr-Enc parsing (multiple vals possible)
 			trEnc := hb.GetTrEnc()
 			n, _, err := ParseAllTrEncValues(buf, i, trEnc)
@@ -559,10 +1509,10 @@ func ParseHdrLine(buf []byte, offs int, h *Hdr, hb PHBodies) (int, ErrorHdr) {
 				// add the last parsed part to current header content
 				h.Val.Extend(trEnc.LastParsed.EndOffs())
 			}
-			if err == 0 {
-				h.state = hFIN
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
 			}
-			return n, err
+			i = n
 		case hWSockProto: // continue WSockProto parsing
 			wsProto := hb.GetWSProto()
 			n, _, err := ParseAllWSProtoValues(buf, i, wsProto)
@@ -573,10 +1523,10 @@ func ParseHdrLine(buf []byte, offs int, h *Hdr, hb PHBodies) (int, ErrorHdr) {
 				// add the last parsed part to current header content
 				h.Val.Extend(wsProto.LastParsed.EndOffs())
 			}
-			if err == 0 {
-				h.state = hFIN
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
 			}
-			return n, err
+			i = n
 		case hWSockExt: // continue WSockExtensions parsing
 			wsExt := hb.GetWSExt()
 			n, _, err := ParseAllWSExtValues(buf, i, wsExt)
@@ -587,10 +1537,230 @@ func ParseHdrLine(buf []byte, offs int, h *Hdr, hb PHBodies) (int, ErrorHdr) {
 				// add the last parsed part to current header content
 				h.Val.Extend(wsExt.LastParsed.EndOffs())
 			}
-			if err == 0 {
-				h.state = hFIN
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
 			}
-			return n, err
+			i = n
+		case hCDisp: // continue Content-Disposition parsing
+			cd := hb.GetCDisp()
+			n, err := ParseContentDispositionVal(buf, i, cd)
+			if err == 0 { /* fix hdr.Val */
+				h.Val = cd.Val
+			}
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
+			}
+			i = n
+		case hCType: // continue Content-Type parsing
+			ct := hb.GetCType()
+			n, err := ParseContentTypeVal(buf, i, ct)
+			if err == 0 { /* fix hdr.Val */
+				h.Val = ct.Val
+			}
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
+			}
+			i = n
+		case hVary: // continue Vary parsing (multiple vals possible)
+			vary := hb.GetVary()
+			n, _, err := ParseAllVaryValues(buf, i, vary)
+			// fix hdr. Val
+			if h.Val.Empty() {
+				h.Val = vary.LastParsed
+			} else if !vary.LastParsed.Empty() {
+				// add the last parsed part to current header content
+				h.Val.Extend(vary.LastParsed.EndOffs())
+			}
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
+			}
+			i = n
+		case hPragma: // continue Pragma parsing (multiple vals possible)
+			pragma := hb.GetPragma()
+			n, _, err := ParseAllPragmaValues(buf, i, pragma)
+			// fix hdr. Val
+			if h.Val.Empty() {
+				h.Val = pragma.LastParsed
+			} else if !pragma.LastParsed.Empty() {
+				// add the last parsed part to current header content
+				h.Val.Extend(pragma.LastParsed.EndOffs())
+			}
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
+			}
+			i = n
+		case hWarning: // continue Warning parsing (multiple vals possible)
+			warning := hb.GetWarning()
+			n, _, err := ParseAllWarningValues(buf, i, warning)
+			// fix hdr. Val
+			if h.Val.Empty() {
+				h.Val = warning.LastParsed
+			} else if !warning.LastParsed.Empty() {
+				// add the last parsed part to current header content
+				h.Val.Extend(warning.LastParsed.EndOffs())
+			}
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
+			}
+			i = n
+		case hLink: // continue Link parsing (multiple vals possible)
+			link := hb.GetLink()
+			n, _, err := ParseAllLinkValues(buf, i, link)
+			// fix hdr. Val
+			if h.Val.Empty() {
+				h.Val = link.LastParsed
+			} else if !link.LastParsed.Empty() {
+				// add the last parsed part to current header content
+				h.Val.Extend(link.LastParsed.EndOffs())
+			}
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
+			}
+			i = n
+		case hProxyAuthn: // continue Proxy-Authenticate parsing (multiple vals possible)
+			proxyAuthn := hb.GetProxyAuthn()
+			n, _, err := ParseAllAuthChallengeValues(buf, i, proxyAuthn)
+			// fix hdr. Val
+			if h.Val.Empty() {
+				h.Val = proxyAuthn.LastParsed
+			} else if !proxyAuthn.LastParsed.Empty() {
+				// add the last parsed part to current header content
+				h.Val.Extend(proxyAuthn.LastParsed.EndOffs())
+			}
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
+			}
+			i = n
+		case hProxyAuthz: // continue Proxy-Authorization parsing
+			proxyAuthz := hb.GetProxyAuthz()
+			n, err := ParseAuthCredentialsVal(buf, i, proxyAuthz)
+			if err == 0 { /* fix hdr.Val */
+				h.Val = proxyAuthz.V
+			}
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
+			}
+			i = n
+		case hACReqMethod: // continue Access-Control-Request-Method parsing
+			acReqMethod := hb.GetACReqMethod()
+			n, err := ParseACReqMethodVal(buf, i, acReqMethod)
+			if err == 0 { /* fix hdr.Val */
+				h.Val = acReqMethod.Val
+			}
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
+			}
+			i = n
+		case hACReqHdrs: // continue AC-Request-Headers parsing (multiple vals)
+			acReqHdrs := hb.GetACReqHdrs()
+			n, _, err := ParseAllHdrNameValues(buf, i, acReqHdrs)
+			// fix hdr. Val
+			if h.Val.Empty() {
+				h.Val = acReqHdrs.LastParsed
+			} else if !acReqHdrs.LastParsed.Empty() {
+				// add the last parsed part to current header content
+				h.Val.Extend(acReqHdrs.LastParsed.EndOffs())
+			}
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
+			}
+			i = n
+		case hACAllowOrigin: // continue Access-Control-Allow-Origin parsing
+			acAllowOrigin := hb.GetACAllowOrigin()
+			n, err := ParseACAllowOriginVal(buf, i, acAllowOrigin)
+			if err == 0 { /* fix hdr.Val */
+				h.Val = acAllowOrigin.Val
+			}
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
+			}
+			i = n
+		case hACAllowMethods: // continue AC-Allow-Methods parsing (multiple vals)
+			acAllowMethods := hb.GetACAllowMethods()
+			n, _, err := ParseAllMethodValues(buf, i, acAllowMethods)
+			// fix hdr. Val
+			if h.Val.Empty() {
+				h.Val = acAllowMethods.LastParsed
+			} else if !acAllowMethods.LastParsed.Empty() {
+				// add the last parsed part to current header content
+				h.Val.Extend(acAllowMethods.LastParsed.EndOffs())
+			}
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
+			}
+			i = n
+		case hACAllowHdrs: // continue AC-Allow-Headers parsing (multiple vals)
+			acAllowHdrs := hb.GetACAllowHdrs()
+			n, _, err := ParseAllHdrNameValues(buf, i, acAllowHdrs)
+			// fix hdr. Val
+			if h.Val.Empty() {
+				h.Val = acAllowHdrs.LastParsed
+			} else if !acAllowHdrs.LastParsed.Empty() {
+				// add the last parsed part to current header content
+				h.Val.Extend(acAllowHdrs.LastParsed.EndOffs())
+			}
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
+			}
+			i = n
+		case hCLang: // continue Content-Language parsing (multiple vals possible)
+			cLang := hb.GetCLang()
+			n, _, err := ParseAllContentLanguageValues(buf, i, cLang)
+			// fix hdr. Val
+			if h.Val.Empty() {
+				h.Val = cLang.LastParsed
+			} else if !cLang.LastParsed.Empty() {
+				// add the last parsed part to current header content
+				h.Val.Extend(cLang.LastParsed.EndOffs())
+			}
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
+			}
+			i = n
+		case hConnection: // continue Connection parsing (multiple vals possible)
+			conn := hb.GetConn()
+			n, _, err := ParseAllConnectionValues(buf, i, conn)
+			// fix hdr. Val
+			if h.Val.Empty() {
+				h.Val = conn.LastParsed
+			} else if !conn.LastParsed.Empty() {
+				// add the last parsed part to current header content
+				h.Val.Extend(conn.LastParsed.EndOffs())
+			}
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
+			}
+			i = n
+		case hIfRange: // continue If-Range parsing
+			ifRange := hb.GetIfRange()
+			n, err := ParseIfRangeVal(buf, i, ifRange)
+			if err == 0 { /* fix hdr.Val */
+				h.Val = ifRange.Val
+			}
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
+			}
+			i = n
+		case hExpectCT: // continue Expect-CT parsing
+			expectCT := hb.GetExpectCT()
+			n, err := ParseExpectCTVal(buf, i, expectCT)
+			if err == 0 { /* fix hdr.Val */
+				h.Val = expectCT.Val
+			}
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
+			}
+			i = n
+		case hSTS: // continue Strict-Transport-Security parsing
+			sts := hb.GetSTS()
+			n, err := ParseSTSVal(buf, i, sts)
+			if err == 0 { /* fix hdr.Val */
+				h.Val = sts.Val
+			}
+			if n, err = valEnd(n, err); h.state != hBodyStart {
+				return n, err
+			}
+			i = n
 		default: // unexpected state
 			return i, ErrHdrBug
 		}
@@ -599,6 +1769,7 @@ moreBytes:
 	return i, ErrHdrMoreBytes
 endOfHdr:
 	h.state = hFIN
+	h.setRaw(buf, i+crl)
 	return i + crl, 0
 errBadChar:
 errEmptyTok:
@@ -610,34 +1781,113 @@ errEmptyTok:
 // Special error values: ErrHdrMoreBytes - more data needed, call again
 //                       with returned offset and same headers struct.
 //                       ErrHdrEmpty - no headers (empty line found first)
-// See also ParseHdrLine().
+// See also ParseHdrLine(), ParseHeadersFlags() and ParseHeadersCb().
 func ParseHeaders(buf []byte, offs int, hl *HdrLst, hb PHBodies) (int, ErrorHdr) {
+	return parseHeaders(buf, offs, hl, hb, 0, nil)
+}
+
+// ParseHeadersFlags is a version of ParseHeaders() that accepts
+// ParseMsg() parsing flags. The flags currently used are:
+//  MsgLenientHdrsF - header lines that cannot be parsed because of
+//   an invalid character (ErrHdrBadChar) are skipped (together with
+//   any folded continuation lines) and counted in hl.Skipped, instead of
+//   aborting the parsing. Malformed framing headers (Content-Length and
+//   Transfer-Encoding) are never skipped.
+//  MsgLegacyWSHdrsF - the obsolete WebSocket draft header names are
+//   recognized (see GetHdrTypeFlags()).
+func ParseHeadersFlags(buf []byte, offs int, hl *HdrLst, hb PHBodies,
+	flags MsgFlags) (int, ErrorHdr) {
+	return parseHeaders(buf, offs, hl, hb, flags, nil)
+}
+
+// ParseHeadersCb is a version of ParseHeaders() that calls cb (if non-nil)
+// for each fully parsed header line, as soon as it is parsed (the header
+// is already added to hl when cb is called).
+// If cb returns false, parsing is stopped and ErrHdrStopped is returned,
+// together with the offset after the last parsed header (parsing can be
+// resumed by calling ParseHeadersCb() again with this offset and the
+// same hl).
+// Note that h points either inside hl.Hdrs or, if hl.Hdrs is full, to
+// a temporary Hdr that is re-used for the next header (so h should not
+// be kept after cb returns).
+func ParseHeadersCb(buf []byte, offs int, hl *HdrLst, hb PHBodies,
+	cb func(h *Hdr) bool) (int, ErrorHdr) {
+	return parseHeaders(buf, offs, hl, hb, 0, cb)
+}
+
+// parseHeaders is the internal version of ParseHeaders(), with both
+// parsing flags and a per header callback (see ParseHeadersFlags() and
+// ParseHeadersCb()).
+func parseHeaders(buf []byte, offs int, hl *HdrLst, hb PHBodies,
+	flags MsgFlags, cb func(h *Hdr) bool) (int, ErrorHdr) {
 
+	if len(buf) > MaxBufSize {
+		return offs, ErrHdrTooBig
+	}
+	var filter HdrFlags
+	if hl.HdrFilter != 0 {
+		filter = hl.HdrFilter | HdrCLenF | HdrTrEncodingF
+	}
+	maxName := hl.MaxNameLen
+	if maxName == 0 {
+		maxName = DefaultMaxHdrNameLen
+	}
 	i := offs
 	for i < len(buf) {
+		if hl.skip != hSkipNone {
+			var ok bool
+			if i, ok = skipHdrLine(buf, i, &hl.skip); !ok {
+				return i, ErrHdrMoreBytes
+			}
+			hl.Skipped++
+			continue
+		}
 		var h *Hdr
 		if hl.N < len(hl.Hdrs) {
 			h = &hl.Hdrs[hl.N]
 		} else {
 			h = &hl.hdr
 		}
-		n, err := ParseHdrLine(buf, i, h, hb)
+		n, err := parseHdrLine(buf, i, h, hb, filter, maxName, flags)
 		switch err {
 		case 0:
+			if hl.PFlags.Test(h.Type) {
+				hl.DupFlags.Set(h.Type)
+			}
 			hl.PFlags.Set(h.Type)
+			if filter != 0 && !filter.Test(h.Type) {
+				// not selected: don't keep it
+				h.Reset()
+				i = n
+				continue
+			}
 			hl.SetHdr(h) // save "shortcut"
+			hl.N++
+			stop := cb != nil && !cb(h)
 			if h == &hl.hdr {
 				hl.hdr.Reset() // prepare it for reuse
 			}
 			i = n
-			hl.N++
+			if stop {
+				return n, ErrHdrStopped
+			}
 			continue
 		case ErrHdrEmpty:
-			if hl.N > 0 {
-				// end of headers
+			hl.EndHdrsOffs = i
+			if hl.PFlags != 0 || hl.Skipped > 0 {
+				// end of headers (some headers were found)
 				return n, 0
 			}
 			return n, err
+		case ErrHdrBadChar:
+			if (flags&MsgLenientHdrsF) == 0 || h.framing(buf, n) {
+				return n, err
+			}
+			// skip over the malformed header line
+			h.Reset()
+			hl.skip = hSkipLine
+			i = n
+			continue
 		case ErrHdrMoreBytes:
 			fallthrough
 		default:
@@ -646,3 +1896,176 @@ func ParseHeaders(buf []byte, offs int, hl *HdrLst, hb PHBodies) (int, ErrorHdr)
 	}
 	return i, ErrHdrMoreBytes
 }
+
+// hdrValAbort cleans up the partial parsing state left in hb by a header
+// value of type t that could not be fully parsed (empty or invalid value),
+// so that the following headers of the same type can still be parsed.
+// If drop is true, the header value is discarded (the header is skipped or
+// kept only as a generic header) and the header is not counted anymore in
+// the corresponding HNo. The list values already added from the header
+// are kept.
+func hdrValAbort(hb PHBodies, t HdrT, drop bool) {
+	if hb == nil {
+		return
+	}
+	hno := func(n *int) {
+		if drop && *n > 0 {
+			*n--
+		}
+	}
+	switch t {
+	case HdrUpgrade:
+		if v := hb.GetUpgrade(); v != nil {
+			hno(&v.HNo)
+			v.tmp.Reset()
+		}
+	case HdrWSockProto:
+		if v := hb.GetWSProto(); v != nil {
+			hno(&v.HNo)
+			v.tmp.Reset()
+		}
+	case HdrWSockExt:
+		if v := hb.GetWSExt(); v != nil {
+			hno(&v.HNo)
+			v.tmp.Reset()
+		}
+	case HdrContentDisposition:
+		if v := hb.GetCDisp(); v != nil && !v.Parsed() {
+			v.Reset()
+		}
+	case HdrContentType:
+		if v := hb.GetCType(); v != nil && !v.Parsed() {
+			v.Reset()
+		}
+	case HdrVary:
+		if v := hb.GetVary(); v != nil {
+			hno(&v.HNo)
+			v.tmp.Reset()
+		}
+	case HdrPragma:
+		if v := hb.GetPragma(); v != nil {
+			hno(&v.HNo)
+			v.hValState = hValState{}
+		}
+	case HdrWarning:
+		if v := hb.GetWarning(); v != nil {
+			hno(&v.HNo)
+			v.tmp.Reset()
+			v.state = warnInit
+		}
+	case HdrLink:
+		if v := hb.GetLink(); v != nil {
+			hno(&v.HNo)
+			v.tmp.Reset()
+			v.param.Reset()
+			v.state = lnkInit
+		}
+	case HdrProxyAuthenticate:
+		if v := hb.GetProxyAuthn(); v != nil {
+			hno(&v.HNo)
+			v.tmp.Reset()
+			v.hValState = hValState{}
+		}
+	case HdrProxyAuthorization:
+		if v := hb.GetProxyAuthz(); v != nil && !v.Parsed() {
+			v.Reset()
+		}
+	case HdrACReqMethod:
+		if v := hb.GetACReqMethod(); v != nil && !v.Parsed() {
+			v.Reset()
+		}
+	case HdrACReqHeaders:
+		if v := hb.GetACReqHdrs(); v != nil {
+			hno(&v.HNo)
+			v.tmp.Reset()
+		}
+	case HdrACAllowOrigin:
+		if v := hb.GetACAllowOrigin(); v != nil && !v.Parsed() {
+			v.Reset()
+		}
+	case HdrACAllowMethods:
+		if v := hb.GetACAllowMethods(); v != nil {
+			hno(&v.HNo)
+			v.tmp.Reset()
+		}
+	case HdrACAllowHeaders:
+		if v := hb.GetACAllowHdrs(); v != nil {
+			hno(&v.HNo)
+			v.tmp.Reset()
+		}
+	case HdrContentLanguage:
+		if v := hb.GetCLang(); v != nil {
+			hno(&v.HNo)
+			v.tmp.Reset()
+		}
+	case HdrConnection:
+		if v := hb.GetConn(); v != nil {
+			hno(&v.HNo)
+			v.tmp.Reset()
+		}
+	case HdrIfRange:
+		if v := hb.GetIfRange(); v != nil && !v.Parsed() {
+			v.Reset()
+		}
+	case HdrExpectCT:
+		if v := hb.GetExpectCT(); v != nil && !v.Parsed() {
+			v.Reset()
+		}
+	case HdrSTS:
+		if v := hb.GetSTS(); v != nil && !v.Parsed() {
+			v.Reset()
+		}
+	}
+}
+
+// header line skipping states (MsgLenientHdrsF)
+const (
+	hSkipNone = iota // not skipping
+	hSkipLine        // skipping till the line end (LF)
+	hSkipFold        // after LF, checking for a folded continuation line
+)
+
+// skipHdrLine skips over the rest of a header line (till after the next
+// LF) and any folded continuation lines, starting at offs in buf with the
+// skipping state st.
+// It returns the offset of the next line start and true on success or
+// an offset from which skipping can be resumed and false if more bytes
+// are needed.
+func skipHdrLine(buf []byte, offs int, st *uint8) (int, bool) {
+	i := offs
+	for i < len(buf) {
+		if *st == hSkipLine {
+			for ; i < len(buf) && buf[i] != '\n'; i++ {
+			}
+			if i >= len(buf) {
+				break
+			}
+			i++ // skip LF
+			*st = hSkipFold
+			continue
+		}
+		if buf[i] == ' ' || buf[i] == '\t' {
+			*st = hSkipLine // folded line, skip it too
+			continue
+		}
+		*st = hSkipNone
+		return i, true
+	}
+	return i, false
+}
+
+// framing returns true if a partially parsed header with a parse error at
+// offset e in buf is (or looks like) a message framing header
+// (Content-Length or Transfer-Encoding).
+func (h *Hdr) framing(buf []byte, e int) bool {
+	t := h.Type
+	if t == HdrNone && e >= int(h.Name.Offs) && e <= len(buf) {
+		// error inside the header name: use the partial name
+		n := buf[h.Name.Offs:e]
+		for len(n) > 0 && (n[len(n)-1] == ' ' || n[len(n)-1] == '\t') {
+			n = n[:len(n)-1]
+		}
+		t = GetHdrType(n)
+	}
+	return t == HdrCLen || t == HdrTrEncoding
+}
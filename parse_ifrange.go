@@ -0,0 +1,97 @@
+// Copyright 2021 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+// PIfRange contains a parsed If-Range header value (rfc7233 3.2):
+//
+//	If-Range = entity-tag / HTTP-date
+//
+// If the value is a HTTP-date, IsDate is set and Date contains it.
+// Otherwise ETag contains the entity-tag opaque-tag (including the
+// enclosing quotes) and Weak is set if it had the "W/" prefix (note that
+// a weak entity-tag must not be used by a client in If-Range).
+type PIfRange struct {
+	Val    PField // trimmed value
+	Date   int64  // parsed HTTP-date, seconds since the Unix epoch
+	ETag   PField // opaque-tag, quotes included
+	Weak   bool   // weak entity-tag ("W/" prefix)
+	IsDate bool   // the value is a HTTP-date and not an entity-tag
+	hValState
+}
+
+// Reset re-initializes the parsed value and internal parsing state.
+func (r *PIfRange) Reset() {
+	*r = PIfRange{}
+}
+
+// Empty returns true if nothing was parsed yet.
+func (r *PIfRange) Empty() bool {
+	return r.state == hvInit && r.Val.Empty()
+}
+
+// Parsed returns true if the value is fully parsed.
+func (r *PIfRange) Parsed() bool {
+	return !r.Val.Empty()
+}
+
+// ParseIfRangeVal parses an If-Range header value, starting at offs in
+// buf and filling r. It automatically detects if the value is an
+// entity-tag (quoted, possibly with a "W/" prefix) or a HTTP-date
+// (see ParseHTTPDate()).
+// It returns a new offset pointing after the part that was parsed and
+// an error.
+// It can return ErrHdrMoreBytes if more data is needed (the value is not
+// fully contained in buf). In this case it should be called again
+// with the same r and the returned offset, after more bytes were added.
+func ParseIfRangeVal(buf []byte, offs int, r *PIfRange) (int, ErrorHdr) {
+	next, end, err := findHdrValEnd(buf, offs, &r.hValState)
+	if err != 0 {
+		return next, err
+	}
+	start := r.vstart
+	if start < end && (buf[start] == '"' || buf[start] == 'W') {
+		var ok bool
+		if r.ETag, r.Weak, ok = parseETag(buf, start, end); !ok {
+			return start, ErrHdrBadChar
+		}
+	} else {
+		var ok bool
+		if r.Date, ok = ParseHTTPDate(buf[start:end]); !ok {
+			return start, ErrHdrBadChar
+		}
+		r.IsDate = true
+	}
+	r.Val.Set(start, end)
+	return next, 0
+}
+
+// parseETag parses an entity-tag (rfc7232 2.3) that must fill the whole
+// buf[start:end]:
+//
+//	entity-tag = [ "W/" ] DQUOTE *etagc DQUOTE
+//
+// It returns the opaque-tag (with the quotes), whether it is a weak
+// entity-tag and true on success.
+func parseETag(buf []byte, start, end int) (PField, bool, bool) {
+	var tag PField
+	weak := false
+	if end-start > 2 && buf[start] == 'W' && buf[start+1] == '/' {
+		weak = true
+		start += 2
+	}
+	if end-start < 2 || buf[start] != '"' || buf[end-1] != '"' {
+		return tag, false, false
+	}
+	for _, c := range buf[start+1 : end-1] {
+		// etagc = %x21 / %x23-7E / obs-text
+		if c < 0x21 || c == '"' || c == 0x7f {
+			return tag, false, false
+		}
+	}
+	tag.Set(start, end)
+	return tag, weak, true
+}
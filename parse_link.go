@@ -0,0 +1,314 @@
+// Copyright 2021 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+import (
+	"github.com/intuitivelabs/bytescase"
+)
+
+// LinkVal contains a parsed Link value (rfc8288 3):
+// "<" URI-Reference ">" *( OWS ";" OWS link-param ).
+type LinkVal struct {
+	V        PField      // complete link-value
+	Target   PField      // target URI, without the angle brackets
+	AllPrms  PField      // complete parameters string
+	ParamsNo int         // number of parameters
+	Params   []PTokParam // slice to be filled with parsed params
+	Rel      PField      // "rel" parameter value, without quotes
+	Type     PField      // "type" parameter value, without quotes
+	Title    PField      // "title" parameter value, without quotes
+}
+
+// Reset re-initializes the parsed value (keeping the Params slice).
+func (v *LinkVal) Reset() {
+	params := v.Params
+	*v = LinkVal{}
+	v.Params = params
+}
+
+// GetParam returns the value of the first parameter with the given name
+// (case insensitive), without quotes and true, or an empty PField and false
+// if not found.
+// Only the parameters that fit in Params are searched.
+func (v *LinkVal) GetParam(buf []byte, name []byte) (PField, bool) {
+	return getTokParam(buf, v.Params, v.ParamsNo, name)
+}
+
+// setParam adds a new parsed parameter.
+func (v *LinkVal) setParam(buf []byte, p *PTokParam) {
+	if v.ParamsNo < len(v.Params) {
+		v.Params[v.ParamsNo] = *p
+	}
+	v.ParamsNo++
+	if v.AllPrms.Empty() {
+		v.AllPrms = p.All
+	} else {
+		v.AllPrms.Extend(p.All.EndOffs())
+	}
+	v.V.Extend(p.All.EndOffs())
+	n := p.Name.Get(buf)
+	val, _ := unquotePField(buf, p.Val)
+	switch {
+	case len(n) == 3 && bytescase.CmpEq(n, []byte("rel")):
+		if v.Rel.Empty() { // only the first occurrence is used
+			v.Rel = val
+		}
+	case len(n) == 4 && bytescase.CmpEq(n, []byte("type")):
+		v.Type = val
+	case len(n) == 5 && bytescase.CmpEq(n, []byte("title")):
+		v.Title = val
+	}
+}
+
+// PLink contains the parsed Link header values for one or more
+// different headers (all the link-values in the message that fit in the
+// parsed value array).
+type PLink struct {
+	Vals []LinkVal // parsed link-values
+	N    int       // no of  _values_ found, can be >len(Vals)
+	HNo  int       // no of different Link _headers_ found
+	// parsed hdr content during the last ParseAll... call
+	// (contains a trimmed value or several values, overwritten by each
+	//  ParseAll.. call; it can also be empty, e.g. on ErrHdrMoreByte)
+	LastParsed PField
+	tmp        LinkVal   // temporary saved state (between calls)
+	first      LinkVal   // even if Vals is nil, we remember the first val.
+	param      PTokParam // current parameter parsing state
+	state      uint8     // internal parsing state
+}
+
+// VNo returns the number of parsed Link values.
+func (l *PLink) VNo() int {
+	if l.N > len(l.Vals) {
+		return len(l.Vals)
+	}
+	return l.N
+}
+
+// GetLink returns the requested parsed link-value or nil.
+func (l *PLink) GetLink(n int) *LinkVal {
+	if l.VNo() > n {
+		return &l.Vals[n]
+	}
+	if l.Empty() {
+		return nil
+	}
+	if n == 0 {
+		return &l.first
+	}
+	return nil
+}
+
+// More returns true if there are more values that did not fit in Vals.
+func (l *PLink) More() bool {
+	return l.N > len(l.Vals)
+}
+
+// Reset re-initializes the parsed values.
+func (l *PLink) Reset() {
+	for i := 0; i < l.VNo(); i++ {
+		l.Vals[i].Reset()
+	}
+	v := l.Vals
+	*l = PLink{}
+	l.Vals = v
+}
+
+// Init initializes the parsed Link values buf from an array.
+func (l *PLink) Init(valbuf []LinkVal) {
+	l.Vals = valbuf
+}
+
+// Empty returns true if no Link values have been parsed.
+func (l *PLink) Empty() bool {
+	return l.N == 0
+}
+
+// Parsed returns true if there are some parsed Link values.
+func (l *PLink) Parsed() bool {
+	return l.N > 0
+}
+
+// internal Link parser states
+const (
+	lnkInit    uint8 = iota // look for link-value start
+	lnkTarget               // inside <target>
+	lnkFParams              // look for ';', ',' or end of header
+	lnkParam                // inside parameters
+	lnkFNxt                 // ',' found, look for the next value start
+)
+
+// ParseAllLinkValues tries to parse all the values in a Link header
+// situated at offs in buf and adds them to the passed PLink values.
+// The return values are: a new offset after the parsed value (that can be
+// used to continue parsing), the number of header values parsed and an error.
+// It can return ErrHdrMoreBytes if more data is needed (the value is not
+// fully contained in buf).
+// The parameters of each link are saved in the corresponding LinkVal.Params
+// (if pre-allocated).
+func ParseAllLinkValues(buf []byte, offs int, l *PLink) (int, int, ErrorHdr) {
+	var n, crl int
+	var err ErrorHdr
+	var pv *LinkVal
+
+	vNo := 0             // number of values parsed during the current call
+	l.LastParsed.Reset() // clear LastParsed on each call
+	if l.N < len(l.Vals) {
+		pv = &l.Vals[l.N]
+	} else {
+		pv = &l.tmp
+	}
+	i := offs
+	for i < len(buf) {
+		c := buf[i]
+		switch l.state {
+		case lnkInit, lnkFNxt, lnkFParams:
+			switch c {
+			case ' ', '\t', '\r', '\n':
+				n, crl, err = skipLWS(buf, i, 0)
+				if err == 0 {
+					i = n
+					continue
+				}
+				if err == ErrHdrEOH {
+					goto endOfHdr
+				}
+				if err == ErrHdrMoreBytes {
+					goto moreBytes
+				}
+				goto errBad
+			case ',':
+				if l.state == lnkFParams {
+					pv = l.addVal(pv, vNo)
+					vNo++
+					l.state = lnkFNxt
+				}
+				// else skip over extra ','
+			case '<':
+				if l.state == lnkFParams {
+					err = ErrHdrBadChar
+					goto errBad
+				}
+				pv.V.Set(i, i+1)
+				pv.Target.Set(i+1, i+1)
+				l.state = lnkTarget
+			case ';':
+				if l.state != lnkFParams {
+					err = ErrHdrBadChar
+					goto errBad
+				}
+				l.param.Reset()
+				l.state = lnkParam
+			default:
+				err = ErrHdrBadChar
+				goto errBad
+			}
+		case lnkTarget:
+			switch c {
+			case '>':
+				pv.Target.Extend(i)
+				pv.V.Extend(i + 1)
+				l.state = lnkFParams
+			case '<', '"', ' ', '\t', '\r', '\n':
+				err = ErrHdrBadChar
+				goto errBad
+			default:
+				if !tokAllowedChar(c) {
+					err = ErrHdrBadChar
+					goto errBad
+				}
+			}
+		case lnkParam:
+			n, err = ParseTokenParam(buf, i, &l.param, PTokCommaSepF)
+			if err == ErrHdrMoreBytes {
+				i = n
+				goto moreBytes
+			}
+			switch err {
+			case ErrHdrOk, ErrHdrMoreValues, ErrHdrEOH:
+				if !l.param.All.Empty() {
+					pv.setParam(buf, &l.param)
+				}
+			default:
+				i = n
+				goto errBad
+			}
+			l.param.Reset()
+			switch err {
+			case ErrHdrMoreValues:
+				// n points to the next param start
+				i = n
+				continue
+			case ErrHdrOk:
+				// n points to the ',' separator
+				pv = l.addVal(pv, vNo)
+				vNo++
+				l.state = lnkFNxt
+				i = n
+			case ErrHdrEOH:
+				// n points after the end of header
+				l.addVal(pv, vNo)
+				vNo++
+				l.state = lnkInit
+				return n, vNo, 0
+			}
+		default:
+			return i, vNo, ErrHdrBug
+		}
+		i++
+	}
+moreBytes:
+	return i, vNo, ErrHdrMoreBytes
+endOfHdr:
+	// here i will point to first WS char (including CR & LF)
+	//      n will point to the line end (CR or LF)
+	//      crl will contain the line end length (1 or 2)
+	switch l.state {
+	case lnkInit:
+		// end of header without finding a value
+		return n + crl, vNo, ErrHdrEmpty
+	case lnkFNxt:
+		// do nothing (allow trailing ',')
+	case lnkFParams:
+		l.addVal(pv, vNo)
+		vNo++
+	default:
+		err = ErrHdrBad
+		i = n
+		goto errBad
+	}
+	l.state = lnkInit
+	return n + crl, vNo, 0
+errBad:
+	pv.Reset()
+	l.param.Reset()
+	l.state = lnkInit
+	return i, vNo, err
+}
+
+// addVal adds the current parsed value (pv) to the parsed values list
+// and returns a pointer to the next value to be filled.
+// vNo is the number of values parsed during the current
+// ParseAllLinkValues call.
+func (l *PLink) addVal(pv *LinkVal, vNo int) *LinkVal {
+	if vNo == 0 {
+		l.LastParsed = pv.V
+	} else {
+		l.LastParsed.Extend(pv.V.EndOffs())
+	}
+	l.N++
+	if l.N == 1 && len(l.Vals) == 0 {
+		l.first = *pv
+	}
+	if pv == &l.tmp {
+		l.tmp.Reset() // prepare for next value (cleanup tmp state)
+	}
+	if l.N < len(l.Vals) {
+		return &l.Vals[l.N]
+	}
+	return &l.tmp
+}
@@ -59,6 +59,29 @@ func (m HTTPMethod) String() string {
 	return string(m.Name())
 }
 
+// AllMethods returns a newly allocated slice with all the known (numeric)
+// HTTP methods, in increasing order (MUndef and MOther are not included).
+func AllMethods() []HTTPMethod {
+	m := make([]HTTPMethod, 0, MOther-MUndef-1)
+	for i := MUndef + 1; i < MOther; i++ {
+		m = append(m, i)
+	}
+	return m
+}
+
+// MethodFlags packs several HTTPMethod values into bit flags.
+type MethodFlags uint16
+
+// Set sets the flag corresponding to the passed method.
+func (f *MethodFlags) Set(m HTTPMethod) {
+	*f |= 1 << m
+}
+
+// Test returns true if the flag corresponding to the passed method is set.
+func (f MethodFlags) Test(m HTTPMethod) bool {
+	return (f & (1 << m)) != 0
+}
+
 // GetMethodNo converts from an ASCII SIP method name to the corresponding
 // numeric internal value.
 func GetMethodNo(buf []byte) HTTPMethod {
@@ -6,7 +6,9 @@
 
 package httpsp
 
-import ()
+import (
+	"github.com/intuitivelabs/bytescase"
+)
 
 // PHTTPMsg contains a fully or partially parsed HTTP message.
 // If the message is not fully contained in the passed input, the internal
@@ -19,12 +21,40 @@ type PMsg struct {
 	HL        HdrLst   // headers
 	Body      PField   // message body, empty if parsing body not requested
 	LastChunk ChunkVal // last parsed body chunk "header" if chunked encoding
+	// BodySegments contains the data parts of the chunks of a chunked
+	// body (without the chunked framing), in order, if MsgDecodeChunkedF
+	// was used. The decoded body is the concatenation of all the segments.
+	// The segments are appended, so a slice with enough capacity can be
+	// set before parsing to avoid allocations.
+	// Note that ResetState() keeps the backing array, while Init() and
+	// Reset() clear it.
+	BodySegments []PField
 	// Data slice (copy of the original slice passed as parameter to
 	// the parsing function). Parsed values will point inside it.
 	// Note that the actual message starts at Buf[initial_used_offset], which
 	// might be different from Buf[0]
 	Buf    []byte
 	RawMsg []byte // raw message data (points to parsed message: RawMsg[0:])
+	// PrevMethod should be set to the corresponding request method when
+	// parsing a reply (if known). It is used to determine the body type
+	// (see BodyType()). Note that Init() and Reset() will clear it.
+	PrevMethod HTTPMethod
+	// NoBodyMethods contains the request methods for which a body is not
+	// accepted (ErrHdrUnexpectedBody is returned by ParseMsg() if a
+	// request has a non-zero Content-Length or a Transfer-Encoding).
+	// By default it's empty (the RFC allows a body on any request).
+	// Note that Init() and Reset() will clear it.
+	NoBodyMethods MethodFlags
+	// MaxChunks limits the number of chunks (not counting the final
+	// zero-length chunk) in a chunked body (ErrHdrTooManyChunks is returned
+	// if exceeded). 0 means no limit.
+	// Note that Init() and Reset() will clear it.
+	MaxChunks int
+	// MaxChunkLineLen limits the length of a chunk-size line, including
+	// the chunk extensions and the CRLF (ErrHdrValTooLong is returned if
+	// exceeded, without waiting for the line end). 0 means no limit.
+	// Note that Init() and Reset() will clear it.
+	MaxChunkLineLen int
 
 	// minimum space for headers containing headers broken into name: val
 	// (used by default inside HL if not initialised with a bigger value)
@@ -44,15 +74,37 @@ func (m *PMsg) Reset() {
 	m.PMsgIState = PMsgIState{}
 }
 
+// ResetState re-initializes the internal parsing state and the parsed
+// values, so that a message can be parsed again from the start (e.g. to
+// retry parsing over the same buffer or for re-using the PMsg on the same
+// connection).
+// Unlike Reset(), which clears everything, it keeps the backing arrays
+// (msg.HL.Hdrs, the value arrays set in msg.PV, the token parameter
+// lists and msg.BodySegments) and the configuration: msg.Buf,
+// msg.PrevMethod, msg.NoBodyMethods, msg.MaxChunks, msg.MaxChunkLineLen,
+// msg.HL.HdrFilter and msg.HL.MaxNameLen.
+func (m *PMsg) ResetState() {
+	m.FL.Reset()
+	m.PV.Reset()
+	m.HL.Reset()
+	m.Body.Reset()
+	m.LastChunk.Reset()
+	m.BodySegments = m.BodySegments[:0]
+	m.RawMsg = nil
+	m.PMsgIState = PMsgIState{}
+}
+
 // Init initializes a PMsg with a new message and an empty array for
 // holding the parsed headers.
 // If the parsed headers array is nil, the default 10-elements private
-// array will be used instead (PMsg.hdrs)
+// array will be used instead (PMsg.hdrs). A non-nil array will be cleared
+// (so that it can be safely re-used).
 func (m *PMsg) Init(msg []byte, hdrs []Hdr) {
 	m.Reset()
 	m.Buf = msg
 	if hdrs != nil {
 		m.HL.Hdrs = hdrs
+		m.HL.Reset()
 	} else {
 		m.HL.Hdrs = m.hdrs[:]
 	}
@@ -61,20 +113,60 @@ func (m *PMsg) Init(msg []byte, hdrs []Hdr) {
 // Parsed returns true if the message is fully parsed and no more
 // input is needed (including the body if body parsing was requested).
 func (m *PMsg) Parsed() bool {
-	return m.state == MsgFIN
+	return m.state == MsgFIN || m.state == MsgTunnel
 }
 
 // ParsedHdrs returns true if the headers are fully parsed.
 func (m *PMsg) ParsedHdrs() bool {
-	return m.state == MsgFIN || m.state == MsgBodyCLen ||
-		m.state == MsgBodyChunked || m.state == MsgBodyChunkedData ||
+	return m.state == MsgFIN || m.state == MsgTunnel ||
+		m.state == MsgBodyCLen || m.state == MsgBodyChunked || m.state == MsgBodyChunkedData ||
 		m.state == MsgBodyEOF ||
 		m.state == MsgNoBody || m.state == MsgBodyInit
 }
 
+// HeadersDoneBodyPending returns true if the headers are fully parsed and
+// the parsing is inside the message body, but the body end was not yet
+// reached (more input is needed).
+func (m *PMsg) HeadersDoneBodyPending() bool {
+	return m.state == MsgBodyCLen || m.state == MsgBodyChunked ||
+		m.state == MsgBodyChunkedData || m.state == MsgBodyEOF
+}
+
+// NeedsMoreData returns true if the message is incomplete and its end is
+// delimited inside the message itself (first line, headers, a
+// Content-Length body or a chunked body): parsing should be resumed
+// after more bytes are read and a connection close before that means a
+// truncated message.
+// It returns false for a body delimited by the connection close (see
+// WaitingForEOF()), for fully parsed or failed messages and for messages
+// on which parsing was stopped on purpose (MsgStopAfterHdrsF).
+func (m *PMsg) NeedsMoreData() bool {
+	return m.state == MsgFLine || m.state == MsgHeaders ||
+		m.state == MsgBodyCLen || m.state == MsgBodyChunked ||
+		m.state == MsgBodyChunkedData
+}
+
+// WaitingForEOF returns true if the headers are fully parsed and the body
+// extends till the connection is closed (MsgBodyEOF).
+// In this case ParseMsg() returns ErrHdrMoreBytes for as long as more
+// data can be received, but there is no natural message end: the
+// message is complete when the connection is closed (parse once more
+// with MsgNoMoreDataF to finish it).
+func (m *PMsg) WaitingForEOF() bool {
+	return m.state == MsgBodyEOF
+}
+
+// InTunnel returns true if the message is a fully parsed 2xx reply to a
+// CONNECT request (msg.PrevMethod set to MConnect before parsing): the
+// connection switched to tunnel mode and all the data following the
+// message headers should be blindly forwarded (see IsTunnelEstablished()).
+func (m *PMsg) InTunnel() bool {
+	return m.state == MsgTunnel
+}
+
 // Err returns true if parsing failed.
 func (m *PMsg) Err() bool {
-	return m.state == MsgErr
+	return m.state == MsgErr || m.state == MsgNoCLen
 }
 
 // Request returns true if the message is a HTTP request
@@ -91,6 +183,450 @@ func (m *PMsg) Method() HTTPMethod {
 	return MUndef
 }
 
+// MethodBytes returns the request method exactly as found in the request
+// line (method names are case-sensitive, rfc7231 4.1), for any method,
+// including the ones not known (MOther, for which Method().Name() would
+// return "OTHER"). It can be used when forwarding a request.
+// For replies or if the first line was not parsed yet it returns nil.
+// The returned slice points inside m.Buf and should not be modified.
+func (m *PMsg) MethodBytes() []byte {
+	if !m.Request() || m.FL.Method.Empty() {
+		return nil
+	}
+	return m.FL.Method.Get(m.Buf)
+}
+
+// IsInterim returns true if the message is an informational (1xx) interim
+// reply, that will be followed by the final reply (e.g. 100 Continue or
+// 103 Early Hints). 101 Switching Protocols is not considered interim,
+// since it is the last HTTP/1.x reply on the connection.
+// Interim replies never have a body (see BodyType()), so a client
+// expecting a final reply should call ParseMsg() in a loop, skipping over
+// the interim replies:
+//  for {
+//  	o, err = ParseMsg(buf, o, &msg, flags)
+//  	if err != 0 || !msg.IsInterim() {
+//  		break
+//  	}
+//  	msg.ResetState()
+//  }
+// (see also ParseMsgSkipInterim()).
+func (m *PMsg) IsInterim() bool {
+	return !m.Request() && m.FL.Status >= 100 && m.FL.Status <= 199 &&
+		m.FL.Status != 101
+}
+
+// continueResponse is the interim reply sent by a server before reading
+// the body of a request containing "Expect: 100-continue".
+const continueResponse = "HTTP/1.1 100 Continue\r\n\r\n"
+
+// BuildContinueResponse returns a new byte slice containing the canonical
+// "100 Continue" interim reply (rfc7231 5.1.1).
+// A server receiving a HTTP/1.1 request with an "Expect: 100-continue"
+// header should send it before reading the request body (unless it
+// already decided to reject the request), otherwise the client might
+// wait before sending the body. The Expect header has no type of its own
+// (HdrOther), so a possible pattern is:
+//  o, err = ParseMsg(buf, o, &msg, flags|MsgStopAfterHdrsF)
+//  if err == 0 && msg.FL.VerMajor == 1 && msg.FL.VerMinor >= 1 {
+//  	for _, h := range msg.HL.GetHdrs(HdrOther) {
+//  		if bytescase.CmpEq(h.Name.Get(msg.Buf), []byte("expect")) &&
+//  			bytescase.CmpEq(h.Val.Get(msg.Buf), []byte("100-continue")) {
+//  			conn.Write(BuildContinueResponse())
+//  			break
+//  		}
+//  	}
+//  }
+//  // continue parsing the body
+//  o, err = ParseMsg(buf, o, &msg, flags)
+func BuildContinueResponse() []byte {
+	return []byte(continueResponse)
+}
+
+// BodyStart returns the offset in m.Buf of the first body byte (immediately
+// after the empty line ending the headers) or -1 if the headers are not
+// yet parsed.
+// It is valid as soon as the headers are parsed (ParsedHdrs()), even if
+// the body is not parsed (e.g. MsgSkipBodyF or MsgStopAfterHdrsF) or if
+// the message has no body (in this case m.Body is empty).
+// The body start inside RawMsg is RawMsg[BodyStart()-(len(Buf)-len(RawMsg)):]
+// (RawMsg ends where Buf ends).
+func (m *PMsg) BodyStart() int {
+	if !m.ParsedHdrs() {
+		return -1
+	}
+	return m.bodyOffs
+}
+
+// NextOffset returns the offset in the parsed buffer where the next
+// message begins (directly after the current message) or -1 if the
+// message is not fully parsed (Parsed() is false).
+// It is equal to the offset returned by the ParseMsg() call that
+// completed the message (see ParseMsg() for pipelined messages).
+func (m *PMsg) NextOffset() int {
+	if !m.Parsed() {
+		return -1
+	}
+	return len(m.Buf)
+}
+
+// DeclaredBodyLen returns the body length declared in the headers and the
+// body framing kind (see BodyType()), without parsing or skipping the body.
+// It can be used as soon as the headers are parsed (ParsedHdrs()), e.g.
+// with MsgSkipBodyF or MsgStopAfterHdrsF. It uses m.PrevMethod for replies.
+// The returned length is:
+//  - the Content-Length value for MsgBodyCLen
+//  - 0 for MsgNoBody (this includes an established tunnel, see
+//    IsTunnelEstablished(), since everything following the headers belongs
+//    to the tunnel, as in SkipBody())
+//  - -1 if the body length is not known in advance (MsgBodyChunked or
+//    MsgBodyEOF)
+// If the headers are not yet parsed, it returns -1 and MsgErr.
+func (m *PMsg) DeclaredBodyLen() (int64, MsgPState) {
+	if !m.ParsedHdrs() {
+		return -1, MsgErr
+	}
+	if m.IsTunnelEstablished(m.PrevMethod) {
+		return 0, MsgNoBody
+	}
+	bt := m.BodyType(m.PrevMethod)
+	switch bt {
+	case MsgBodyCLen:
+		return int64(m.PV.CLen.UIVal), bt
+	case MsgNoBody:
+		return 0, bt
+	}
+	return -1, bt
+}
+
+// HasIllegalBodyHeaders returns true if the message is a reply that is
+// not allowed to have Content-Length or Transfer-Encoding headers, but
+// has at least one of them: 1xx and 204 replies and 2xx replies to
+// CONNECT (m.PrevMethod), see rfc7230 3.3.1 & 3.3.2.
+// Such replies never have a body (see BodyType()), so the headers are
+// ignored when parsing, but a different parser might not ignore them.
+// Note that 304 replies and replies to HEAD are allowed to have them
+// (they indicate the values for the corresponding GET reply).
+// With MsgStrictF, ParseMsg() rejects such replies (ErrHdrBadFraming).
+func (m *PMsg) HasIllegalBodyHeaders() bool {
+	if m.Request() || !m.HL.PFlags.Any(HdrCLen, HdrTrEncoding) {
+		return false
+	}
+	s := m.FL.Status
+	return (s >= 100 && s <= 199) || s == 204 ||
+		(m.PrevMethod == MConnect && s >= 200 && s <= 299)
+}
+
+// FramingEqual returns true if m and other have the same structure:
+// same parsing state, first line (method, request target, status code and
+// version), headers (types, names compared case insensitive and values)
+// and body (the same body content). The messages can be parsed from
+// different buffers and can differ in the raw formatting (e.g. white space
+// or line terminators): only the parsed values are compared, not the
+// offsets or the raw bytes.
+// It is intended for comparing the results of different parse runs on the
+// same input (e.g. in tests).
+func (m *PMsg) FramingEqual(other *PMsg) bool {
+	if m.state != other.state || m.Request() != other.Request() {
+		return false
+	}
+	b1, b2 := m.Buf, other.Buf
+	fl1, fl2 := &m.FL, &other.FL
+	if fl1.VerMajor != fl2.VerMajor || fl1.VerMinor != fl2.VerMinor ||
+		fl1.HTTP09 != fl2.HTTP09 || fl1.Status != fl2.Status ||
+		fl1.MethodNo != fl2.MethodNo ||
+		string(fl1.Method.Get(b1)) != string(fl2.Method.Get(b2)) ||
+		string(fl1.URI.Get(b1)) != string(fl2.URI.Get(b2)) {
+		return false
+	}
+	if !m.ParsedHdrs() {
+		return true // nothing more to compare
+	}
+	hl1, hl2 := &m.HL, &other.HL
+	if hl1.N != hl2.N || hl1.PFlags != hl2.PFlags ||
+		hl1.DupFlags != hl2.DupFlags {
+		return false
+	}
+	for i := 0; i < hl1.N && i < len(hl1.Hdrs) && i < len(hl2.Hdrs); i++ {
+		h1, h2 := &hl1.Hdrs[i], &hl2.Hdrs[i]
+		if h1.Type != h2.Type || h1.Name.Len != h2.Name.Len ||
+			!bytescase.CmpEq(h1.Name.Get(b1), h2.Name.Get(b2)) ||
+			string(h1.Val.Get(b1)) != string(h2.Val.Get(b2)) {
+			return false
+		}
+	}
+	return string(m.Body.Get(b1)) == string(other.Body.Get(b2))
+}
+
+// CLenHdrCount returns the number of Content-Length header lines in the
+// message (the header values must be parsed, as done by ParseMsg()).
+// More than one Content-Length header is suspicious (possible request
+// smuggling attempt), even if all the values are identical.
+func (m *PMsg) CLenHdrCount() int {
+	return m.PV.CLen.HNo
+}
+
+// TrEncHdrCount returns the number of Transfer-Encoding header lines in
+// the message (the header values must be parsed, as done by ParseMsg()).
+// More than one Transfer-Encoding header is suspicious (see also
+// MsgStrictF).
+func (m *PMsg) TrEncHdrCount() int {
+	return m.PV.TrEnc.HNo
+}
+
+// ChunkedComplete returns true if the message has a chunked body and the
+// whole body was parsed, including the final zero-length chunk and the
+// trailer. It returns false if the body is not chunked, if the body is
+// not yet fully parsed, if it was not parsed (MsgSkipBodyF) or if it was
+// truncated (e.g. the connection was closed before the last chunk and
+// MsgNoMoreDataF was used, in which case ParseMsg() does not return an
+// error).
+func (m *PMsg) ChunkedComplete() bool {
+	return m.lastCnk
+}
+
+// MergeTrailers adds the trailer headers of a fully parsed chunked body
+// (m.LastChunk.TrailerHdrs) to the message headers (m.HL), so that they
+// can be accessed in the same way as the other headers. Trailer headers
+// that are not allowed in a trailer (see HdrTrailerForbiddenF) are ignored.
+// The trailers are added after the headers, so in case a header type
+// appears in both the header section and the trailer, the header section
+// takes precedence (m.HL.GetHdr() returns the first header). All of them
+// are returned by m.HL.GetHdrs(), in order. The trailer values are not
+// parsed into m.PV.
+// It is called automatically by ParseMsg() and SkipBody() if
+// MsgMergeTrailersF is set. It returns the number of merged headers
+// (0 if the message is not fully parsed, it has no chunked body or the
+// trailers were already merged).
+func (m *PMsg) MergeTrailers() int {
+	var h Hdr
+	if !m.lastCnk || m.trMerged {
+		return 0
+	}
+	m.trMerged = true
+	merged := 0
+	for o := m.LastChunk.trOffs; o < len(m.Buf); {
+		h.Reset()
+		n, err := ParseHdrLine(m.Buf, o, &h, nil)
+		if err != 0 {
+			break // ErrHdrEmpty: end of trailer
+		}
+		o = n
+		if HdrTrailerForbiddenF.Test(h.Type) {
+			continue
+		}
+		if m.HL.PFlags.Test(h.Type) {
+			m.HL.DupFlags.Set(h.Type)
+		}
+		m.HL.PFlags.Set(h.Type)
+		if m.HL.N < len(m.HL.Hdrs) {
+			m.HL.Hdrs[m.HL.N] = h
+		}
+		m.HL.SetHdr(&h)
+		m.HL.N++
+		merged++
+	}
+	return merged
+}
+
+// RawFirstLine returns the raw request or status line, without the line
+// terminator (CRLF). It returns nil if the first line is not yet parsed
+// (or if there is no first line, e.g. for a HTTP/0.9 simple response).
+func (m *PMsg) RawFirstLine() []byte {
+	if !m.FL.Parsed() {
+		return nil
+	}
+	var start, end int
+	if m.Request() {
+		start = int(m.FL.Method.Offs)
+		if m.FL.HTTP09 {
+			end = m.FL.URI.EndOffs()
+		} else {
+			end = m.FL.Version.EndOffs()
+		}
+	} else {
+		if m.FL.Version.Empty() {
+			return nil // HTTP/0.9 simple response
+		}
+		start = int(m.FL.Version.Offs)
+		end = m.FL.Reason.EndOffs()
+	}
+	if end > len(m.Buf) {
+		return nil
+	}
+	return m.Buf[start:end]
+}
+
+// RawHeaders returns the raw headers block: all the bytes between the
+// first line end and the body start (including the empty line ending the
+// headers). It returns nil if the headers are not yet parsed.
+func (m *PMsg) RawHeaders() []byte {
+	if !m.ParsedHdrs() || m.bodyOffs > len(m.Buf) {
+		return nil
+	}
+	return m.Buf[m.hdrsOffs:m.bodyOffs]
+}
+
+// HasHeader returns true if a header of type t was found in the message.
+// For HdrOther it returns true if any not specially recognized header
+// was found.
+func (m *PMsg) HasHeader(t HdrT) bool {
+	return m.HL.PFlags.Test(t)
+}
+
+// HasHeaderName returns true if a header with the given name (case
+// insensitive) was found in the message.
+// For not specially recognized headers (HdrOther) only the headers that
+// fit in m.HL.Hdrs are searched.
+// It should be called only after the headers are parsed (it uses m.Buf).
+func (m *PMsg) HasHeaderName(name []byte) bool {
+	if t := GetHdrType(name); t != HdrOther {
+		return m.HasHeader(t)
+	}
+	for _, h := range m.OtherHeaders() {
+		if int(h.Name.Len) == len(name) &&
+			bytescase.CmpEq(h.Name.Get(m.Buf), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// OtherHeaders returns all the headers not specially recognized by the
+// parser (Type == HdrOther), including duplicates, in message order.
+// Only the headers that fit in m.HL.Hdrs are returned.
+func (m *PMsg) OtherHeaders() []*Hdr {
+	return m.HL.GetHdrs(HdrOther)
+}
+
+// IsTunnelEstablished returns true if the message is a 2xx reply to a
+// CONNECT request (prevMethod), meaning that the connection switches to
+// tunnel mode immediately after the headers (RFC 7231 section 4.3.6).
+// In this case ParseMsg() will stop after the headers (with an empty body),
+// if msg.PrevMethod was set to MConnect before parsing, and all the data
+// following the returned offset should be blindly forwarded. After
+// parsing, InTunnel() can be used instead (no prevMethod needed).
+func (m *PMsg) IsTunnelEstablished(prevMethod HTTPMethod) bool {
+	return !m.Request() && prevMethod == MConnect &&
+		m.FL.Status >= 200 && m.FL.Status <= 299
+}
+
+// IsWebSocketUpgradeRequest returns true if the message is a valid
+// WebSocket opening handshake request (rfc6455 4.1): a GET request with
+// "Upgrade: websocket", "Connection: Upgrade", a valid Sec-WebSocket-Key
+// and "Sec-WebSocket-Version: 13".
+// It should be called only after the headers are parsed (it uses m.Buf).
+func (m *PMsg) IsWebSocketUpgradeRequest() bool {
+	if !m.Request() || m.FL.MethodNo != MGet || !m.wsUpgrade() {
+		return false
+	}
+	key := m.HL.GetHdr(HdrWSockKey)
+	ver := m.HL.GetHdr(HdrWSockVer)
+	if key.Missing() || ver.Missing() {
+		return false
+	}
+	// the key must be a base64 encoded 16 bytes value
+	return isBase64(key.Val.Get(m.Buf), 16) &&
+		string(ver.Val.Get(m.Buf)) == "13"
+}
+
+// IsWebSocketUpgradeResponse returns true if the message is a valid
+// WebSocket opening handshake response (rfc6455 4.2.2): a 101 reply with
+// "Upgrade: websocket", "Connection: Upgrade" and a Sec-WebSocket-Accept
+// header (the accept value is only checked for the correct format and not
+// against the request key).
+// It should be called only after the headers are parsed (it uses m.Buf).
+func (m *PMsg) IsWebSocketUpgradeResponse() bool {
+	if m.Request() || m.FL.Status != 101 || !m.wsUpgrade() {
+		return false
+	}
+	accept := m.HL.GetHdr(HdrWSockAccept)
+	if accept.Missing() {
+		return false
+	}
+	// the accept value is a base64 encoded SHA-1 hash (20 bytes)
+	return isBase64(accept.Val.Get(m.Buf), 20)
+}
+
+// wsUpgrade returns true if the message contains both "Upgrade: websocket"
+// and "Connection: Upgrade".
+func (m *PMsg) wsUpgrade() bool {
+	return m.PV.Upgrade.Offers(UProtoWSockF) &&
+		m.PV.Conn.Has(ConnUpgradeF)
+}
+
+// ConnectionHas returns true if token (case insensitive) is one of the
+// Connection header values (in any of the Connection headers), e.g.
+// "close", "upgrade" or a header name.
+// For the known options (see ConnOptResolve()) the parsed values in
+// m.PV.Conn are used. For other tokens, or if the Connection values were
+// not parsed, the Connection headers in m.HL are scanned (only the ones
+// that fit in m.HL.Hdrs). It does not allocate.
+// It should be called only after the headers are parsed (it uses m.Buf).
+func (m *PMsg) ConnectionHas(token []byte) bool {
+	if !m.HL.PFlags.Test(HdrConnection) || len(token) == 0 {
+		return false
+	}
+	if m.PV.Conn.Parsed() {
+		if o := ConnOptResolve(token); o != ConnOtherF {
+			return m.PV.Conn.Has(o)
+		}
+	}
+	n := m.HL.N
+	if n > len(m.HL.Hdrs) {
+		n = len(m.HL.Hdrs)
+	}
+	found := false
+	for i := 0; i < n && !found; i++ {
+		h := &m.HL.Hdrs[i]
+		if h.Type != HdrConnection {
+			continue
+		}
+		ParseHdrTokenList(m.Buf, h, PTokCommaSepF, func(tok PToken) bool {
+			v := tok.V.Get(m.Buf)
+			found = len(v) == len(token) && bytescase.CmpEq(v, token)
+			return !found
+		})
+	}
+	return found
+}
+
+// ShouldCloseAfter returns true if the connection cannot be re-used for
+// another HTTP message after this one (rfc7230 6.3, 6.6), i.e.:
+//  - the message contains a "close" Connection option
+//  - HTTP/1.0 (or older) messages without a "keep-alive" Connection option
+//  - replies with a body delimited by the connection close (MsgBodyEOF,
+//    e.g. HTTP/1.0 replies without Content-Length)
+//  - requests with an undeterminable body length (see BodyType())
+//  - messages after which the connection switches to a different protocol
+//    (2xx replies to CONNECT and 101 Switching Protocols replies): in this
+//    case the connection is closed when the other protocol ends
+// prevMethod is the request method when checking a reply (see
+// BodyType()). Note that when checking a reply, a "close" option in the
+// corresponding request should also be taken into account (the caller
+// should check the request too).
+// It should be called only after the headers are parsed (it uses m.Buf).
+func (m *PMsg) ShouldCloseAfter(prevMethod HTTPMethod) bool {
+	if m.FL.HTTP09 || m.ConnectionHas([]byte("close")) {
+		return true
+	}
+	if m.FL.VerMajor < 1 || (m.FL.VerMajor == 1 && m.FL.VerMinor == 0) {
+		// persistent connections are not the default for HTTP/1.0
+		if !m.ConnectionHas([]byte("keep-alive")) {
+			return true
+		}
+	}
+	if !m.Request() &&
+		(m.FL.Status == 101 || m.IsTunnelEstablished(prevMethod)) {
+		return true
+	}
+	switch m.BodyType(prevMethod) {
+	case MsgBodyEOF, MsgErr:
+		return true
+	}
+	return false
+}
+
 // BodyType returns the way the body is delimited.
 // Parameters: prevMethod - previous request method if this is a reply
 // (use MUndef if not known, but note that replies to HEAD & CONNECT need to
@@ -121,8 +657,7 @@ func (m *PMsg) BodyType(prevMethod HTTPMethod) MsgPState {
 	// Transfer-Encoding has priority over Content-Length
 	if m.HL.PFlags&HdrTrEncodingF != 0 {
 		// if Transfer-Encoding present and chunked transfer coding
-		if m.PV.TrEnc.Encodings&TrEncChunkedF != 0 &&
-			m.PV.TrEnc.Last.Enc == TrEncChunkedF {
+		if m.PV.TrEnc.ChunkedIsFinal() {
 			//  check if "chunked" is the final coding else
 			//       fallback
 			return MsgBodyChunked
@@ -134,7 +669,8 @@ func (m *PMsg) BodyType(prevMethod HTTPMethod) MsgPState {
 		} else {
 			// request => no reliable way to determine body end
 			// theoretically the servers should close connection
-			return MsgBodyEOF // TODO: or maybe better MsgErr
+			// (rejected by ParseMsg() with MsgStrictF)
+			return MsgBodyEOF
 		}
 	}
 
@@ -151,10 +687,38 @@ func (m *PMsg) BodyType(prevMethod HTTPMethod) MsgPState {
 	return MsgBodyEOF
 }
 
+// addBodySegment adds the chunk data between start and end to
+// m.BodySegments.
+func (m *PMsg) addBodySegment(start, end int) {
+	var seg PField
+	seg.Set(start, end)
+	m.BodySegments = append(m.BodySegments, seg)
+}
+
+// noCLenBody returns true if the message is a request with a body that
+// is not delimited by Content-Length (chunked or till connection end).
+func (m *PMsg) noCLenBody() bool {
+	if !m.Request() {
+		return false
+	}
+	bt := m.BodyType(m.PrevMethod)
+	return bt == MsgBodyChunked || bt == MsgBodyEOF
+}
+
 // HTTPMsgIState holds the internal parsing state
 type PMsgIState struct {
-	state MsgPState
-	offs  int
+	state    MsgPState
+	offs     int
+	hdrsOffs int  // headers start offset (valid after parsing the 1st line)
+	bodyOffs int  // body start offset (valid after parsing the headers)
+	lastCnk  bool // last chunk (zero-length) and trailer fully parsed
+	trMerged bool // trailer headers merged into HL
+	cnkNo    int  // number of parsed chunks (no last chunk)
+	cnkOffs  int  // start offset of the current chunk-size line
+	// statistics (see Stats())
+	lastOffs int       // offset returned by the last ParseMsg() call
+	resumes  int       // number of ErrHdrMoreBytes returned by ParseMsg()
+	bodyType MsgPState // body type, set when starting to parse the body
 }
 
 type MsgPState uint8
@@ -171,18 +735,72 @@ const (
 	MsgBodyChunkedData // skipping over the chunk data
 	MsgBodyEOF         // parsing body till connection is closed
 	MsgErr
-	MsgNoCLen // no Content-Length and Content-Length required
+	MsgNoCLen // no Content-Length, but required (see MsgRequireCLenF)
+	MsgTunnel // fully parsed 2xx reply to CONNECT, tunnel follows
 	MsgFIN    // fully parsed
 )
 
+// MsgFlags contains parsing flags for ParseMsg() (MsgXxxF values).
+type MsgFlags uint32
+
 // Parsing flags for ParseMsg()
 
 const (
 	// don't parse the body (return offset = body start)
-	MsgSkipBodyF   = 1 << iota
-	MsgNoMoreDataF // no more message data (e.g EOF), stop at end of buf
+	MsgSkipBodyF MsgFlags = 1 << iota
+	// no more message data (e.g EOF), stop at end of buf
+	MsgNoMoreDataF
+	// strict parsing: reject messages that are valid, but ambiguous
+	// (e.g. multiple Transfer-Encoding headers)
+	MsgStrictF
+	// stop after the headers (return offset = body start), leaving the
+	// parsing state at the body start, so that a later ParseMsg() or
+	// SkipBody() call (without this flag) would continue with the body
+	MsgStopAfterHdrsF
+	// lenient parsing: ignore empty lines (CRLF) before the first line
+	// (rfc7230 3.5) and accept status codes with 1 to 5 digits
+	MsgLenientF
+	// stop after the first line (return offset = headers start), leaving
+	// the parsing state at the headers start (MsgHeaders), so that a later
+	// ParseMsg() call (without this flag) would continue with the headers
+	MsgStopAfterFLineF
+	// accept HTTP/0.9 simple requests (request line without version, no
+	// headers and no body) and simple responses (no status line and no
+	// headers, only a body till connection close), see PFLine.HTTP09
+	MsgAllowHTTP09F
+	// reject HTTP/1.1 requests without a Host header (ErrHdrMissingHost)
+	// and requests with more than one Host header (ErrHdrMultiHost),
+	// see rfc7230 5.4
+	MsgRequireHostF
+	// skip header lines with invalid characters instead of failing,
+	// counting them in HL.Skipped (the first line and the Content-Length
+	// and Transfer-Encoding headers are still parsed strictly),
+	// see ParseHeadersFlags()
+	MsgLenientHdrsF
+	// add the chunked body trailer headers to msg.HL (see
+	// PMsg.MergeTrailers())
+	MsgMergeTrailersF
+	// reject requests with a body that is not delimited by a
+	// Content-Length header (chunked or till connection end) with
+	// ErrHdrNoCLen (the message state is set to MsgNoCLen)
+	MsgRequireCLenF
+	// don't parse the trailer headers of a chunked body, just skip over
+	// them (msg.LastChunk.TrailerHdrs remains empty, see ParseChunkFlags())
+	MsgSkipTrailersF
+	// remove the leading and trailing whitespace from the reply reason
+	// phrase (msg.FL.Reason)
+	MsgTrimReasonF
+	// recognize the obsolete WebSocket draft header names (e.g.
+	// Sec-WebSocket-Origin), see GetHdrTypeFlags()
+	MsgLegacyWSHdrsF
+	// record the chunk data parts of a chunked body in msg.BodySegments
+	MsgDecodeChunkedF
 )
 
+// MsgServerDefaultsF contains the recommended ParseMsg() flags for
+// parsing requests on the server side.
+const MsgServerDefaultsF = MsgLenientF | MsgRequireHostF
+
 // ParseMsg parses a HTTP 1.x message contained in buf[], starting at
 // offset offs. If the parsing requires more data (ErrHdrMoreBytes),
 // this function should be called again with an extended buf containing the
@@ -192,30 +810,191 @@ const (
 // On success the offset points to the first byte after the message.
 // If no more input data is available (buf contains everything, e.g. EOF on
 // connection) pass the MsgNoMoreDataF flag.
+// When parsing replies, msg.PrevMethod should be set to the request method
+// (if known). For 2xx replies to CONNECT the parsing will stop after the
+// headers and the message state will be set to MsgTunnel (see InTunnel()
+// and IsTunnelEstablished()).
+// If MsgStrictF is set, replies with control characters in the reason
+// phrase or with a status code outside the 100-599 range and requests
+// with a fragment in the request target or with an unknown or malformed
+// HTTP version (e.g. HTTP/99.99, see ParseFLineFlags()) will be rejected
+// with ErrHdrBadChar and messages with more than
+// one Transfer-Encoding header line with ErrHdrBadTrEnc (the number of
+// Transfer-Encoding headers is available in msg.PV.TrEnc.HNo also in
+// non-strict mode). In strict mode requests with a Transfer-Encoding
+// header, but with a final transfer coding different from "chunked", are
+// rejected with ErrHdrBadFraming (the body length cannot be determined),
+// as are replies that are not allowed to have Content-Length or
+// Transfer-Encoding headers, but have them (see HasIllegalBodyHeaders())
+// and HTTP/1.0 messages with a Transfer-Encoding header (not defined
+// for HTTP/1.0).
+// Requests using one of the methods in msg.NoBodyMethods and having
+// a body (non-zero Content-Length or Transfer-Encoding) are rejected with
+// ErrHdrUnexpectedBody.
+// If MsgLenientF is set, empty lines before the first line are ignored
+// (and not included in msg.RawMsg) and reply status codes with 1 to 5
+// digits are accepted (see ParseFLineFlags()).
+// If MsgRequireHostF is set (part of MsgServerDefaultsF), HTTP/1.1
+// requests without a Host header are rejected with ErrHdrMissingHost and
+// requests with more than one Host header with ErrHdrMultiHost.
+// If MsgAllowHTTP09F is set, HTTP/0.9 simple requests ("GET /path" CRLF)
+// are accepted and, when parsing replies (msg.PrevMethod set), input
+// that does not start with "HTTP/" is treated as a simple response
+// (msg.FL.Status set to 200, body till connection end). In both cases
+// msg.FL.HTTP09 will be set.
+// If MsgLenientHdrsF is set, header lines with invalid characters are
+// skipped and counted in msg.HL.Skipped (see ParseHeadersFlags()).
+// If MsgMergeTrailersF is set, the allowed trailer headers of a chunked
+// body are added to msg.HL (see PMsg.MergeTrailers()).
+// If MsgRequireCLenF is set, requests with a body framed as chunked or
+// as ending with the connection (Transfer-Encoding present) are rejected
+// with ErrHdrNoCLen and the message state is set to MsgNoCLen.
+// If MsgSkipTrailersF is set, the trailer headers of a chunked body are
+// skipped without being parsed into msg.LastChunk.TrailerHdrs.
+// If MsgTrimReasonF is set, the leading and trailing whitespace is removed
+// from the reply reason phrase (msg.FL.Reason).
+// If MsgLegacyWSHdrsF is set, the header names used by old WebSocket
+// drafts are mapped to the corresponding header types (see
+// GetHdrTypeFlags()).
+// If MsgDecodeChunkedF is set, the data parts of the chunks of a chunked
+// body are added to msg.BodySegments (see SkipBody()).
+// Buffers bigger than MaxBufSize are not supported (ErrHdrTooBig).
+// To parse several pipelined messages contained in the same buffer,
+// ParseMsg() should be called again with the returned offset (see also
+// NextOffset()), but only after resetting msg (Reset() or ResetState()).
+// Calling it for an already fully parsed message returns ErrHdrBug and
+// leaves msg unchanged.
 //  Note that a reference to buf[] will be "saved" inside msg.Buf when
-// parsing is complete.
-func ParseMsg(buf []byte, offs int, msg *PMsg, flags uint8) (int, ErrorHdr) {
+// the first line and the headers are parsed and when parsing is complete.
+func ParseMsg(buf []byte, offs int, msg *PMsg, flags MsgFlags) (int, ErrorHdr) {
 	var err ErrorHdr
 	var o = offs
+	if len(buf) > MaxBufSize {
+		err = ErrHdrTooBig
+		goto errTooBig
+	}
+retry:
 	switch msg.state {
 	case MsgInit:
-		msg.offs = offs
+		if (flags & MsgLenientF) != 0 {
+			// skip over empty lines before the first line
+			o, err = skipEmptyLines(buf, o)
+			if err == 0 && o >= len(buf) {
+				// first line start not found yet
+				err = ErrHdrMoreBytes
+			}
+			if err != 0 {
+				goto errFL
+			}
+		}
+		msg.offs = o
 		msg.state = MsgFLine
 		fallthrough
 	case MsgFLine:
-		if o, err = ParseFLine(buf, o, &msg.FL); err != 0 {
+		if (flags&MsgAllowHTTP09F) != 0 && msg.PrevMethod != MUndef &&
+			msg.FL.Empty() {
+			// reply expected: check for a HTTP/0.9 simple response
+			if httpVerPrefPart(buf[o:]) {
+				if (len(buf) - o) < len(httpVerPref) {
+					err = ErrHdrMoreBytes
+					goto errFL
+				}
+			} else {
+				// no status line => no headers, body till connection end
+				msg.FL.Status = 200
+				msg.FL.HTTP09 = true
+				msg.FL.VerMajor, msg.FL.VerMinor = 0, 9
+				msg.FL.state = flFIN
+				msg.hdrsOffs = o
+				msg.bodyOffs = o
+				msg.state = MsgBodyInit
+				goto retry
+			}
+		}
+		if o, err = ParseFLineFlags(buf, o, &msg.FL, flags); err != 0 {
 			goto errFL
 		}
+		msg.hdrsOffs = o
+		msg.Buf = buf[0:o] // 1st line available even if the headers are not
+		if msg.FL.HTTP09 {
+			// simple request: no headers and no body
+			msg.bodyOffs = o
+			msg.Body.Set(o, o)
+			msg.state = MsgFIN
+			goto end
+		}
 		msg.state = MsgHeaders
+		if (flags & MsgStopAfterFLineF) != 0 {
+			goto end
+		}
 		fallthrough
 	case MsgHeaders:
 		// TODO: MsgNoMoreDataF support for ParseHeaders ?
-		if o, err = ParseHeaders(buf, o, &msg.HL, &msg.PV); err != 0 {
+		o, err = ParseHeadersFlags(buf, o, &msg.HL, &msg.PV, flags)
+		if err == ErrHdrEmpty {
+			// no headers (e.g. "100 Continue"): valid, empty header section
+			err = 0
+		}
+		if err != 0 {
+			goto errHL
+		}
+		msg.bodyOffs = o
+		msg.Buf = buf[0:o] // headers available even if the body is not
+		if (flags&MsgStrictF) != 0 && msg.PV.TrEnc.HNo > 1 {
+			// multiple Transfer-Encoding header lines: valid according
+			// to the RFC, but proxies disagree on how to combine them
+			err = ErrHdrBadTrEnc
+			goto errHL
+		}
+		if msg.NoBodyMethods != 0 && msg.Request() &&
+			msg.NoBodyMethods.Test(msg.FL.MethodNo) &&
+			(msg.HL.PFlags.Test(HdrTrEncoding) ||
+				(msg.PV.CLen.Parsed() && msg.PV.CLen.UIVal != 0)) {
+			// body on a request method configured as bodiless
+			err = ErrHdrUnexpectedBody
+			goto errHL
+		}
+		if (flags&MsgStrictF) != 0 && msg.Request() &&
+			msg.HL.PFlags.Test(HdrTrEncoding) &&
+			!msg.PV.TrEnc.ChunkedIsFinal() {
+			// request with a non-chunked final transfer coding: the
+			// body length cannot be determined (rfc7230 3.3.3)
+			err = ErrHdrBadFraming
 			goto errHL
 		}
+		if (flags&MsgStrictF) != 0 && msg.HL.PFlags.Test(HdrTrEncoding) &&
+			msg.FL.VerMajor == 1 && msg.FL.VerMinor == 0 {
+			// Transfer-Encoding is not defined for HTTP/1.0: a HTTP/1.0
+			// recipient might ignore it and use a different body length
+			err = ErrHdrBadFraming
+			goto errHL
+		}
+		if (flags&MsgStrictF) != 0 && msg.HasIllegalBodyHeaders() {
+			// framing headers in a reply that cannot have a body
+			err = ErrHdrBadFraming
+			goto errHL
+		}
+		if (flags&MsgRequireHostF) != 0 && msg.Request() {
+			if msg.HL.DupFlags.Test(HdrHost) {
+				err = ErrHdrMultiHost
+				goto errHL
+			}
+			if !msg.HL.PFlags.Test(HdrHost) && msg.FL.VerMajor == 1 &&
+				msg.FL.VerMinor >= 1 {
+				err = ErrHdrMissingHost
+				goto errHL
+			}
+		}
+		if (flags&MsgRequireCLenF) != 0 && msg.noCLenBody() {
+			msg.state = MsgNoCLen
+			return o, ErrHdrNoCLen
+		}
 		msg.state = MsgBodyInit
 		fallthrough
 	case MsgBodyInit:
+		if (flags & MsgStopAfterHdrsF) != 0 {
+			goto end
+		}
 		if (flags & MsgSkipBodyF) != 0 {
 			msg.Body.Set(o, o)
 			goto end
@@ -226,32 +1005,148 @@ func ParseMsg(buf []byte, offs int, msg *PMsg, flags uint8) (int, ErrorHdr) {
 		if o, err = SkipBody(buf, o, msg, flags); err != 0 {
 			goto errBody
 		}
-	case MsgFIN:
-		// already parsed
-		return o, 0
+	case MsgFIN, MsgTunnel:
+		// already parsed: most likely a pipelined message parsed without
+		// resetting msg first => don't touch the previous message
+		return o, ErrHdrBug
+	case MsgNoCLen:
+		return o, ErrHdrNoCLen
 	default:
 		err = ErrHdrBug
 		goto errBUG
 	}
 end:
 	// Body should be set by  SkipBody() or MsgBodyInit & MsgSkipBodyF
+	// (or not set yet for MsgBodyInit & MsgStopAfterHdrsF or
+	//  MsgHeaders & MsgStopAfterFLineF)
 	msg.Buf = buf[0:o]
 	msg.RawMsg = msg.Buf[msg.offs:o]
-	// state when exiting should be: MsgBody*, MsgNoBody* or MsgFIN
+	msg.lastOffs = o
+	// state when exiting should be: MsgHeaders, MsgBody*, MsgNoBody*,
+	// MsgTunnel or MsgFIN
 	return o, 0
 errFL:
 errHL:
 errBody:
 errBUG:
+errTooBig:
 	if err != ErrHdrMoreBytes {
-		msg.state = MsgErr
+		if msg.state != MsgNoCLen {
+			msg.state = MsgErr
+		}
 	} else if (flags & MsgNoMoreDataF) != 0 {
 		//msg.state = MsgErr
 		err = ErrHdrTrunc
+	} else {
+		msg.lastOffs = o
+		msg.resumes++
+	}
+	return o, err
+}
+
+// ParseMsgSkipInterim parses a reply to a request with the method
+// prevMethod, skipping over any interim (1xx) replies preceding the final
+// reply (see IsInterim()), e.g. a "100 Continue" immediately followed by
+// the real reply in the same buffer.
+// The parameters and the return values are the same as for ParseMsg().
+// On success msg contains the first non-interim reply (the interim ones
+// are discarded, see ResetState()) and the returned offset points after
+// it. On ErrHdrMoreBytes it should be called again with the returned
+// offset and the same msg, after more bytes were added to buf.
+func ParseMsgSkipInterim(buf []byte, offs int, msg *PMsg,
+	prevMethod HTTPMethod, flags MsgFlags) (int, ErrorHdr) {
+	o := offs
+	for {
+		msg.PrevMethod = prevMethod
+		n, err := ParseMsg(buf, o, msg, flags)
+		if err != 0 || !msg.IsInterim() {
+			return n, err
+		}
+		// interim reply fully parsed: discard it
+		msg.ResetState()
+		o = n
+	}
+}
+
+// ParseMsgHeadersOnly is a fast version of ParseMsg() that parses only the
+// first line and the headers, for callers that never look at the body
+// (e.g. collecting statistics). It is similar to calling ParseMsg() with
+// MsgStopAfterHdrsF, but without any of the optional checks and
+// without any body handling (BodyType() is never called).
+// On success it returns the offset of the body start (directly after the
+// headers) and msg.state is set to MsgBodyInit (the body can still be
+// parsed later with SkipBody() or ParseMsg()).
+// If it returns ErrHdrMoreBytes, it should be called again with the
+// returned offset and the same msg, after more bytes were added to buf.
+// Note that msg.RawMsg will contain only the first line and the headers.
+func ParseMsgHeadersOnly(buf []byte, offs int, msg *PMsg) (int, ErrorHdr) {
+	var err ErrorHdr
+	o := offs
+	if len(buf) > MaxBufSize {
+		msg.state = MsgErr
+		return o, ErrHdrTooBig
+	}
+	switch msg.state {
+	case MsgInit:
+		msg.offs = o
+		msg.state = MsgFLine
+		fallthrough
+	case MsgFLine:
+		if o, err = ParseFLine(buf, o, &msg.FL); err != 0 {
+			break
+		}
+		msg.hdrsOffs = o
+		msg.Buf = buf[0:o]
+		msg.state = MsgHeaders
+		fallthrough
+	case MsgHeaders:
+		o, err = ParseHeaders(buf, o, &msg.HL, &msg.PV)
+		if err == ErrHdrEmpty {
+			err = 0 // empty header section
+		}
+		if err != 0 {
+			break
+		}
+		msg.bodyOffs = o
+		msg.Buf = buf[0:o]
+		msg.RawMsg = msg.Buf[msg.offs:o]
+		msg.state = MsgBodyInit
+		return o, 0
+	case MsgErr, MsgNoCLen:
+		return o, ErrHdrBug
+	default:
+		// headers already parsed
+		return o, 0
+	}
+	if err != ErrHdrMoreBytes {
+		msg.state = MsgErr
 	}
 	return o, err
 }
 
+// RedactHeaders overwrites the values of all the headers having one of the
+// given types with 'X' in buf (see Hdr.RedactValue()).
+// buf should be a writable copy of the buffer the message was parsed
+// from (e.g. a copy of m.Buf). Only the headers that fit in m.HL.Hdrs are
+// redacted (see HdrLst.Overflowed()).
+// Note that headers without a type of their own (HdrOther) can be
+// redacted by name, using m.HL.GetHdrs(HdrOther) and Hdr.RedactValue().
+func (m *PMsg) RedactHeaders(buf []byte, types ...HdrT) {
+	var f HdrFlags
+	for _, t := range types {
+		f.Set(t)
+	}
+	n := m.HL.N
+	if n > len(m.HL.Hdrs) {
+		n = len(m.HL.Hdrs)
+	}
+	for i := 0; i < n; i++ {
+		if f.Test(m.HL.Hdrs[i].Type) {
+			m.HL.Hdrs[i].RedactValue(buf, 'X')
+		}
+	}
+}
+
 // SkipBody will find the type of the message body and skip over it or
 // "continue" skipping.
 // It requires an initialised message with the headers parsed
@@ -260,7 +1155,14 @@ errBUG:
 // beginning (buf), a current offset in the buffer (returned by a previous
 // SkipBody() or ParseMsg() call), a HTTP parsed message structure with
 // the header parsed (msg) and some parsing flags
-// ( MsgSkipBodyF and MsgNoMoreDataF).
+// ( MsgSkipBodyF, MsgNoMoreDataF, MsgMergeTrailersF, MsgRequireCLenF,
+// MsgSkipTrailersF and MsgDecodeChunkedF).
+// If MsgDecodeChunkedF is set, the data of each chunk is added to
+// msg.BodySegments, as soon as it is fully available (or, with
+// MsgNoMoreDataF, the available part of a truncated chunk).
+// If MsgRequireCLenF is set and the message is a request with a body not
+// delimited by Content-Length (chunked or till connection end), it will
+// return ErrHdrNoCLen and set the message state to MsgNoCLen.
 //
 // It is used internally by ParseMsg if MsgSkipBodyF is not specified.
 //
@@ -269,23 +1171,37 @@ errBUG:
 // function should be called again with the returned offset and an extended
 // buffer (with the original content + additional bytes).
 // On success the offset points to the first byte after the whole message.
-func SkipBody(buf []byte, offs int, msg *PMsg, flags uint8) (int, ErrorHdr) {
+func SkipBody(buf []byte, offs int, msg *PMsg, flags MsgFlags) (int, ErrorHdr) {
 	var o = offs
+	if len(buf) > MaxBufSize {
+		return offs, ErrHdrTooBig
+	}
 retry:
 	switch msg.state {
 	case MsgBodyInit:
 		msg.Body.Set(o, o)
-		msg.state = msg.BodyType(MUndef) // TODO: pass prev req, meth.
-		if msg.state == MsgErr {
-			return o, ErrHdrNoCLen // TODO: better error ?
+		if msg.IsTunnelEstablished(msg.PrevMethod) {
+			// no body, everything after the headers belongs to the tunnel
+			msg.Buf = buf[0:o]
+			msg.RawMsg = msg.Buf[msg.offs:o]
+			msg.state = MsgTunnel
+			return o, 0
+		}
+		if (flags&MsgRequireCLenF) != 0 && msg.noCLenBody() {
+			msg.state = MsgNoCLen
+			return o, ErrHdrNoCLen
 		}
+		msg.state = msg.BodyType(msg.PrevMethod)
+		msg.bodyType = msg.state
 		if msg.state == MsgBodyInit {
 			goto errBUG
 		}
 		goto retry
 	case MsgNoBody:
 		msg.Body.Set(0, 0)
-		// do nothing, end
+		goto end // don't extend the body
+	case MsgNoCLen:
+		return o, ErrHdrNoCLen
 	case MsgBodyCLen:
 		if (flags & MsgSkipBodyF) != 0 {
 			goto end
@@ -325,8 +1241,31 @@ retry:
 			goto end
 		}
 		var err ErrorHdr
-		o, _, err = ParseChunk(buf, o, &msg.LastChunk)
+		if msg.MaxChunkLineLen > 0 && msg.LastChunk.state == sCnkParse {
+			// still parsing the chunk-size line: check its length
+			// (without waiting for the whole line)
+			if msg.LastChunk.Val.Empty() {
+				msg.cnkOffs = o // new chunk-size line start
+			}
+			end := msg.cnkOffs + msg.MaxChunkLineLen
+			if end > len(buf) {
+				end = len(buf)
+			}
+			i := o
+			for ; i < end && buf[i] != '\n'; i++ {
+			}
+			if i == msg.cnkOffs+msg.MaxChunkLineLen {
+				return i, ErrHdrValTooLong
+			}
+		}
+		o, _, err = ParseChunkFlags(buf, o, &msg.LastChunk, flags)
 		if err == 0 {
+			if msg.LastChunk.Size > 0 {
+				if msg.MaxChunks > 0 && msg.cnkNo >= msg.MaxChunks {
+					return o, ErrHdrTooManyChunks
+				}
+				msg.cnkNo++
+			}
 			// skip over chunk body
 			msg.state = MsgBodyChunkedData
 			goto retry
@@ -347,15 +1286,27 @@ retry:
 			}
 			if (flags & MsgNoMoreDataF) != 0 {
 				// allow truncated body (?)
+				if (flags&MsgDecodeChunkedF) != 0 && o < len(buf) &&
+					msg.LastChunk.Size > 0 {
+					end := o + int(msg.LastChunk.Size)
+					if end > len(buf) {
+						end = len(buf)
+					}
+					msg.addBodySegment(o, end)
+				}
 				o = len(buf)
 				goto end
 			}
 			// keep start-of-body offset (we use it on success/full body)
 			return o, ErrHdrMoreBytes
 		}
+		if (flags&MsgDecodeChunkedF) != 0 && msg.LastChunk.Size > 0 {
+			msg.addBodySegment(o, o+int(msg.LastChunk.Size))
+		}
 		o = nxt
 		if msg.LastChunk.Size == 0 {
 			// last chunk (empty) => stop
+			msg.lastCnk = true
 			goto end
 		}
 		// current chunk fully parsed, switch back to parsing chunk headers
@@ -371,6 +1322,9 @@ end:
 	msg.Buf = buf[0:o]
 	msg.RawMsg = msg.Buf[msg.offs:o]
 	msg.state = MsgFIN
+	if msg.lastCnk && (flags&MsgMergeTrailersF) != 0 {
+		msg.MergeTrailers()
+	}
 	return o, 0
 errBUG:
 	return o, ErrHdrBug
@@ -7,7 +7,9 @@
 package httpsp
 
 import (
+	"bytes"
 	"math/rand"
+	"strings"
 	"testing"
 )
 
@@ -116,9 +118,10 @@ type pMsgExpR struct {
 }
 
 type pMsgTestCase struct {
-	hdrs string // header part
-	body string // msg body
-	flgs uint8  // parse flags
+	hdrs string     // header part
+	body string     // msg body
+	flgs MsgFlags   // parse flags
+	prvM HTTPMethod // request method for replies (PMsg.PrevMethod)
 
 	desc string // test description
 	e    pMsgExpR
@@ -143,7 +146,7 @@ Content-Type: text/html\r
 			err:    0,
 			offs:   0, // auto-fill
 			nHdrs:  8,
-			hdrf:   HdrServerF | HdrCLenF | HdrConnectionF | HdrOtherF,
+			hdrf:   HdrServerF | HdrCLenF | HdrConnectionF | HdrContentTypeF | HdrOtherF,
 			status: 200, m: 0,
 			state: MsgFIN,
 		},
@@ -228,7 +231,7 @@ Expires: Sat, 27 Mar 2004 21:12:00 GMT\r
 			err:    0,
 			offs:   0, // auto-fill
 			nHdrs:  4,
-			hdrf:   HdrTrEncodingF | HdrOtherF,
+			hdrf:   HdrTrEncodingF | HdrContentTypeF | HdrOtherF,
 			status: 200, m: 0,
 			state: MsgFIN,
 		},
@@ -290,6 +293,58 @@ chunks.\r
 			state: MsgFIN,
 		},
 	},
+	{
+		hdrs: `HTTP/1.1 103 Early Hints\r
+Link: </style.css>; rel=preload; as=style\r
+Content-Length: 10\r
+`,
+		body: ``,
+		flgs: 0,
+		desc: "103 interim reply (no body allowed)",
+		e: pMsgExpR{
+			err:    0,
+			offs:   0, // auto-fill
+			nHdrs:  2,
+			hdrf:   HdrCLenF | HdrLinkF,
+			status: 103, m: 0,
+			state: MsgFIN,
+		},
+	},
+	{
+		hdrs: `HTTP/1.1 200 Connection established\r
+Proxy-Agent: FooBar\r
+`,
+		body: ``,
+		flgs: 0,
+		prvM: MConnect,
+		desc: "200 reply to CONNECT (tunnel)",
+		e: pMsgExpR{
+			err:    0,
+			offs:   0, // auto-fill
+			nHdrs:  1,
+			hdrf:   HdrOtherF,
+			status: 200, m: 0,
+			state: MsgTunnel,
+		},
+	},
+	{
+		hdrs: `PUT /test3 HTTP/1.1\r
+Transfer-Encoding: gzip\r
+Host: example3.com\r
+Transfer-Encoding: chunked\r
+`,
+		body: ``,
+		flgs: MsgStrictF,
+		desc: "PUT with 2 separate TE headers in strict mode",
+		e: pMsgExpR{
+			err:    ErrHdrBadTrEnc,
+			offs:   0, // auto-fill
+			nHdrs:  3,
+			hdrf:   HdrHostF | HdrTrEncodingF,
+			status: 0, m: MPut,
+			state: MsgErr,
+		},
+	},
 	{
 		hdrs: `HTTP/1.1 200 OK\r
 Date: Sun, 20 Oct 2021 20:20:20 GMT\r
@@ -305,7 +360,7 @@ Content-Type: text/html\r
 			err:    0,
 			offs:   0, // auto-fill
 			nHdrs:  5,
-			hdrf:   HdrServerF | HdrConnectionF | HdrOtherF,
+			hdrf:   HdrServerF | HdrConnectionF | HdrContentTypeF | HdrOtherF,
 			status: 200, m: 0,
 			state: MsgFIN,
 		},
@@ -526,8 +581,13 @@ func testSkipBodyChunkedBlockPieces(t *testing.T, buf []byte, offs, n int) {
 
 func testParseMsg(t *testing.T, buf []byte, offs int, mt *pMsgTestCase) {
 	var msg PMsg
+	msg.PrevMethod = mt.prvM
 
 	o, err := ParseMsg(buf, offs, &msg, mt.flgs)
+	if e := checkMsgInvariants(buf, offs, o, err, &msg); e != nil {
+		t.Errorf("ParseMsg(%q, %d, ... 0x%x) = [ %d, %d (%q)]: %s",
+			buf, offs, mt.flgs, o, err, err, e)
+	}
 	if err != mt.e.err {
 		t.Errorf("ParseMsg(%q, %d, ... 0x%x) = [ %d, %d (%q)]"+
 			" error %q expected",
@@ -569,6 +629,7 @@ func testParseMsg(t *testing.T, buf []byte, offs int, mt *pMsgTestCase) {
 func testParseMsgPieces(t *testing.T, buf []byte, offs int, bodyOffs int,
 	n int, mt *pMsgTestCase) {
 	var msg PMsg
+	msg.PrevMethod = mt.prvM
 
 	o := offs
 	end := o // sent so far
@@ -585,7 +646,7 @@ func testParseMsgPieces(t *testing.T, buf []byte, offs int, bodyOffs int,
 				// force reset MsgNoMoreDataF for this piece
 				// (otherwise we'll end with a body-truncated message if
 				//  the msg has no content-length or chunked tr-enc)
-				flgs &= ^uint8(MsgNoMoreDataF)
+				flgs &= ^MsgNoMoreDataF
 			}
 			o, err = ParseMsg(buf[:end], o, &msg, flgs)
 			if flgs&MsgNoMoreDataF != 0 {
@@ -606,6 +667,10 @@ func testParseMsgPieces(t *testing.T, buf []byte, offs int, bodyOffs int,
 
 	var err ErrorHdr
 	o, err = ParseMsg(buf, o, &msg, mt.flgs)
+	if e := checkMsgInvariants(buf, offs, o, err, &msg); e != nil {
+		t.Errorf("ParseMsg(%q, %d, ... 0x%x) = [ %d, %d (%q)]: %s",
+			buf, offs, mt.flgs, o, err, err, e)
+	}
 	if err != mt.e.err {
 		t.Errorf("ParseMsg(%q, %d, ... 0x%x) = [ %d, %d (%q)]"+
 			" error %q expected",
@@ -643,3 +708,2035 @@ func testParseMsgPieces(t *testing.T, buf []byte, offs int, bodyOffs int,
 			buf, offs, mt.flgs, o, err, err, mt.e.hdrf, msg.HL.PFlags)
 	}
 }
+
+func TestParseMsgStopAfterHdrs(t *testing.T) {
+	for _, mt := range msgTests {
+		if mt.e.err != 0 || mt.flgs != 0 {
+			continue
+		}
+		var msg PMsg
+		msg.PrevMethod = mt.prvM
+		mHdr := unescapeCRLF(mt.hdrs)
+		mB := unescapeCRLF(mt.body)
+		buf := make([]byte, len(mHdr)+2 /* crlf */ +len(mB))
+		copy(buf, mHdr)
+		copy(buf[len(mHdr):], []byte{'\r', '\n'})
+		copy(buf[len(mHdr)+2:], mB)
+		bodyOffs := len(mHdr) + 2
+
+		o, err := ParseMsg(buf, 0, &msg, MsgStopAfterHdrsF)
+		if err != 0 || o != bodyOffs || msg.state != MsgBodyInit {
+			t.Errorf("ParseMsg(%q, 0, ... 0x%x) = [ %d, %d (%q)]"+
+				" state %d, expected [ %d, 0 ] and state %d",
+				buf, MsgStopAfterHdrsF, o, err, err, msg.state,
+				bodyOffs, MsgBodyInit)
+			continue
+		}
+		if !msg.ParsedHdrs() || msg.Parsed() {
+			t.Errorf("ParseMsg(%q, 0, ... 0x%x): unexpected state %d",
+				buf, MsgStopAfterHdrsF, msg.state)
+		}
+		// resume
+		o, err = ParseMsg(buf, o, &msg, 0)
+		if err != 0 || o != len(buf) || msg.state != mt.e.state {
+			t.Errorf("ParseMsg(%q, %d, ... 0) = [ %d, %d (%q)]"+
+				" state %d, expected [ %d, 0 ] and state %d",
+				buf, bodyOffs, o, err, err, msg.state, len(buf),
+				mt.e.state)
+		}
+	}
+}
+
+func TestParseMsgStopAfterFLine(t *testing.T) {
+	for _, mt := range msgTests {
+		if mt.e.err != 0 || mt.flgs != 0 {
+			continue
+		}
+		var msg PMsg
+		msg.PrevMethod = mt.prvM
+		mHdr := unescapeCRLF(mt.hdrs)
+		mB := unescapeCRLF(mt.body)
+		buf := make([]byte, len(mHdr)+2 /* crlf */ +len(mB))
+		copy(buf, mHdr)
+		copy(buf[len(mHdr):], []byte{'\r', '\n'})
+		copy(buf[len(mHdr)+2:], mB)
+		hdrsOffs := bytes.IndexByte(buf, '\n') + 1
+
+		o, err := ParseMsg(buf, 0, &msg, MsgStopAfterFLineF)
+		if err != 0 || o != hdrsOffs || msg.state != MsgHeaders {
+			t.Errorf("ParseMsg(%q, 0, ... 0x%x) = [ %d, %d (%q)]"+
+				" state %d, expected [ %d, 0 ] and state %d",
+				buf, MsgStopAfterFLineF, o, err, err, msg.state,
+				hdrsOffs, MsgHeaders)
+			continue
+		}
+		if msg.ParsedHdrs() || msg.HL.N != 0 ||
+			(mt.e.m > 0 && msg.FL.MethodNo != mt.e.m) ||
+			(mt.e.status > 0 && msg.FL.Status != mt.e.status) {
+			t.Errorf("ParseMsg(%q, 0, ... 0x%x): unexpected state %d,"+
+				" %d headers, method %s, status %d", buf, MsgStopAfterFLineF,
+				msg.state, msg.HL.N, msg.FL.MethodNo, msg.FL.Status)
+		}
+		// resume
+		o, err = ParseMsg(buf, o, &msg, 0)
+		if err != 0 || o != len(buf) || msg.state != mt.e.state {
+			t.Errorf("ParseMsg(%q, %d, ... 0) = [ %d, %d (%q)]"+
+				" state %d, expected [ %d, 0 ] and state %d",
+				buf, hdrsOffs, o, err, err, msg.state, len(buf),
+				mt.e.state)
+		}
+	}
+}
+
+// parse random truncated & mangled messages, checking for panics
+func TestParseMsgNoPanic(t *testing.T) {
+	const chars = "\r\n\t :;,=/\"\\0aZ\x00\xff"
+	parse := func(buf []byte, flags MsgFlags, pieces bool) {
+		defer func() {
+			if r := recover(); r != nil {
+				t.Fatalf("ParseMsg(%q, 0, .., 0x%x) pieces %v: panic: %v",
+					buf, flags, pieces, r)
+			}
+		}()
+		var msg PMsg
+		var o int
+		var err ErrorHdr
+		if pieces {
+			err = ErrHdrMoreBytes
+			for end := 0; end <= len(buf) && err == ErrHdrMoreBytes; {
+				end += 1 + rand.Intn(10)
+				if end > len(buf) {
+					end = len(buf)
+				}
+				o, err = ParseMsg(buf[:end], o, &msg, flags)
+				if end == len(buf) {
+					break
+				}
+			}
+		} else {
+			o, err = ParseMsg(buf, 0, &msg, flags)
+		}
+		if e := checkMsgInvariants(buf, 0, o, err, &msg); e != nil &&
+			!pieces {
+			t.Errorf("ParseMsg(%q, 0, .., 0x%x) = [%d, %d(%q)]: %s",
+				buf, flags, o, err, err, e)
+		}
+	}
+	for _, mt := range msgTests {
+		m := append(unescapeCRLF(mt.hdrs), '\r', '\n')
+		m = append(m, unescapeCRLF(mt.body)...)
+		for i := 0; i < 100; i++ {
+			buf := make([]byte, rand.Intn(len(m)+1))
+			copy(buf, m)
+			for n := rand.Intn(4); n > 0 && len(buf) > 0; n-- {
+				buf[rand.Intn(len(buf))] = chars[rand.Intn(len(chars))]
+			}
+			parse(buf, mt.flgs, false)
+			parse(buf, mt.flgs, true)
+			parse(buf, mt.flgs|MsgNoMoreDataF, false)
+		}
+	}
+	// too big input
+	buf := make([]byte, MaxBufSize+1)
+	copy(buf, "GET / HTTP/1.1\r\nHost: foo.bar\r\n\r\n")
+	var msg PMsg
+	if o, err := ParseMsg(buf, 0, &msg, 0); err != ErrHdrTooBig || o != 0 {
+		t.Errorf("ParseMsg(%d bytes, 0, .., 0) = [%d, %d(%q)],"+
+			" expected %q", len(buf), o, err, err, ErrHdrTooBig)
+	}
+	msg.Reset()
+	if _, err := ParseMsg(buf[:MaxBufSize], 0, &msg, 0); err != 0 {
+		t.Errorf("ParseMsg(%d bytes, 0, .., 0) = %d(%q)",
+			MaxBufSize, err, err)
+	}
+}
+
+func TestParseMsgLeadingCRLF(t *testing.T) {
+	m := "GET / HTTP/1.1\r\nHost: foo.bar\r\n\r\n"
+	for _, pref := range [...]string{"", "\r\n", "\r\n\r\n\n"} {
+		buf := []byte(pref + m)
+		var msg PMsg
+		o, err := ParseMsg(buf, 0, &msg, MsgServerDefaultsF)
+		if err != 0 || o != len(buf) || string(msg.RawMsg) != m ||
+			msg.FL.MethodNo != MGet {
+			t.Errorf("ParseMsg(%q, 0, .., MsgServerDefaultsF) = [%d, %d(%q)]"+
+				" raw msg %q", buf, o, err, err, msg.RawMsg)
+		}
+		// piece-wise
+		msg.Reset()
+		o = 0
+		err = ErrHdrMoreBytes
+		for end := 1; end <= len(buf) && err == ErrHdrMoreBytes; end++ {
+			o, err = ParseMsg(buf[:end], o, &msg, MsgLenientF)
+		}
+		if err != 0 || o != len(buf) || string(msg.RawMsg) != m {
+			t.Errorf("ParseMsg(%q, 0, .., MsgLenientF) pieces ="+
+				" [%d, %d(%q)] raw msg %q", buf, o, err, err, msg.RawMsg)
+		}
+	}
+}
+
+func TestParseMsgHTTP09(t *testing.T) {
+	tests := [...]struct {
+		m     string
+		prvM  HTTPMethod
+		flags MsgFlags
+		err   ErrorHdr
+		end   int // expected offset (-1 for len(m))
+		body  string
+		req   bool
+		h09   bool // expected msg.FL.HTTP09
+	}{
+		{"GET /\r\n", MUndef, 0, 0, -1, "", true, true},
+		{"GET /\r\nGET / HTTP/1.1\r\n", MUndef, 0, 0, 7, "", true, true},
+		{"<html>foo</html>", MGet, MsgNoMoreDataF, 0, -1,
+			"<html>foo</html>", false, true},
+		{"<html>foo</html>", MGet, 0, ErrHdrMoreBytes, 0, "", false, true},
+		{"HTTP/1.0 200 OK\r\nContent-Length: 3\r\n\r\nfoo", MGet, 0, 0, -1,
+			"foo", false, false},
+		{"HTT", MGet, MsgNoMoreDataF, ErrHdrTrunc, 0, "", false, false},
+		{"HT", MGet, MsgNoMoreDataF | MsgSkipBodyF, ErrHdrTrunc, 0, "",
+			false, false},
+	}
+	for i, c := range tests {
+		buf := []byte(c.m)
+		end := c.end
+		if end < 0 {
+			end = len(buf)
+		}
+		for _, pieces := range []bool{false, true} {
+			var msg PMsg
+			var o int
+			var err ErrorHdr
+			msg.PrevMethod = c.prvM
+			flags := c.flags | MsgAllowHTTP09F
+			if pieces {
+				err = ErrHdrMoreBytes
+				for n := 0; n <= len(buf) && err == ErrHdrMoreBytes; n++ {
+					o, err = ParseMsg(buf[:n], o, &msg,
+						flags&^MsgNoMoreDataF)
+				}
+				if err == ErrHdrMoreBytes && (flags&MsgNoMoreDataF) != 0 {
+					o, err = ParseMsg(buf, o, &msg, flags)
+				}
+			} else {
+				o, err = ParseMsg(buf, 0, &msg, flags)
+			}
+			if err != c.err || o != end {
+				t.Errorf("test %d: ParseMsg(%q, 0, .., 0x%x) pieces %v ="+
+					" [%d, %d(%q)], expected [%d, %d(%q)]", i, buf, flags,
+					pieces, o, err, err, end, c.err, c.err)
+				continue
+			}
+			if err != 0 {
+				continue
+			}
+			if msg.Request() != c.req ||
+				string(msg.Body.Get(buf)) != c.body ||
+				msg.FL.HTTP09 != c.h09 {
+				t.Errorf("test %d: ParseMsg(%q, 0, .., 0x%x) pieces %v:"+
+					" request %v, body %q, HTTP09 %v", i, buf, flags,
+					pieces, msg.Request(), msg.Body.Get(buf), msg.FL.HTTP09)
+			}
+		}
+	}
+}
+
+func TestParseMsgWebSocketUpgrade(t *testing.T) {
+	tests := [...]struct {
+		m    string
+		prvM HTTPMethod
+		req  bool // expected IsWebSocketUpgradeRequest()
+		resp bool // expected IsWebSocketUpgradeResponse()
+	}{
+		{"GET /chat HTTP/1.1\r\nHost: server.example.com\r\n" +
+			"Upgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n" +
+			"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+			"Sec-WebSocket-Version: 13\r\n\r\n", MUndef, true, false},
+		// bad key (not 16 bytes)
+		{"GET /chat HTTP/1.1\r\nHost: server.example.com\r\n" +
+			"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Key: dGhlIHNhbXBsZQ==\r\n" +
+			"Sec-WebSocket-Version: 13\r\n\r\n", MUndef, false, false},
+		// bad version
+		{"GET /chat HTTP/1.1\r\nHost: server.example.com\r\n" +
+			"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+			"Sec-WebSocket-Version: 8\r\n\r\n", MUndef, false, false},
+		// no Connection: Upgrade
+		{"GET /chat HTTP/1.1\r\nHost: server.example.com\r\n" +
+			"Upgrade: websocket\r\nConnection: close\r\n" +
+			"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+			"Sec-WebSocket-Version: 13\r\n\r\n", MUndef, false, false},
+		// not GET
+		{"POST /chat HTTP/1.1\r\nHost: server.example.com\r\n" +
+			"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+			"Sec-WebSocket-Version: 13\r\nContent-Length: 0\r\n\r\n",
+			MUndef, false, false},
+		{"HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n" +
+			"Connection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\n\r\n",
+			MGet, false, true},
+		// missing accept
+		{"HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n" +
+			"Connection: Upgrade\r\n\r\n", MGet, false, false},
+		// not 101
+		{"HTTP/1.1 200 OK\r\nUpgrade: websocket\r\n" +
+			"Connection: Upgrade\r\nContent-Length: 0\r\n" +
+			"Sec-WebSocket-Accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\n\r\n",
+			MGet, false, false},
+	}
+	for i, c := range tests {
+		var msg PMsg
+		msg.PrevMethod = c.prvM
+		buf := []byte(c.m)
+		o, err := ParseMsg(buf, 0, &msg, 0)
+		if err != 0 || o != len(buf) {
+			t.Errorf("test %d: ParseMsg(%q, ..) = [%d, %d(%q)]",
+				i, buf, o, err, err)
+			continue
+		}
+		if msg.IsWebSocketUpgradeRequest() != c.req ||
+			msg.IsWebSocketUpgradeResponse() != c.resp {
+			t.Errorf("test %d: %q: ws upgrade request %v, response %v,"+
+				" expected %v, %v", i, buf,
+				msg.IsWebSocketUpgradeRequest(),
+				msg.IsWebSocketUpgradeResponse(), c.req, c.resp)
+		}
+	}
+}
+
+func TestParseMsgLegacyWSHdrs(t *testing.T) {
+	const m = "GET /demo HTTP/1.1\r\nHost: example.com\r\n" +
+		"Connection: Upgrade\r\nUpgrade: WebSocket\r\n" +
+		"Sec-WebSocket-Origin: http://example.com\r\n" +
+		"WebSocket-Protocol: chat, sample\r\n\r\n"
+	for _, flags := range []MsgFlags{0, MsgLegacyWSHdrsF} {
+		legacy := flags != 0
+		var msg PMsg
+		msg.Init(nil, nil)
+		msg.PV.WSProto.Init(make([]WSProtoVal, 4))
+		buf := []byte(m)
+		if o, err := ParseMsg(buf, 0, &msg, flags); err != 0 || o != len(buf) {
+			t.Fatalf("ParseMsg(%q, 0x%x) = [%d, %d(%q)]", buf, flags,
+				o, err, err)
+		}
+		if msg.HasHeader(HdrOrigin) != legacy ||
+			msg.HasHeader(HdrWSockProto) != legacy ||
+			msg.PV.WSProto.Parsed() != legacy ||
+			(len(msg.OtherHeaders()) == 0) != legacy {
+			t.Errorf("ParseMsg(%q, 0x%x): Origin %v, WS Protocol %v (%d vals),"+
+				" other headers %d", buf, flags, msg.HasHeader(HdrOrigin),
+				msg.HasHeader(HdrWSockProto), msg.PV.WSProto.N,
+				len(msg.OtherHeaders()))
+		}
+		if !legacy {
+			continue
+		}
+		h := msg.HL.GetHdr(HdrOrigin)
+		if string(h.Name.Get(buf)) != "Sec-WebSocket-Origin" ||
+			string(h.Val.Get(buf)) != "http://example.com" ||
+			msg.PV.WSProto.N != 2 {
+			t.Errorf("ParseMsg(%q, 0x%x): Origin %q: %q, %d WS protocols",
+				buf, flags, h.Name.Get(buf), h.Val.Get(buf),
+				msg.PV.WSProto.N)
+		}
+	}
+	tests := [...]struct {
+		n      string
+		t      HdrT // with MsgLegacyWSHdrsF
+		strict HdrT // without flags
+	}{
+		{"Sec-WebSocket-Origin", HdrOrigin, HdrOther},
+		{"websocket-origin", HdrOrigin, HdrOther},
+		{"WebSocket-Protocol", HdrWSockProto, HdrOther},
+		{"Sec-WebSocket-Protocol", HdrWSockProto, HdrWSockProto},
+		{"Origin", HdrOrigin, HdrOrigin},
+		{"WebSocket-Location", HdrOther, HdrOther},
+	}
+	for _, c := range tests {
+		n := []byte(c.n)
+		if ht := GetHdrTypeFlags(n, MsgLegacyWSHdrsF); ht != c.t {
+			t.Errorf("GetHdrTypeFlags(%q, MsgLegacyWSHdrsF) = %s,"+
+				" expected %s", n, ht, c.t)
+		}
+		if ht := GetHdrTypeFlags(n, 0); ht != c.strict || GetHdrType(n) != ht {
+			t.Errorf("GetHdrTypeFlags(%q, 0) = %s, GetHdrType() = %s,"+
+				" expected %s", n, ht, GetHdrType(n), c.strict)
+		}
+	}
+}
+
+func TestParseMsgOtherHeaders(t *testing.T) {
+	buf := []byte("GET / HTTP/1.1\r\nHost: foo.bar\r\nX-Foo: 1\r\n" +
+		"Accept: */*\r\nX-Foo: 2\r\nContent-Length: 0\r\nX-Bar: 3\r\n\r\n")
+	exp := [...]string{"X-Foo: 1", "Accept: */*", "X-Foo: 2", "X-Bar: 3"}
+
+	var msg PMsg
+	msg.Init(nil, nil)
+	if o, err := ParseMsg(buf, 0, &msg, 0); err != 0 || o != len(buf) {
+		t.Fatalf("ParseMsg(%q, ..) = [%d, %d(%q)]", buf, o, err, err)
+	}
+	hdrs := msg.OtherHeaders()
+	if len(hdrs) != len(exp) {
+		t.Fatalf("OtherHeaders() returned %d headers, expected %d",
+			len(hdrs), len(exp))
+	}
+	for i, h := range hdrs {
+		if h.Type != HdrOther ||
+			string(h.Name.Get(buf))+": "+string(h.Val.Get(buf)) != exp[i] {
+			t.Errorf("OtherHeaders()[%d] = %q: %q (type %s), expected %q",
+				i, h.Name.Get(buf), h.Val.Get(buf), h.Type, exp[i])
+		}
+	}
+	if n := len(msg.HL.GetHdrs(HdrCLen)); n != 1 {
+		t.Errorf("GetHdrs(HdrCLen) returned %d headers, expected 1", n)
+	}
+	if hdrs := msg.HL.GetHdrs(HdrUpgrade); hdrs != nil {
+		t.Errorf("GetHdrs(HdrUpgrade) returned %d headers, expected nil",
+			len(hdrs))
+	}
+}
+
+func TestParseMsgHasHeader(t *testing.T) {
+	buf := []byte("GET / HTTP/1.1\r\nHost: foo.bar\r\nX-Foo: 1\r\n" +
+		"Content-Length: 0\r\n\r\n")
+	var msg PMsg
+	msg.Init(nil, nil)
+	if o, err := ParseMsg(buf, 0, &msg, 0); err != 0 || o != len(buf) {
+		t.Fatalf("ParseMsg(%q, ..) = [%d, %d(%q)]", buf, o, err, err)
+	}
+	for _, c := range [...]struct {
+		t   HdrT
+		res bool
+	}{
+		{HdrHost, true}, {HdrCLen, true}, {HdrOther, true},
+		{HdrTrEncoding, false}, {HdrUpgrade, false},
+	} {
+		if msg.HasHeader(c.t) != c.res {
+			t.Errorf("HasHeader(%s) = %v, expected %v", c.t, !c.res, c.res)
+		}
+	}
+	for _, c := range [...]struct {
+		n   string
+		res bool
+	}{
+		{"host", true}, {"CONTENT-LENGTH", true}, {"x-foo", true},
+		{"X-Bar", false}, {"Upgrade", false}, {"X-Fo", false},
+	} {
+		if msg.HasHeaderName([]byte(c.n)) != c.res {
+			t.Errorf("HasHeaderName(%q) = %v, expected %v",
+				c.n, !c.res, c.res)
+		}
+	}
+}
+
+func TestParseMsgRequireHost(t *testing.T) {
+	tests := [...]struct {
+		m   string
+		err ErrorHdr // expected error with MsgRequireHostF
+	}{
+		{"GET / HTTP/1.1\r\nHost: foo.bar\r\n\r\n", 0},
+		{"GET / HTTP/1.1\r\nAccept: */*\r\n\r\n", ErrHdrMissingHost},
+		{"GET / HTTP/1.2\r\nAccept: */*\r\n\r\n", ErrHdrMissingHost},
+		{"GET / HTTP/1.0\r\nAccept: */*\r\n\r\n", 0},
+		{"GET / HTTP/1.1\r\nHost: foo.bar\r\nHost: bar.foo\r\n\r\n",
+			ErrHdrMultiHost},
+		{"GET / HTTP/1.0\r\nHost: foo.bar\r\nhost: foo.bar\r\n\r\n",
+			ErrHdrMultiHost},
+		// replies are not checked
+		{"HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n", 0},
+	}
+	for _, c := range tests {
+		buf := []byte(c.m)
+		for _, flags := range []MsgFlags{0, MsgRequireHostF, MsgServerDefaultsF} {
+			var msg PMsg
+			eErr := c.err
+			if flags == 0 {
+				eErr = 0
+			}
+			o, err := ParseMsg(buf, 0, &msg, flags)
+			if err != eErr || (err == 0 && o != len(buf)) {
+				t.Errorf("ParseMsg(%q, 0, .., 0x%x) = [%d, %d(%q)],"+
+					" expected error %q", buf, flags, o, err, err, eErr)
+			}
+		}
+	}
+}
+
+func TestParseMsgStrictReqFraming(t *testing.T) {
+	tests := [...]struct {
+		m   string
+		err ErrorHdr // expected error with MsgStrictF
+	}{
+		{"POST / HTTP/1.1\r\nHost: foo.bar\r\n" +
+			"Transfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n", 0},
+		{"POST / HTTP/1.1\r\nHost: foo.bar\r\n" +
+			"Transfer-Encoding: chunked, gzip\r\n\r\nfoo", ErrHdrBadFraming},
+		{"POST / HTTP/1.1\r\nHost: foo.bar\r\n" +
+			"Transfer-Encoding: identity\r\n\r\nfoo", ErrHdrBadFraming},
+		{"POST / HTTP/1.1\r\nHost: foo.bar\r\nContent-Length: 3\r\n\r\nfoo",
+			0},
+		// replies are delimited by the connection close
+		{"HTTP/1.1 200 OK\r\nTransfer-Encoding: gzip\r\n\r\nfoo", 0},
+		// no Transfer-Encoding in HTTP/1.0
+		{"POST / HTTP/1.0\r\nHost: foo.bar\r\n" +
+			"Transfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+			ErrHdrBadFraming},
+		{"HTTP/1.0 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"0\r\n\r\n", ErrHdrBadFraming},
+		{"HTTP/1.0 200 OK\r\nTransfer-Encoding: gzip\r\n\r\nfoo",
+			ErrHdrBadFraming},
+		{"POST / HTTP/1.0\r\nContent-Length: 3\r\n\r\nfoo", 0},
+		{"HTTP/1.0 200 OK\r\n\r\nfoo", 0},
+	}
+	for _, c := range tests {
+		buf := []byte(c.m)
+		for _, flags := range []MsgFlags{0, MsgStrictF} {
+			var msg PMsg
+			msg.PrevMethod = MPost
+			eErr := c.err
+			if flags == 0 {
+				eErr = 0
+			}
+			o, err := ParseMsg(buf, 0, &msg, flags|MsgNoMoreDataF)
+			if err != eErr || (err == 0 && o != len(buf)) {
+				t.Errorf("ParseMsg(%q, 0, .., 0x%x) = [%d, %d(%q)],"+
+					" expected error %q", buf, flags, o, err, err, eErr)
+			}
+		}
+	}
+}
+
+func TestParseMsgNoBodyMethods(t *testing.T) {
+	tests := [...]struct {
+		m   string
+		err ErrorHdr // expected error with GET & HEAD in NoBodyMethods
+	}{
+		{"GET / HTTP/1.1\r\nHost: foo.bar\r\n\r\n", 0},
+		{"GET / HTTP/1.1\r\nHost: foo.bar\r\nContent-Length: 0\r\n\r\n", 0},
+		{"GET / HTTP/1.1\r\nHost: foo.bar\r\nContent-Length: 3\r\n\r\nfoo",
+			ErrHdrUnexpectedBody},
+		{"HEAD / HTTP/1.1\r\nHost: foo.bar\r\n" +
+			"Transfer-Encoding: chunked\r\n\r\n0\r\n\r\n", ErrHdrUnexpectedBody},
+		{"POST / HTTP/1.1\r\nHost: foo.bar\r\nContent-Length: 3\r\n\r\nfoo",
+			0},
+		{"HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\nfoo", 0},
+	}
+	for _, c := range tests {
+		buf := []byte(c.m)
+		for _, noBody := range []bool{false, true} {
+			var msg PMsg
+			msg.PrevMethod = MGet
+			var eErr ErrorHdr
+			if noBody {
+				msg.NoBodyMethods.Set(MGet)
+				msg.NoBodyMethods.Set(MHead)
+				eErr = c.err
+			}
+			o, err := ParseMsg(buf, 0, &msg, 0)
+			if err != eErr || (err == 0 && o != len(buf)) {
+				t.Errorf("ParseMsg(%q, 0, .., 0) NoBodyMethods 0x%x ="+
+					" [%d, %d(%q)], expected error %q", buf,
+					msg.NoBodyMethods, o, err, err, eErr)
+			}
+		}
+	}
+}
+
+func TestParseMsgBodyStart(t *testing.T) {
+	for _, mt := range msgTests {
+		if mt.e.err != 0 || mt.flgs != 0 {
+			continue
+		}
+		mHdr := unescapeCRLF(mt.hdrs)
+		mB := unescapeCRLF(mt.body)
+		buf := make([]byte, len(mHdr)+2 /* crlf */ +len(mB))
+		copy(buf, mHdr)
+		copy(buf[len(mHdr):], []byte{'\r', '\n'})
+		copy(buf[len(mHdr)+2:], mB)
+		bodyStart := len(mHdr) + 2
+
+		for _, flags := range []MsgFlags{0, MsgSkipBodyF, MsgStopAfterHdrsF,
+			MsgStopAfterFLineF} {
+			var msg PMsg
+			msg.PrevMethod = mt.prvM
+			if msg.BodyStart() != -1 {
+				t.Errorf("BodyStart() = %d before parsing", msg.BodyStart())
+			}
+			_, err := ParseMsg(buf, 0, &msg, flags|MsgNoMoreDataF)
+			if err != 0 {
+				t.Errorf("ParseMsg(%q, 0, ... 0x%x) = %d(%q)",
+					buf, flags, err, err)
+				continue
+			}
+			exp := bodyStart
+			if flags == MsgStopAfterFLineF {
+				exp = -1 // headers not parsed
+			}
+			if msg.BodyStart() != exp {
+				t.Errorf("ParseMsg(%q, 0, ... 0x%x): BodyStart() = %d,"+
+					" expected %d", buf, flags, msg.BodyStart(), exp)
+			}
+			if !msg.Body.Empty() && int(msg.Body.Offs) != exp {
+				t.Errorf("ParseMsg(%q, 0, ... 0x%x): body offset %d,"+
+					" expected %d", buf, flags, msg.Body.Offs, exp)
+			}
+		}
+	}
+}
+
+func TestParseMsgRawHeaders(t *testing.T) {
+	hdrs := "Host: foo.bar\r\nContent-Length: 3\r\n\r\n"
+	buf := []byte("POST / HTTP/1.1\r\n" + hdrs + "foo")
+
+	var msg PMsg
+	if msg.RawHeaders() != nil {
+		t.Errorf("RawHeaders() = %q before parsing", msg.RawHeaders())
+	}
+	// body not complete
+	o, err := ParseMsg(buf[:len(buf)-1], 0, &msg, 0)
+	if err != ErrHdrMoreBytes {
+		t.Fatalf("ParseMsg(%q, ..) = [%d, %d(%q)]", buf, o, err, err)
+	}
+	if string(msg.RawHeaders()) != hdrs {
+		t.Errorf("RawHeaders() = %q, expected %q", msg.RawHeaders(), hdrs)
+	}
+	o, err = ParseMsg(buf, o, &msg, 0)
+	if err != 0 || o != len(buf) {
+		t.Fatalf("ParseMsg(%q, ..) = [%d, %d(%q)]", buf, o, err, err)
+	}
+	if string(msg.RawHeaders()) != hdrs {
+		t.Errorf("RawHeaders() = %q, expected %q", msg.RawHeaders(), hdrs)
+	}
+}
+
+func TestParseMsgRawFirstLine(t *testing.T) {
+	tests := [...]struct {
+		m     string
+		prvM  HTTPMethod
+		flags MsgFlags
+		fl    string
+	}{
+		{"GET /foo?bar HTTP/1.1\r\nHost: foo.bar\r\n\r\n", MUndef, 0,
+			"GET /foo?bar HTTP/1.1"},
+		{"HTTP/1.1 404 Not Found\nContent-Length: 0\r\n\r\n", MGet, 0,
+			"HTTP/1.1 404 Not Found"},
+		{"HTTP/1.1 204 \r\n\r\n", MGet, 0, "HTTP/1.1 204 "},
+		{"GET /foo\r\n", MUndef, MsgAllowHTTP09F, "GET /foo"},
+		{"foo bar", MGet, MsgAllowHTTP09F | MsgNoMoreDataF, ""},
+	}
+	for _, c := range tests {
+		buf := []byte(c.m)
+		var msg PMsg
+		msg.PrevMethod = c.prvM
+		if msg.RawFirstLine() != nil {
+			t.Errorf("RawFirstLine() = %q before parsing", msg.RawFirstLine())
+		}
+		// stop after the first line (headers not parsed)
+		if _, err := ParseMsg(buf, 0, &msg,
+			c.flags|MsgStopAfterFLineF); err != 0 {
+			t.Errorf("ParseMsg(%q, ..) = %d(%q)", buf, err, err)
+			continue
+		}
+		if string(msg.RawFirstLine()) != c.fl {
+			t.Errorf("ParseMsg(%q, ..): RawFirstLine() = %q, expected %q",
+				buf, msg.RawFirstLine(), c.fl)
+		}
+	}
+}
+
+func TestParseMsgChunkedComplete(t *testing.T) {
+	const hdrs = "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n"
+	tests := [...]struct {
+		body     string
+		flags    MsgFlags
+		err      ErrorHdr
+		complete bool
+	}{
+		{"3\r\nfoo\r\n0\r\n\r\n", 0, 0, true},
+		{"3\r\nfoo\r\n0\r\nX-Foo: bar\r\n\r\n", 0, 0, true},
+		{"3\r\nfoo\r\n0\r\n\r\n", MsgSkipBodyF, 0, false},
+		{"3\r\nfoo\r\n0\r\n\r\n", MsgNoMoreDataF, 0, true},
+		{"3\r\nfoo\r\n", 0, ErrHdrMoreBytes, false},
+		{"3\r\nfoo\r\n0\r\n", 0, ErrHdrMoreBytes, false},
+		{"3\r\nfo", MsgNoMoreDataF, 0, false},
+		{"3\r\nfoo\r\n0\r\n\r", MsgNoMoreDataF, ErrHdrTrunc, false},
+		{"", 0, ErrHdrMoreBytes, false},
+	}
+	for _, c := range tests {
+		buf := []byte(hdrs + c.body)
+		var msg PMsg
+		msg.Init(nil, nil)
+		msg.PrevMethod = MGet
+		_, err := ParseMsg(buf, 0, &msg, c.flags)
+		if err != c.err {
+			t.Errorf("ParseMsg(%q, 0, .., 0x%x) = %d(%q), expected %d(%q)",
+				buf, c.flags, err, err, c.err, c.err)
+			continue
+		}
+		if msg.ChunkedComplete() != c.complete {
+			t.Errorf("ParseMsg(%q, 0, .., 0x%x): ChunkedComplete() = %v,"+
+				" expected %v", buf, c.flags, msg.ChunkedComplete(),
+				c.complete)
+		}
+	}
+}
+
+func TestParseMsgDecodeChunked(t *testing.T) {
+	const hdrs = "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n"
+	tests := [...]struct {
+		body  string
+		flags MsgFlags
+		data  string // decoded body
+		segs  int    // expected number of segments
+	}{
+		{"3\r\nfoo\r\n0\r\n\r\n", 0, "foo", 1},
+		{"3;ext=1\r\nfoo\r\na\r\n0123456789\r\n1\r\n\n\r\n" +
+			"0\r\nX-Foo: bar\r\n\r\n", 0, "foo0123456789\n", 3},
+		{"0\r\n\r\n", 0, "", 0},
+		{"3\r\nfoo\r\n5\r\nba", MsgNoMoreDataF, "fooba", 2},
+		{"3\r\nfoo\r\n5\r\nbar\r\n", MsgNoMoreDataF, "foobar\r\n", 2},
+	}
+	for _, c := range tests {
+		buf := []byte(hdrs + c.body)
+		for _, step := range []int{len(buf), 1} {
+			var msg PMsg
+			msg.Init(nil, nil)
+			msg.PrevMethod = MGet
+			var o int
+			var err ErrorHdr
+			for end := step; ; end += step {
+				if end > len(buf) {
+					end = len(buf)
+				}
+				flags := MsgDecodeChunkedF
+				if end == len(buf) {
+					flags |= c.flags
+				}
+				o, err = ParseMsg(buf[:end], o, &msg, flags)
+				if err != ErrHdrMoreBytes || end == len(buf) {
+					break
+				}
+			}
+			if err != 0 || o != len(buf) {
+				t.Errorf("ParseMsg(%q, step %d) = [%d, %d(%q)]",
+					buf, step, o, err, err)
+				continue
+			}
+			var data []byte
+			for _, seg := range msg.BodySegments {
+				data = append(data, seg.Get(buf)...)
+			}
+			if string(data) != c.data || len(msg.BodySegments) != c.segs {
+				t.Errorf("ParseMsg(%q, step %d): decoded body %q"+
+					" (%d segments), expected %q (%d)", buf, step, data,
+					len(msg.BodySegments), c.data, c.segs)
+			}
+		}
+	}
+	// without MsgDecodeChunkedF and re-using the segments array
+	var msg PMsg
+	msg.Init(nil, nil)
+	msg.BodySegments = make([]PField, 0, 4)
+	buf := []byte(hdrs + "3\r\nfoo\r\n0\r\n\r\n")
+	if _, err := ParseMsg(buf, 0, &msg, 0); err != 0 ||
+		len(msg.BodySegments) != 0 {
+		t.Errorf("ParseMsg(%q, 0) = %d(%q), %d segments", buf, err, err,
+			len(msg.BodySegments))
+	}
+	allocs := testing.AllocsPerRun(10, func() {
+		msg.ResetState()
+		ParseMsg(buf, 0, &msg, MsgDecodeChunkedF)
+	})
+	if allocs != 0 || len(msg.BodySegments) != 1 || cap(msg.BodySegments) != 4 {
+		t.Errorf("ParseMsg(%q, MsgDecodeChunkedF): %v allocs, %d segments,"+
+			" capacity %d", buf, allocs, len(msg.BodySegments),
+			cap(msg.BodySegments))
+	}
+}
+
+func TestParseMsgChunkLimits(t *testing.T) {
+	const hdrs = "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n"
+	tests := [...]struct {
+		body       string
+		maxChunks  int
+		maxLineLen int
+		err        ErrorHdr
+	}{
+		{"1\r\na\r\n1\r\nb\r\n0\r\n\r\n", 0, 0, 0},
+		{"1\r\na\r\n1\r\nb\r\n0\r\n\r\n", 2, 0, 0},
+		{"1\r\na\r\n1\r\nb\r\n1\r\nc\r\n0\r\n\r\n", 2, 0,
+			ErrHdrTooManyChunks},
+		{"1\r\na\r\n1\r\nb\r\n1\r\nc", 2, 0, ErrHdrTooManyChunks},
+		{"1\r\na\r\n0\r\n\r\n", 0, 5, 0},
+		{"1;a=b\r\na\r\n0;c\r\n\r\n", 0, 7, 0},
+		{"1;a=b\r\na\r\n0\r\n\r\n", 0, 6, ErrHdrValTooLong},
+		{"000001\r\na\r\n0\r\n\r\n", 0, 6, ErrHdrValTooLong},
+		{"1\r\na\r\n000000", 0, 6, ErrHdrValTooLong},
+		{"1\r\na\r\n00000", 0, 6, ErrHdrMoreBytes},
+		{"000000000000000000001\r\na\r\n0\r\n\r\n", 0, 0, 0},
+	}
+	for _, c := range tests {
+		buf := []byte(hdrs + c.body)
+		var msg PMsg
+		// one-shot and piece-wise (one byte at a time)
+		for _, step := range []int{len(buf), 1} {
+			msg.Init(nil, nil)
+			msg.PrevMethod = MGet
+			msg.MaxChunks = c.maxChunks
+			msg.MaxChunkLineLen = c.maxLineLen
+			o := 0
+			err := ErrHdrMoreBytes
+			for end := step; err == ErrHdrMoreBytes; end += step {
+				if end > len(buf) {
+					end = len(buf)
+				}
+				o, err = ParseMsg(buf[:end], o, &msg, 0)
+				if end == len(buf) {
+					break
+				}
+			}
+			if err != c.err {
+				t.Errorf("ParseMsg(%q, 0, .., 0) step %d, limits %d %d:"+
+					" %d(%q), expected %d(%q)", buf, step, c.maxChunks,
+					c.maxLineLen, err, err, c.err, c.err)
+			}
+		}
+	}
+}
+
+func TestParseMsgLenientHdrs(t *testing.T) {
+	const fl = "GET / HTTP/1.1\r\n"
+	tests := [...]struct {
+		hdrs    string
+		err     ErrorHdr // error with MsgLenientHdrsF
+		skipped int
+		n       int // parsed headers
+	}{
+		{"Host: foo\r\n\r\n", 0, 0, 1},
+		{"Host: foo\r\nX Y: 1\r\nX-Foo: 2\r\n\r\n", 0, 1, 2},
+		{"X Y: 1\r\n\r\n", 0, 1, 0},
+		{"Host: foo\r\nX Y: 1\r\n  folded\r\n\tfolded2\r\nX-Foo: 2\r\n\r\n",
+			0, 1, 2},
+		{"Bad Name: 1\r\nFoo Bar\r\nHost: foo\r\n\r\n", 0, 2, 1},
+		{"Host: foo\r\nContent-Type: ,\r\n\r\n", 0, 1, 1},
+		{"Host: foo\r\nContent-Length x: 1\r\n\r\nX", ErrHdrBadChar, 0, 1},
+		{"Host: foo\r\ncontent-length\t1\r\n\r\nX", ErrHdrBadChar, 0, 1},
+		{"Host: foo\r\nContent-Length : 1\r\n\r\nX", ErrHdrBadChar, 0, 1},
+		{"Host: foo\r\nTransfer-Encoding\t: chunked\r\n\r\n0\r\n\r\n",
+			ErrHdrBadChar, 0, 1},
+		{"Host: foo\r\nX-Foo : 1\r\n\r\n", 0, 1, 1},
+		{"Host: foo\r\nContent-Length: 1 2\r\n\r\nX", ErrHdrBadChar, 0, 1},
+		{"Host: foo\r\nTransfer-Encoding: chunked,,(\r\n\r\n0\r\n\r\n",
+			ErrHdrBadChar, 0, 1},
+	}
+	for _, c := range tests {
+		buf := []byte(fl + c.hdrs)
+		for _, step := range []int{len(buf), 1} {
+			var msg PMsg
+			msg.Init(nil, nil)
+			o := 0
+			err := ErrHdrMoreBytes
+			for end := step; err == ErrHdrMoreBytes; end += step {
+				if end > len(buf) {
+					end = len(buf)
+				}
+				o, err = ParseMsg(buf[:end], o, &msg, MsgLenientHdrsF)
+				if end == len(buf) {
+					break
+				}
+			}
+			if err != c.err {
+				t.Errorf("ParseMsg(%q, .., MsgLenientHdrsF) step %d ="+
+					" [%d, %d(%q)], expected %d(%q)",
+					buf, step, o, err, err, c.err, c.err)
+				continue
+			}
+			if err == 0 && (msg.HL.Skipped != c.skipped ||
+				msg.HL.N != c.n || o != len(buf)) {
+				t.Errorf("ParseMsg(%q, .., MsgLenientHdrsF) step %d:"+
+					" offset %d, skipped %d, headers %d, expected"+
+					" %d, %d, %d", buf, step, o, msg.HL.Skipped, msg.HL.N,
+					len(buf), c.skipped, c.n)
+			}
+		}
+		if c.skipped > 0 {
+			// without the flag parsing should fail
+			var msg PMsg
+			msg.Init(nil, nil)
+			if _, err := ParseMsg(buf, 0, &msg, 0); err != ErrHdrBadChar {
+				t.Errorf("ParseMsg(%q, .., 0) = %d(%q), expected %q",
+					buf, err, err, ErrHdrBadChar)
+			}
+		}
+	}
+}
+
+func TestParseMsgLenientHdrsReset(t *testing.T) {
+	// a skipped malformed header must not affect the parsing of the
+	// following headers of the same type
+	buf := []byte("GET / HTTP/1.1\r\nHost: foo\r\n" +
+		"Content-Type: ,\r\nContent-Type: text/plain\r\n" +
+		"Upgrade: websocket, (\r\nUpgrade: h2c\r\n" +
+		"Connection: upgrade\r\n\r\n")
+	for _, step := range []int{len(buf), 1} {
+		var msg PMsg
+		msg.Init(nil, nil)
+		o := 0
+		err := ErrHdrMoreBytes
+		for end := 0; end < len(buf) && err == ErrHdrMoreBytes; {
+			end += step
+			o, err = ParseMsg(buf[:end], o, &msg, MsgLenientHdrsF)
+		}
+		if err != 0 || o != len(buf) {
+			t.Errorf("ParseMsg(%q, .., MsgLenientHdrsF) step %d ="+
+				" [%d, %d(%q)]", buf, step, o, err, err)
+			continue
+		}
+		ct := &msg.PV.CType
+		if msg.HL.Skipped != 2 || msg.HL.N != 4 || !ct.Parsed() ||
+			string(ct.Type.Get(buf)) != "text" ||
+			msg.PV.Upgrade.HNo != 1 {
+			t.Errorf("ParseMsg(%q, .., MsgLenientHdrsF) step %d: skipped %d,"+
+				" headers %d, Content-Type %q, Upgrade headers %d", buf,
+				step, msg.HL.Skipped, msg.HL.N, ct.Type.Get(buf),
+				msg.PV.Upgrade.HNo)
+		}
+	}
+}
+
+func TestParseMsgMergeTrailers(t *testing.T) {
+	buf := []byte("HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n" +
+		"X-Foo: 1\r\nTrailer: X-Foo, X-Sig, Content-Length\r\n\r\n" +
+		"3\r\nfoo\r\n0\r\nX-Sig: abc\r\nContent-Length: 10\r\n" +
+		"X-Foo: 2\r\n\r\n")
+	for _, flags := range []MsgFlags{0, MsgMergeTrailersF} {
+		var msg PMsg
+		msg.Init(nil, nil)
+		msg.PrevMethod = MGet
+		o, err := ParseMsg(buf, 0, &msg, flags)
+		if err != 0 || o != len(buf) {
+			t.Fatalf("ParseMsg(%q, 0, .., 0x%x) = [%d, %d(%q)]",
+				buf, flags, o, err, err)
+		}
+		if flags == 0 {
+			if msg.HL.N != 3 {
+				t.Errorf("ParseMsg(.., 0): %d headers, expected 3", msg.HL.N)
+			}
+			if n := msg.MergeTrailers(); n != 2 {
+				t.Errorf("MergeTrailers() = %d, expected 2", n)
+			}
+		}
+		if n := msg.MergeTrailers(); n != 0 {
+			t.Errorf("MergeTrailers() second call = %d, expected 0", n)
+		}
+		if msg.HL.N != 5 {
+			t.Errorf("ParseMsg(.., 0x%x): %d headers after merge,"+
+				" expected 5", flags, msg.HL.N)
+		}
+		if msg.HL.PFlags.Test(HdrCLen) || msg.PV.CLen.Parsed() {
+			t.Errorf("ParseMsg(.., 0x%x): forbidden trailer merged", flags)
+		}
+		var vals []string
+		for _, h := range msg.HL.GetHdrs(HdrOther) {
+			vals = append(vals, string(h.Name.Get(buf))+"="+
+				string(h.Val.Get(buf)))
+		}
+		if e := "X-Foo=1,Trailer=X-Foo, X-Sig, Content-Length,X-Sig=abc," +
+			"X-Foo=2"; strings.Join(vals, ",") != e {
+			t.Errorf("ParseMsg(.., 0x%x): headers %q, expected %q",
+				flags, strings.Join(vals, ","), e)
+		}
+		if !msg.HL.DupFlags.Test(HdrOther) {
+			t.Errorf("ParseMsg(.., 0x%x): dup flags 0x%x",
+				flags, msg.HL.DupFlags)
+		}
+	}
+}
+
+func TestParseMsgIllegalBodyHeaders(t *testing.T) {
+	tests := [...]struct {
+		m       string
+		prvM    HTTPMethod
+		illegal bool
+	}{
+		{"HTTP/1.1 204 No Content\r\nContent-Length: 0\r\n\r\n", MGet, true},
+		{"HTTP/1.1 204 No Content\r\nTransfer-Encoding: chunked\r\n\r\n",
+			MGet, true},
+		{"HTTP/1.1 100 Continue\r\nContent-Length: 5\r\n\r\n", MPost, true},
+		{"HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n", MConnect, true},
+		{"HTTP/1.1 407 Auth\r\nContent-Length: 0\r\n\r\n", MConnect, false},
+		{"HTTP/1.1 304 Not Modified\r\nContent-Length: 5\r\n\r\n",
+			MGet, false},
+		{"HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n", MHead, false},
+		{"HTTP/1.1 204 No Content\r\nServer: foo\r\n\r\n", MGet, false},
+		{"HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n", MGet, false},
+		{"POST / HTTP/1.1\r\nHost: foo\r\nContent-Length: 0\r\n\r\n",
+			MUndef, false},
+	}
+	for _, c := range tests {
+		buf := []byte(c.m)
+		for _, flags := range []MsgFlags{0, MsgStrictF} {
+			var msg PMsg
+			msg.Init(nil, nil)
+			msg.PrevMethod = c.prvM
+			_, err := ParseMsg(buf, 0, &msg, flags)
+			eErr := ErrHdrOk
+			if c.illegal && flags == MsgStrictF {
+				eErr = ErrHdrBadFraming
+			}
+			if err != eErr {
+				t.Errorf("ParseMsg(%q, 0, .., 0x%x) = %d(%q), expected %q",
+					buf, flags, err, err, eErr)
+			}
+			if msg.HasIllegalBodyHeaders() != c.illegal {
+				t.Errorf("ParseMsg(%q, 0, .., 0x%x): HasIllegalBodyHeaders()"+
+					" = %v", buf, flags, msg.HasIllegalBodyHeaders())
+			}
+		}
+	}
+}
+
+func TestParseMsgRequireCLen(t *testing.T) {
+	tests := [...]struct {
+		m     string
+		prvM  HTTPMethod
+		noLen bool
+	}{
+		{"POST /a HTTP/1.1\r\nHost: foo\r\nTransfer-Encoding: chunked\r\n" +
+			"\r\n0\r\n\r\n", MUndef, true},
+		{"POST /a HTTP/1.1\r\nHost: foo\r\nTransfer-Encoding: gzip\r\n" +
+			"\r\nabc", MUndef, true},
+		{"POST /a HTTP/1.1\r\nHost: foo\r\nContent-Length: 3\r\n\r\nabc",
+			MUndef, false},
+		{"GET /a HTTP/1.1\r\nHost: foo\r\n\r\n", MUndef, false},
+		{"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+			MGet, false},
+	}
+	for _, c := range tests {
+		buf := []byte(c.m)
+		for _, flags := range []MsgFlags{0, MsgRequireCLenF} {
+			var msg PMsg
+			msg.Init(nil, nil)
+			msg.PrevMethod = c.prvM
+			o, err := ParseMsg(buf, 0, &msg, flags|MsgNoMoreDataF)
+			if c.noLen && flags != 0 {
+				if err != ErrHdrNoCLen || msg.state != MsgNoCLen ||
+					!msg.Err() {
+					t.Errorf("ParseMsg(%q, 0, .., 0x%x) = [%d, %d(%q)],"+
+						" state %d", buf, flags, o, err, err, msg.state)
+				}
+				// further calls should return the same error
+				if _, err = ParseMsg(buf, o, &msg, flags); err != ErrHdrNoCLen {
+					t.Errorf("ParseMsg(%q, %d, .., 0x%x) again = %d(%q)",
+						buf, o, flags, err, err)
+				}
+				continue
+			}
+			if err != 0 || o != len(buf) || !msg.Parsed() {
+				t.Errorf("ParseMsg(%q, 0, .., 0x%x) = [%d, %d(%q)]",
+					buf, flags, o, err, err)
+			}
+		}
+	}
+	// SkipBody() after stopping at the end of headers
+	buf := []byte(tests[0].m)
+	var msg PMsg
+	msg.Init(nil, nil)
+	o, err := ParseMsg(buf, 0, &msg, MsgStopAfterHdrsF)
+	if err != 0 || !msg.ParsedHdrs() {
+		t.Fatalf("ParseMsg(%q, 0, .., MsgStopAfterHdrsF) = [%d, %d(%q)]",
+			buf, o, err, err)
+	}
+	if _, err = SkipBody(buf, o, &msg, MsgRequireCLenF); err != ErrHdrNoCLen ||
+		msg.state != MsgNoCLen {
+		t.Errorf("SkipBody(%q, %d, .., MsgRequireCLenF) = %d(%q), state %d",
+			buf, o, err, err, msg.state)
+	}
+	if _, err = SkipBody(buf, o, &msg, 0); err != ErrHdrNoCLen {
+		t.Errorf("SkipBody(%q, %d, .., 0) again = %d(%q)", buf, o, err, err)
+	}
+}
+
+func TestPMsgMethodBytes(t *testing.T) {
+	tests := [...]struct {
+		m    string
+		meth string
+	}{
+		{"GET /a HTTP/1.1\r\nHost: foo\r\n\r\n", "GET"},
+		{"PROPFIND /a HTTP/1.1\r\nHost: foo\r\n\r\n", "PROPFIND"},
+		{"get /a HTTP/1.1\r\nHost: foo\r\n\r\n", "get"},
+		{"HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n", ""},
+	}
+	for _, c := range tests {
+		var msg PMsg
+		msg.Init(nil, nil)
+		if m := msg.MethodBytes(); m != nil {
+			t.Errorf("MethodBytes() = %q before parsing", m)
+		}
+		msg.PrevMethod = MGet
+		buf := []byte(c.m)
+		if o, err := ParseMsg(buf, 0, &msg, 0); err != 0 {
+			t.Fatalf("ParseMsg(%q, 0, .., 0) = [%d, %d(%q)]", buf, o, err, err)
+		}
+		if m := msg.MethodBytes(); string(m) != c.meth ||
+			(c.meth == "" && m != nil) {
+			t.Errorf("ParseMsg(%q, 0, .., 0): MethodBytes() = %q,"+
+				" expected %q", buf, m, c.meth)
+		}
+	}
+}
+
+func TestPMsgResetState(t *testing.T) {
+	buf := []byte("POST /a HTTP/1.1\r\nHost: foo\r\nContent-Language: de\r\n" +
+		"Content-Length: 3\r\n\r\nabc")
+	var hdrs [5]Hdr
+	var tags [2]PField
+	var msg PMsg
+	msg.Init(nil, hdrs[:])
+	msg.PV.CLang.Init(tags[:])
+	msg.NoBodyMethods.Set(MGet)
+	msg.MaxChunks = 3
+	msg.HL.HdrFilter = HdrHostF | HdrContentLanguageF
+	// partial parse, then restart from scratch
+	if o, err := ParseMsg(buf[:30], 0, &msg, 0); err != ErrHdrMoreBytes {
+		t.Fatalf("ParseMsg(%q, 0, .., 0) = [%d, %d(%q)]", buf[:30], o, err, err)
+	}
+	for i := 0; i < 2; i++ {
+		msg.ResetState()
+		if msg.state != MsgInit || msg.HL.N != 0 || msg.PV.CLen.Parsed() {
+			t.Fatalf("ResetState(): state %d, %d headers", msg.state, msg.HL.N)
+		}
+		if &msg.HL.Hdrs[0] != &hdrs[0] || &msg.PV.CLang.Vals[0] != &tags[0] ||
+			!msg.NoBodyMethods.Test(MGet) || msg.MaxChunks != 3 ||
+			msg.HL.HdrFilter != HdrHostF|HdrContentLanguageF {
+			t.Fatalf("ResetState(): arrays or configuration not kept")
+		}
+		o, err := ParseMsg(buf, 0, &msg, 0)
+		if err != 0 || o != len(buf) || msg.HL.N != 3 ||
+			string(msg.Body.Get(buf)) != "abc" || msg.PV.CLang.VNo() != 1 {
+			t.Errorf("ParseMsg(%q, 0, .., 0) after ResetState() ="+
+				" [%d, %d(%q)], %d headers", buf, o, err, err, msg.HL.N)
+		}
+	}
+}
+
+func TestParseMsgSkipInterim(t *testing.T) {
+	const final = "HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\nabc"
+	tests := [...]struct {
+		m      string
+		status uint16
+		err    ErrorHdr
+	}{
+		{final, 200, 0},
+		{"HTTP/1.1 100 Continue\r\n\r\n" + final, 200, 0},
+		{"HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 103 Early Hints\r\n" +
+			"Link: </a.css>; rel=preload\r\n\r\n" + final, 200, 0},
+		{"HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 101 Switching\r\n" +
+			"Upgrade: websocket\r\n\r\n", 101, 0},
+		{"HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 204 No Content\r\n\r\n",
+			204, 0},
+		{"HTTP/1.1 100 Continue\r\n\r\n", 0, ErrHdrMoreBytes},
+	}
+	for _, c := range tests {
+		buf := []byte(c.m)
+		for _, step := range []int{len(buf), 1} {
+			var msg PMsg
+			msg.Init(nil, nil)
+			o := 0
+			err := ErrHdrMoreBytes
+			for end := step; err == ErrHdrMoreBytes && end <= len(buf); end += step {
+				o, err = ParseMsgSkipInterim(buf[:end], o, &msg, MPost, 0)
+			}
+			if err != c.err {
+				t.Errorf("ParseMsgSkipInterim(%q, .., %d) = [%d, %d(%q)],"+
+					" expected %q", buf, step, o, err, err, c.err)
+				continue
+			}
+			if err != 0 {
+				continue
+			}
+			if o != len(buf) || msg.FL.Status != c.status ||
+				msg.PrevMethod != MPost || msg.IsInterim() ||
+				string(msg.RawMsg) != c.m[o-len(msg.RawMsg):] ||
+				strings.Contains(string(msg.RawMsg), "Continue") {
+				t.Errorf("ParseMsgSkipInterim(%q, .., %d) = [%d, %d(%q)],"+
+					" status %d, raw %q", buf, step, o, err, err,
+					msg.FL.Status, msg.RawMsg)
+			}
+		}
+	}
+}
+
+func TestParseMsgHeadersOnly(t *testing.T) {
+	tests := [...]struct {
+		m    string
+		body string
+		err  ErrorHdr
+	}{
+		{"GET / HTTP/1.1\r\nHost: foo\r\n\r\n", "", 0},
+		{"POST /x HTTP/1.1\r\nHost: foo\r\nContent-Length: 3\r\n\r\n",
+			"abc", 0},
+		{"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n",
+			"3\r\nabc\r\n0\r\n\r\n", 0},
+		{"HTTP/1.1 100 Continue\r\n\r\n", "", 0},
+		{"GET / HTTP/1.1\r\nHo st: foo\r\n\r\n", "", ErrHdrBadChar},
+	}
+	for _, c := range tests {
+		buf := []byte(c.m + c.body)
+		for _, step := range []int{len(buf), 1} {
+			var msg, fmsg PMsg
+			msg.Init(nil, nil)
+			o := 0
+			err := ErrHdrMoreBytes
+			for end := step; err == ErrHdrMoreBytes && end <= len(buf); end += step {
+				o, err = ParseMsgHeadersOnly(buf[:end], o, &msg)
+			}
+			if err != c.err {
+				t.Errorf("ParseMsgHeadersOnly(%q, .., %d) = [%d, %d(%q)],"+
+					" expected %q", buf, step, o, err, err, c.err)
+				continue
+			}
+			if err != 0 {
+				continue
+			}
+			if o != len(c.m) || msg.state != MsgBodyInit ||
+				string(msg.RawMsg) != c.m {
+				t.Errorf("ParseMsgHeadersOnly(%q, .., %d) = [%d, %d(%q)],"+
+					" state %d, raw %q", buf, step, o, err, err,
+					msg.state, msg.RawMsg)
+				continue
+			}
+			// compare with the flags based version
+			fmsg.Init(nil, nil)
+			if _, err = ParseMsg(buf, 0, &fmsg, MsgStopAfterHdrsF); err != 0 ||
+				!msg.FramingEqual(&fmsg) {
+				t.Errorf("ParseMsgHeadersOnly(%q): different from ParseMsg()"+
+					" (%q)", buf, err)
+			}
+			// the body can still be parsed
+			if o, err = SkipBody(buf, o, &msg, MsgNoMoreDataF); err != 0 ||
+				o != len(buf) || (!msg.ChunkedComplete() &&
+				string(msg.Body.Get(buf)) != c.body) {
+				t.Errorf("SkipBody(%q) after ParseMsgHeadersOnly() = [%d,"+
+					" %d(%q)], body %q", buf, o, err, err,
+					msg.Body.Get(buf))
+			}
+		}
+	}
+}
+
+func benchmarkHdrsMsg() []byte {
+	return []byte("POST /upload/file?x=1 HTTP/1.1\r\n" +
+		"Host: www.example.com\r\n" +
+		"User-Agent: bench/1.0\r\n" +
+		"Accept: */*\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Length: 4\r\n" +
+		"Connection: keep-alive\r\n\r\ntest")
+}
+
+func BenchmarkParseMsgHeadersOnly(b *testing.B) {
+	var msg PMsg
+	buf := benchmarkHdrsMsg()
+	msg.Init(nil, nil)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msg.ResetState()
+		if _, err := ParseMsgHeadersOnly(buf, 0, &msg); err != 0 {
+			b.Fatalf("unexpected error %q", err)
+		}
+	}
+}
+
+func BenchmarkParseMsgStopAfterHdrs(b *testing.B) {
+	var msg PMsg
+	buf := benchmarkHdrsMsg()
+	msg.Init(nil, nil)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msg.ResetState()
+		if _, err := ParseMsg(buf, 0, &msg, MsgStopAfterHdrsF); err != 0 {
+			b.Fatalf("unexpected error %q", err)
+		}
+	}
+}
+
+func TestPMsgRedactHeaders(t *testing.T) {
+	const m = "GET / HTTP/1.1\r\n" +
+		"Host: foo.bar\r\n" +
+		"Authorization: Basic dXNlcjpwYXNz\r\n" +
+		"Cookie: a=1;\r\n b=2\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	const e = "GET / HTTP/1.1\r\n" +
+		"Host: XXXXXXX\r\n" +
+		"Authorization: XXXXXXXXXXXXXXXXXX\r\n" +
+		"Cookie: XXXX\r\n XXX\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	var msg, rmsg PMsg
+	var hdrs, rhdrs [10]Hdr
+	msg.Init(nil, hdrs[:])
+	if _, err := ParseMsg([]byte(m), 0, &msg, 0); err != 0 {
+		t.Fatalf("ParseMsg(%q) failed: %d(%q)", m, err, err)
+	}
+	buf := append([]byte(nil), msg.Buf...)
+	msg.RedactHeaders(buf, HdrHost, HdrOther)
+	if string(buf) != e {
+		t.Fatalf("RedactHeaders(%q) = %q, expected %q", m, buf, e)
+	}
+	// the redacted message should have the same structure
+	rmsg.Init(nil, rhdrs[:])
+	if _, err := ParseMsg(buf, 0, &rmsg, 0); err != 0 ||
+		rmsg.HL.N != msg.HL.N || rmsg.HL.PFlags != msg.HL.PFlags {
+		t.Errorf("ParseMsg(%q) after redacting = %d(%q), %d headers,"+
+			" expected %d", buf, err, err, rmsg.HL.N, msg.HL.N)
+	}
+	// nothing to redact
+	buf = append(buf[:0], msg.Buf...)
+	msg.RedactHeaders(buf, HdrTrEncoding)
+	if string(buf) != m {
+		t.Errorf("RedactHeaders(%q, HdrTrEncoding) = %q", m, buf)
+	}
+	// too small buffer
+	h := msg.HL.GetHdr(HdrHost)
+	h.RedactValue(buf[:20], '*')
+	if string(buf) != m {
+		t.Errorf("RedactValue(%q) on short buffer = %q", m, buf)
+	}
+}
+
+func TestBuildContinueResponse(t *testing.T) {
+	b := BuildContinueResponse()
+	if string(b) != "HTTP/1.1 100 Continue\r\n\r\n" {
+		t.Fatalf("BuildContinueResponse() = %q", b)
+	}
+	var msg PMsg
+	msg.Init(nil, nil)
+	msg.PrevMethod = MPost
+	o, err := ParseMsg(b, 0, &msg, 0)
+	if err != 0 || o != len(b) || msg.FL.Status != 100 || !msg.IsInterim() {
+		t.Errorf("ParseMsg(%q) = [%d, %d(%q)], status %d", b, o, err, err,
+			msg.FL.Status)
+	}
+	// each call should return a new copy
+	b[0] = 'X'
+	if b2 := BuildContinueResponse(); b2[0] != 'H' {
+		t.Errorf("BuildContinueResponse() = %q after modifying a previous"+
+			" result", b2)
+	}
+}
+
+func TestParseMsgPipelined(t *testing.T) {
+	msgs := [...]string{
+		"GET /a HTTP/1.1\r\nHost: foo\r\n\r\n",
+		"POST /b HTTP/1.1\r\nHost: foo\r\nContent-Length: 3\r\n\r\nabc",
+		"PUT /c HTTP/1.1\r\nHost: foo\r\nTransfer-Encoding: chunked\r\n" +
+			"\r\n3\r\nabc\r\n0\r\n\r\n",
+		"GET /d HTTP/1.1\r\nHost: foo\r\n\r\n",
+	}
+	buf := []byte(strings.Join(msgs[:], ""))
+	var msg PMsg
+	msg.Init(nil, nil)
+	if msg.NextOffset() != -1 {
+		t.Errorf("NextOffset() = %d for an unparsed message",
+			msg.NextOffset())
+	}
+	o := 0
+	for i, m := range msgs {
+		start := o
+		n, err := ParseMsg(buf, o, &msg, 0)
+		if err != 0 || n != start+len(m) || string(msg.RawMsg) != m ||
+			msg.NextOffset() != n {
+			t.Fatalf("ParseMsg(%q, %d, ..) for msg %d = [%d, %d(%q)],"+
+				" raw %q, next offset %d", buf, o, i, n, err, err,
+				msg.RawMsg, msg.NextOffset())
+		}
+		// forgetting to reset msg should not clobber the parsed message
+		if n2, err := ParseMsg(buf, n, &msg, 0); err != ErrHdrBug ||
+			n2 != n || !msg.Parsed() || string(msg.RawMsg) != m {
+			t.Errorf("ParseMsg(%q, %d, ..) without Reset() = [%d, %d(%q)],"+
+				" raw %q", buf, n, n2, err, err, msg.RawMsg)
+		}
+		msg.ResetState()
+		o = n
+	}
+	if o != len(buf) {
+		t.Errorf("pipelined messages end at %d, expected %d", o, len(buf))
+	}
+}
+
+func TestPMsgNeedsMoreData(t *testing.T) {
+	tests := [...]struct {
+		m    string
+		more bool // NeedsMoreData() for incomplete input
+		eof  bool // WaitingForEOF() after the headers
+	}{
+		{"GET / HTTP/1.1\r\nHost: foo\r\n\r\n", true, false},
+		{"POST / HTTP/1.1\r\nContent-Length: 3\r\n\r\nabc", true, false},
+		{"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"3\r\nabc\r\n0\r\n\r\n", true, false},
+		{"HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nabc",
+			true, true},
+		{"HTTP/1.0 200 OK\r\nContent-Length: 2\r\n\r\nab", true, false},
+	}
+	for _, c := range tests {
+		var msg PMsg
+		msg.Init(nil, nil)
+		if msg.NeedsMoreData() || msg.WaitingForEOF() {
+			t.Errorf("NeedsMoreData() %v, WaitingForEOF() %v for an"+
+				" empty message", msg.NeedsMoreData(), msg.WaitingForEOF())
+		}
+		buf := []byte(c.m)
+		o := 0
+		var err ErrorHdr
+		for i := 1; i <= len(buf); i++ {
+			o, err = ParseMsg(buf[:i], o, &msg, 0)
+			if err != ErrHdrMoreBytes {
+				break
+			}
+			eof := msg.WaitingForEOF()
+			more := !eof && c.more
+			if msg.NeedsMoreData() != more ||
+				(msg.ParsedHdrs() && eof != c.eof) {
+				t.Errorf("%q after %d bytes: NeedsMoreData() = %v,"+
+					" WaitingForEOF() = %v", c.m, i, msg.NeedsMoreData(),
+					eof)
+			}
+		}
+		if c.eof {
+			if err != ErrHdrMoreBytes || !msg.WaitingForEOF() {
+				t.Fatalf("ParseMsg(%q) = [%d, %d(%q)], WaitingForEOF() %v",
+					c.m, o, err, err, msg.WaitingForEOF())
+			}
+			// connection closed
+			o, err = ParseMsg(buf, o, &msg, MsgNoMoreDataF)
+		}
+		if err != 0 || o != len(buf) || msg.NeedsMoreData() ||
+			msg.WaitingForEOF() {
+			t.Errorf("ParseMsg(%q) = [%d, %d(%q)], NeedsMoreData() %v,"+
+				" WaitingForEOF() %v", c.m, o, err, err,
+				msg.NeedsMoreData(), msg.WaitingForEOF())
+		}
+	}
+	// errors
+	var msg PMsg
+	msg.Init(nil, nil)
+	buf := []byte("GET / HTTP/1.1\r\nContent-Length: x\r\n\r\n")
+	if _, err := ParseMsg(buf, 0, &msg, 0); err == 0 || err == ErrHdrMoreBytes ||
+		msg.NeedsMoreData() || msg.WaitingForEOF() {
+		t.Errorf("ParseMsg(%q) = %d(%q), NeedsMoreData() %v,"+
+			" WaitingForEOF() %v", buf, err, err, msg.NeedsMoreData(),
+			msg.WaitingForEOF())
+	}
+	// stopped on purpose after the headers
+	msg.Init(nil, nil)
+	buf = []byte("GET / HTTP/1.1\r\nContent-Length: 3\r\n\r\n")
+	if _, err := ParseMsg(buf, 0, &msg, MsgStopAfterHdrsF); err != 0 ||
+		msg.NeedsMoreData() || msg.WaitingForEOF() {
+		t.Errorf("ParseMsg(%q, MsgStopAfterHdrsF) = %d(%q),"+
+			" NeedsMoreData() %v", buf, err, err, msg.NeedsMoreData())
+	}
+}
+
+func TestPMsgHeadersDoneBodyPending(t *testing.T) {
+	tests := [...]struct {
+		m       string // message prefix (partial input)
+		flags   MsgFlags
+		state   MsgPState
+		pending bool
+	}{
+		{"POST / HTTP/1.1\r\nContent-Length: 5\r\n\r\nab", 0,
+			MsgBodyCLen, true},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3\r", 0,
+			MsgBodyChunked, true},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"3\r\na", 0, MsgBodyChunkedData, true},
+		{"HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nabc", 0,
+			MsgBodyEOF, true},
+		{"POST / HTTP/1.1\r\nContent-Length: 5\r\n\r\n",
+			MsgStopAfterHdrsF, MsgBodyInit, false},
+		{"POST / HTTP/1.1\r\nContent-Length: 2\r\n\r\nab", 0,
+			MsgFIN, false},
+		{"HTTP/1.1 204 No Content\r\n\r\n", 0, MsgFIN, false},
+		{"POST / HTTP/1.1\r\nContent-Length: x\r\n\r\n", 0,
+			MsgErr, false},
+		{"POST / HTTP/1.1\r\nContent-Le", 0, MsgHeaders, false},
+		{"POST / HTTP/1", 0, MsgFLine, false},
+	}
+	for _, c := range tests {
+		var msg PMsg
+		msg.Init(nil, nil)
+		msg.PrevMethod = MGet
+		buf := []byte(c.m)
+		o, err := ParseMsg(buf, 0, &msg, c.flags)
+		if msg.state != c.state {
+			t.Fatalf("ParseMsg(%q) = [%d, %d(%q)], state %d expected %d",
+				c.m, o, err, err, msg.state, c.state)
+		}
+		if msg.HeadersDoneBodyPending() != c.pending {
+			t.Errorf("ParseMsg(%q): state %d, HeadersDoneBodyPending() = %v,"+
+				" expected %v", c.m, msg.state,
+				msg.HeadersDoneBodyPending(), c.pending)
+		}
+	}
+	// MsgNoBody is only a transient state inside SkipBody()
+	var msg PMsg
+	msg.Init(nil, nil)
+	msg.state = MsgNoBody
+	if msg.HeadersDoneBodyPending() {
+		t.Errorf("HeadersDoneBodyPending() = true for MsgNoBody")
+	}
+}
+
+func TestPMsgStats(t *testing.T) {
+	tests := [...]struct {
+		m     string
+		prev  HTTPMethod
+		flags MsgFlags
+		stats PMsgStats // expected stats, without Bytes and Resumes
+	}{
+		{"GET / HTTP/1.1\r\nHost: foo\r\n\r\n", MUndef, 0,
+			PMsgStats{Msgs: 1, Hdrs: 1}},
+		{"POST / HTTP/1.1\r\nHost: foo\r\nContent-Length: 3\r\n\r\nabc",
+			MUndef, 0,
+			PMsgStats{Msgs: 1, Hdrs: 2, BodyBytes: 3}},
+		{"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"3\r\nabc\r\n2\r\nde\r\n0\r\n\r\n", MGet, 0,
+			PMsgStats{Msgs: 1, Hdrs: 1, BodyBytes: 20,
+				Chunks: 2, Chunked: 1}},
+		{"HTTP/1.0 200 OK\r\nServer: x\r\n\r\nabcd", MGet, MsgNoMoreDataF,
+			PMsgStats{Msgs: 1, Hdrs: 1, BodyBytes: 4, EOFBody: 1}},
+		{"HTTP/1.1 200 OK\r\n\r\n", MConnect, 0,
+			PMsgStats{Msgs: 1, Tunnels: 1}},
+	}
+	var total, etotal PMsgStats
+	for _, c := range tests {
+		var msg PMsg
+		msg.Init(nil, nil)
+		if s := msg.Stats(); s != (PMsgStats{}) {
+			t.Errorf("Stats() = %+v for an empty message", s)
+		}
+		buf := []byte(c.m)
+		// parse in 2 pieces
+		msg.PrevMethod = c.prev
+		o, err := ParseMsg(buf[:len(buf)/2], 0, &msg, 0)
+		if err != ErrHdrMoreBytes {
+			t.Fatalf("ParseMsg(%q) = [%d, %d(%q)]", buf[:len(buf)/2],
+				o, err, err)
+		}
+		if s := msg.Stats(); s.Resumes != 1 || s.Bytes != o {
+			t.Errorf("Stats() = %+v for %q after %d bytes", s, c.m, o)
+		}
+		if o, err = ParseMsg(buf, o, &msg, c.flags); err != 0 ||
+			o != len(buf) {
+			t.Fatalf("ParseMsg(%q) = [%d, %d(%q)]", buf, o, err, err)
+		}
+		e := c.stats
+		e.Bytes = len(buf)
+		e.Resumes = 1
+		if s := msg.Stats(); s != e {
+			t.Errorf("Stats() for %q = %+v, expected %+v", c.m, s, e)
+		}
+		s := msg.Stats()
+		total.Add(&s)
+		etotal.Msgs++
+		etotal.Bytes += len(buf)
+		etotal.Chunks += e.Chunks
+	}
+	if total.Msgs != etotal.Msgs || total.Bytes != etotal.Bytes ||
+		total.Chunks != etotal.Chunks || total.Resumes != len(tests) ||
+		total.Chunked != 1 || total.EOFBody != 1 || total.Tunnels != 1 {
+		t.Errorf("accumulated stats %+v", total)
+	}
+}
+
+func TestPMsgInTunnel(t *testing.T) {
+	tests := [...]struct {
+		m      string
+		prev   HTTPMethod
+		tunnel bool
+	}{
+		{"HTTP/1.1 200 Connection established\r\n\r\n", MConnect, true},
+		{"HTTP/1.1 204 No Content\r\nProxy-Agent: x\r\n\r\n",
+			MConnect, true},
+		{"HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\n", MConnect,
+			true},
+		{"HTTP/1.1 407 Proxy Auth Required\r\nContent-Length: 0\r\n\r\n",
+			MConnect, false},
+		{"HTTP/1.1 100 Continue\r\n\r\n", MConnect, false},
+		{"HTTP/1.1 502 Bad Gateway\r\nContent-Length: 0\r\n\r\n",
+			MConnect, false},
+		{"HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n", MGet, false},
+		{"HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n", MUndef, false},
+		{"CONNECT foo:443 HTTP/1.1\r\nHost: foo:443\r\n\r\n", MConnect,
+			false},
+	}
+	for _, c := range tests {
+		buf := []byte(c.m)
+		// full message and byte by byte
+		for _, step := range []int{len(buf), 1} {
+			var msg PMsg
+			msg.Init(nil, nil)
+			msg.PrevMethod = c.prev
+			o := 0
+			err := ErrHdrMoreBytes
+			for end := 0; end < len(buf) && err == ErrHdrMoreBytes; {
+				end += step
+				o, err = ParseMsg(buf[:end], o, &msg, 0)
+			}
+			if err != 0 || o != len(buf) || !msg.Parsed() {
+				t.Fatalf("ParseMsg(%q) step %d = [%d, %d(%q)], state %d",
+					c.m, step, o, err, err, msg.state)
+			}
+			if msg.IsTunnelEstablished(c.prev) != c.tunnel ||
+				msg.InTunnel() != c.tunnel {
+				t.Errorf("ParseMsg(%q) step %d: IsTunnelEstablished() = %v,"+
+					" InTunnel() = %v, expected %v", c.m, step,
+					msg.IsTunnelEstablished(c.prev), msg.InTunnel(), c.tunnel)
+			}
+			if c.tunnel && (!msg.Body.Empty() || !msg.ParsedHdrs() ||
+				msg.NeedsMoreData() || msg.HeadersDoneBodyPending()) {
+				t.Errorf("ParseMsg(%q) step %d: unexpected tunnel"+
+					" state: body %v", c.m, step, msg.Body)
+			}
+		}
+	}
+	// tunnel data after the headers is not parsed
+	var msg PMsg
+	msg.Init(nil, nil)
+	msg.PrevMethod = MConnect
+	const hdrs = "HTTP/1.1 200 OK\r\n\r\n"
+	buf := []byte(hdrs + "\x16\x03\x01 binary tunnel data")
+	o, err := ParseMsg(buf, 0, &msg, 0)
+	if err != 0 || o != len(hdrs) || !msg.InTunnel() {
+		t.Errorf("ParseMsg(%q) = [%d, %d(%q)], InTunnel() %v, expected"+
+			" offset %d", buf, o, err, err, msg.InTunnel(), len(hdrs))
+	}
+	if _, err = ParseMsg(buf, o, &msg, 0); err != ErrHdrBug {
+		t.Errorf("ParseMsg(%q) after tunnel = %d(%q), expected %d",
+			buf, err, err, ErrHdrBug)
+	}
+	// stopped after the headers: tunnel detected only after the body step
+	msg.Init(nil, nil)
+	msg.PrevMethod = MConnect
+	o, err = ParseMsg(buf, 0, &msg, MsgStopAfterHdrsF)
+	if err != 0 || o != len(hdrs) || msg.InTunnel() ||
+		!msg.IsTunnelEstablished(MConnect) {
+		t.Errorf("ParseMsg(%q, MsgStopAfterHdrsF) = [%d, %d(%q)],"+
+			" InTunnel() %v", buf, o, err, err, msg.InTunnel())
+	}
+	if o, err = ParseMsg(buf, o, &msg, 0); err != 0 || o != len(hdrs) ||
+		!msg.InTunnel() {
+		t.Errorf("ParseMsg(%q) after MsgStopAfterHdrsF = [%d, %d(%q)],"+
+			" InTunnel() %v", buf, o, err, err, msg.InTunnel())
+	}
+	// body skipped: same as stopped after the headers
+	msg.Init(nil, nil)
+	msg.PrevMethod = MConnect
+	o, err = ParseMsg(buf, 0, &msg, MsgSkipBodyF)
+	if err != 0 || o != len(hdrs) || msg.InTunnel() || msg.Parsed() ||
+		!msg.IsTunnelEstablished(MConnect) {
+		t.Errorf("ParseMsg(%q, MsgSkipBodyF) = [%d, %d(%q)],"+
+			" InTunnel() %v", buf, o, err, err, msg.InTunnel())
+	}
+	if o, err = ParseMsg(buf, o, &msg, 0); err != 0 || o != len(hdrs) ||
+		!msg.InTunnel() {
+		t.Errorf("ParseMsg(%q) after MsgSkipBodyF = [%d, %d(%q)],"+
+			" InTunnel() %v", buf, o, err, err, msg.InTunnel())
+	}
+}
+
+func TestPMsgShouldCloseAfter(t *testing.T) {
+	tests := [...]struct {
+		m     string
+		prev  HTTPMethod
+		close bool
+	}{
+		{"GET / HTTP/1.1\r\nHost: foo\r\n\r\n", MUndef, false},
+		{"GET / HTTP/1.1\r\nConnection: close\r\n\r\n", MUndef, true},
+		{"GET / HTTP/1.1\r\nConnection: keep-alive, Close\r\n\r\n",
+			MUndef, true},
+		{"GET / HTTP/1.1\r\nConnection: x-foo\r\n" +
+			"Connection: close\r\n\r\n", MUndef, true},
+		{"GET / HTTP/1.0\r\n\r\n", MUndef, true},
+		{"GET / HTTP/1.0\r\nConnection: Keep-Alive\r\n\r\n",
+			MUndef, false},
+		{"GET / HTTP/1.0\r\nConnection: keep-alive, close\r\n\r\n",
+			MUndef, true},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n",
+			MUndef, true},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n",
+			MUndef, false},
+		{"HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n", MGet, false},
+		{"HTTP/1.1 200 OK\r\nServer: x\r\n\r\n", MGet, true},
+		{"HTTP/1.1 200 OK\r\nServer: x\r\n\r\n", MHead, false},
+		{"HTTP/1.1 204 No Content\r\n\r\n", MGet, false},
+		{"HTTP/1.1 200 OK\r\nTransfer-Encoding: gzip\r\n\r\n", MGet,
+			true},
+		{"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n", MGet,
+			false},
+		{"HTTP/1.0 200 OK\r\nContent-Length: 0\r\n\r\n", MGet, true},
+		{"HTTP/1.0 200 OK\r\nConnection: keep-alive\r\n" +
+			"Content-Length: 0\r\n\r\n", MGet, false},
+		{"HTTP/1.0 200 OK\r\nConnection: keep-alive\r\n\r\n", MGet,
+			true},
+		{"HTTP/1.1 200 OK\r\n\r\n", MConnect, true},
+		{"HTTP/1.1 407 Proxy Auth Required\r\nContent-Length: 0\r\n\r\n",
+			MConnect, false},
+		{"HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n" +
+			"Connection: Upgrade\r\n\r\n", MGet, true},
+		{"HTTP/1.1 100 Continue\r\n\r\n", MPost, false},
+	}
+	for _, c := range tests {
+		var msg PMsg
+		msg.Init(nil, nil)
+		msg.PrevMethod = c.prev
+		buf := []byte(c.m)
+		if _, err := ParseMsg(buf, 0, &msg, MsgStopAfterHdrsF); err != 0 {
+			t.Fatalf("ParseMsg(%q) failed: %d(%q)", c.m, err, err)
+		}
+		if res := msg.ShouldCloseAfter(c.prev); res != c.close {
+			t.Errorf("ShouldCloseAfter(%s) for %q = %v, expected %v",
+				c.prev, c.m, res, c.close)
+		}
+	}
+	var msg PMsg
+	msg.Init(nil, nil)
+	buf := []byte("GET /index.html\r\n")
+	if _, err := ParseMsg(buf, 0, &msg, MsgAllowHTTP09F); err != 0 ||
+		!msg.ShouldCloseAfter(MUndef) {
+		t.Errorf("ParseMsg(%q) = %d(%q), ShouldCloseAfter() = %v",
+			buf, err, err, msg.ShouldCloseAfter(MUndef))
+	}
+}
+
+func TestPMsgConnectionHas(t *testing.T) {
+	tests := [...]struct {
+		hdrs  string
+		token string
+		res   bool
+	}{
+		{"Connection: Upgrade\r\n", "upgrade", true},
+		{"Connection: keep-alive, Upgrade\r\n", "Upgrade", true},
+		{"Connection: close\r\n", "CLOSE", true},
+		{"Connection: close\r\n", "keep-alive", false},
+		{"Connection: close\r\nConnection: X-Foo , Upgrade\r\n",
+			"x-foo", true},
+		{"Connection: X-Foo-Bar\r\n", "x-foo", false},
+		{"Connection: TE, Keep-Alive\r\n", "te", true},
+		{"Upgrade: websocket\r\n", "upgrade", false},
+		{"Connection: close\r\n", "", false},
+	}
+	for _, c := range tests {
+		for _, hb := range []bool{true, false} {
+			m := "GET / HTTP/1.1\r\nHost: foo\r\n" + c.hdrs + "\r\n"
+			var msg PMsg
+			msg.Init(nil, nil)
+			buf := []byte(m)
+			o, err := ParseFLine(buf, 0, &msg.FL)
+			if err == 0 {
+				var pv PHBodies = &msg.PV
+				if !hb {
+					// generic headers only
+					pv = nil
+				}
+				_, err = ParseHeaders(buf, o, &msg.HL, pv)
+			}
+			if err != 0 {
+				t.Fatalf("parsing %q failed: %d(%q)", m, err, err)
+			}
+			msg.Buf = buf
+			if res := msg.ConnectionHas([]byte(c.token)); res != c.res {
+				t.Errorf("ConnectionHas(%q) for %q (parsed values %v) = %v",
+					c.token, m, hb, res)
+			}
+		}
+	}
+}
+
+func TestParseMsgConnectionBadVal(t *testing.T) {
+	tests := [...]struct {
+		hdrs string
+		opts ConnOptT // expected parsed options
+		hno  int      // expected parsed Connection headers
+		val  string   // expected value of the first Connection header
+	}{
+		{"Connection: foo bar\r\n", 0, 0, "foo bar"},
+		{"Connection: close\r\nConnection: foo bar\r\n", ConnCloseF, 1,
+			"close"},
+		{"Connection: foo bar\r\nConnection: keep-alive\r\n",
+			ConnKeepAliveF, 1, "foo bar"},
+		{"Connection: close, (x)\r\n", 0, 0, "close, (x)"},
+		{"Connection:\r\nConnection: close\r\n", ConnCloseF, 2, ""},
+		{"Connection: \r\n", 0, 1, ""},
+	}
+	for _, c := range tests {
+		m := "GET / HTTP/1.1\r\nHost: foo\r\n" + c.hdrs +
+			"Content-Length: 3\r\n\r\nabc"
+		buf := []byte(m)
+		for _, step := range []int{len(buf), 1} {
+			var msg PMsg
+			msg.Init(nil, nil)
+			o := 0
+			err := ErrHdrMoreBytes
+			for end := 0; end < len(buf) && err == ErrHdrMoreBytes; {
+				end += step
+				o, err = ParseMsg(buf[:end], o, &msg, 0)
+			}
+			if err != 0 || o != len(buf) || !msg.PV.CLen.Parsed() {
+				t.Errorf("ParseMsg(%q) step %d = [%d, %d(%q)]",
+					m, step, o, err, err)
+				continue
+			}
+			h := msg.HL.GetHdr(HdrConnection)
+			if msg.PV.Conn.Opts != c.opts || msg.PV.Conn.HNo != c.hno ||
+				string(h.Val.Get(buf)) != c.val {
+				t.Errorf("ParseMsg(%q) step %d: options 0x%x, %d headers,"+
+					" value %q, expected 0x%x, %d, %q", m, step,
+					msg.PV.Conn.Opts, msg.PV.Conn.HNo, h.Val.Get(buf),
+					c.opts, c.hno, c.val)
+			}
+		}
+	}
+}
+
+func TestPMsgFramingEqual(t *testing.T) {
+	const m1 = "POST /a HTTP/1.1\r\nHost: foo\r\nContent-Length: 3\r\n\r\nabc"
+	tests := [...]struct {
+		m1, m2 string
+		eq     bool
+	}{
+		{m1, m1, true},
+		{m1, "POST /a HTTP/1.1\r\nhost:   foo\r\ncontent-length:3\r\n\r\nabc",
+			true},
+		{m1, "POST /b HTTP/1.1\r\nHost: foo\r\nContent-Length: 3\r\n\r\nabc",
+			false},
+		{m1, "POST /a HTTP/1.1\r\nHost: foo\r\nContent-Length: 3\r\n\r\nabd",
+			false},
+		{m1, "PUT /a HTTP/1.1\r\nHost: foo\r\nContent-Length: 3\r\n\r\nabc",
+			false},
+		{m1, "POST /a HTTP/1.0\r\nHost: foo\r\nContent-Length: 3\r\n\r\nabc",
+			false},
+		{m1, "POST /a HTTP/1.1\r\nHost: bar\r\nContent-Length: 3\r\n\r\nabc",
+			false},
+		{m1, "POST /a HTTP/1.1\r\nHost: foo\r\nContent-Length: 3\r\n" +
+			"X: 1\r\n\r\nabc", false},
+		{m1, "POST /a HTTP/1.1\r\nHost: foo\r\nTransfer-Encoding: chunked" +
+			"\r\n\r\n3\r\nabc\r\n0\r\n\r\n", false},
+		{"HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n",
+			"HTTP/1.1 200 Ok\r\nContent-Length: 0\r\n\r\n", true},
+		{"HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n",
+			"HTTP/1.1 201 OK\r\nContent-Length: 0\r\n\r\n", false},
+	}
+	for _, c := range tests {
+		var msg1, msg2 PMsg
+		msg1.Init(nil, nil)
+		msg2.Init(nil, nil)
+		msg1.PrevMethod = MGet
+		msg2.PrevMethod = MGet
+		buf1 := []byte(c.m1)
+		buf2 := []byte("xxx" + c.m2) // different offset
+		if _, err := ParseMsg(buf1, 0, &msg1, 0); err != 0 {
+			t.Fatalf("ParseMsg(%q, 0, ..) = %d(%q)", buf1, err, err)
+		}
+		// parse the second one piece-wise
+		o := 3
+		err := ErrHdrMoreBytes
+		for end := 4; end <= len(buf2) && err == ErrHdrMoreBytes; end++ {
+			o, err = ParseMsg(buf2[:end], o, &msg2, 0)
+		}
+		if err != 0 {
+			t.Fatalf("ParseMsg(%q, 3, ..) = %d(%q)", buf2, err, err)
+		}
+		if msg1.FramingEqual(&msg2) != c.eq ||
+			msg2.FramingEqual(&msg1) != c.eq {
+			t.Errorf("FramingEqual(%q, %q) = %v, expected %v",
+				c.m1, c.m2, msg1.FramingEqual(&msg2), c.eq)
+		}
+	}
+}
+
+func TestParseMsgPragmaExt(t *testing.T) {
+	tests := [...]struct {
+		m       string
+		noCache bool
+	}{
+		{"GET / HTTP/1.1\r\nHost: foo\r\nPragma: no-cache, foo=bar\r\n" +
+			"\r\n", true},
+		{"GET / HTTP/1.1\r\nHost: foo\r\nPragma: foo=\"x\"\r\n\r\n",
+			false},
+		{"GET / HTTP/1.1\r\nPragma: foo = \"a,b\" , bar\r\n" +
+			"Pragma: no-cache\r\nHost: foo\r\n\r\n", true},
+	}
+	for _, c := range tests {
+		buf := []byte(c.m)
+		// full message and byte by byte
+		for _, step := range []int{len(buf), 1} {
+			var msg PMsg
+			msg.Init(nil, nil)
+			o := 0
+			err := ErrHdrMoreBytes
+			for e := step; e <= len(buf) && err == ErrHdrMoreBytes; e += step {
+				o, err = ParseMsg(buf[:e], o, &msg, 0)
+			}
+			if err != 0 || o != len(buf) {
+				t.Errorf("ParseMsg(%q) step %d = [%d, %d(%q)]",
+					c.m, step, o, err, err)
+				continue
+			}
+			if msg.PV.Pragma.NoCache != c.noCache {
+				t.Errorf("ParseMsg(%q) step %d: NoCache %v, expected %v",
+					c.m, step, msg.PV.Pragma.NoCache, c.noCache)
+			}
+			if h := msg.HL.GetHdr(HdrPragma); !h.Missing() &&
+				h.Val.Empty() {
+				t.Errorf("ParseMsg(%q) step %d: empty Pragma value",
+					c.m, step)
+			}
+		}
+	}
+}
+
+func TestParseMsgEmptyHdrVal(t *testing.T) {
+	names := [...]string{"Foo", "Upgrade", "Sec-WebSocket-Protocol",
+		"Sec-WebSocket-Extensions", "Content-Disposition", "Content-Type",
+		"Vary", "Pragma", "Warning", "Link", "Proxy-Authenticate",
+		"Proxy-Authorization", "Access-Control-Request-Method",
+		"Access-Control-Request-Headers", "Access-Control-Allow-Origin",
+		"Access-Control-Allow-Methods", "Access-Control-Allow-Headers",
+		"Content-Language", "Connection", "If-Range", "Expect-CT",
+		"Strict-Transport-Security"}
+	for _, n := range names {
+		for _, v := range []string{"", " ", " \t "} {
+			// an empty value must not end the headers
+			m := "POST / HTTP/1.1\r\nHost: foo\r\n" + n + ":" + v +
+				"\r\nContent-Length: 5\r\nX-Foo: bar\r\n\r\nhello"
+			buf := []byte(m)
+			for _, step := range []int{len(buf), 1} {
+				var msg PMsg
+				msg.Init(nil, nil)
+				o := 0
+				err := ErrHdrMoreBytes
+				for end := 0; end < len(buf) && err == ErrHdrMoreBytes; {
+					end += step
+					o, err = ParseMsg(buf[:end], o, &msg, 0)
+				}
+				if err != 0 || o != len(buf) {
+					t.Errorf("ParseMsg(%q) step %d = [%d, %d(%q)]",
+						m, step, o, err, err)
+					continue
+				}
+				if msg.HL.N != 4 || !msg.PV.CLen.Parsed() ||
+					msg.PV.CLen.UIVal != 5 ||
+					string(msg.Body.Get(buf)) != "hello" {
+					t.Errorf("ParseMsg(%q) step %d: %d headers, CLen %d,"+
+						" body %q", m, step, msg.HL.N, msg.PV.CLen.UIVal,
+						msg.Body.Get(buf))
+				}
+			}
+		}
+	}
+	// empty Transfer-Encoding (framing header) is rejected
+	m := "POST / HTTP/1.1\r\nHost: foo\r\nTransfer-Encoding:\r\n" +
+		"Content-Length: 5\r\n\r\nhello"
+	var msg PMsg
+	msg.Init(nil, nil)
+	if _, err := ParseMsg([]byte(m), 0, &msg, 0); err != ErrHdrBadTrEnc {
+		t.Errorf("ParseMsg(%q) = %d(%q), expected %d(%q)",
+			m, err, err, ErrHdrBadTrEnc, ErrHdrBadTrEnc)
+	}
+}
+
+func TestPMsgFramingHdrCount(t *testing.T) {
+	tests := [...]struct {
+		m           string
+		clen, trenc int
+	}{
+		{"GET / HTTP/1.1\r\nHost: foo\r\n\r\n", 0, 0},
+		{"POST / HTTP/1.1\r\nContent-Length: 3\r\n\r\n", 1, 0},
+		{"POST / HTTP/1.1\r\nContent-Length: 3\r\n" +
+			"Content-Length: 3\r\n\r\n", 2, 0},
+		{"POST / HTTP/1.1\r\nContent-Length: 3, 3\r\n\r\n", 1, 0},
+		{"POST / HTTP/1.1\r\nContent-Length: 3\r\nX: y\r\n" +
+			"content-length:3\r\nContent-Length: 3\r\n\r\n", 3, 0},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: gzip, chunked\r\n\r\n",
+			0, 1},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: gzip\r\n" +
+			"Transfer-Encoding: chunked\r\n\r\n", 0, 2},
+		{"POST / HTTP/1.1\r\nContent-Length: 3\r\n" +
+			"Transfer-Encoding: chunked\r\n\r\n", 1, 1},
+	}
+	for _, c := range tests {
+		var msg PMsg
+		msg.Init(nil, nil)
+		buf := []byte(c.m)
+		if _, err := ParseMsg(buf, 0, &msg, MsgStopAfterHdrsF); err != 0 {
+			t.Fatalf("ParseMsg(%q) failed: %d(%q)", c.m, err, err)
+		}
+		if msg.CLenHdrCount() != c.clen || msg.TrEncHdrCount() != c.trenc {
+			t.Errorf("ParseMsg(%q): CLenHdrCount() = %d,"+
+				" TrEncHdrCount() = %d, expected %d, %d", c.m,
+				msg.CLenHdrCount(), msg.TrEncHdrCount(), c.clen, c.trenc)
+		}
+		// byte by byte
+		msg.Reset()
+		o := 0
+		err := ErrHdrMoreBytes
+		for end := 1; end <= len(buf) && err == ErrHdrMoreBytes; end++ {
+			o, err = ParseMsg(buf[:end], o, &msg, MsgStopAfterHdrsF)
+		}
+		if err != 0 {
+			t.Fatalf("ParseMsg(%q) piece-wise failed: %d(%q)", c.m, err, err)
+		}
+		if msg.CLenHdrCount() != c.clen || msg.TrEncHdrCount() != c.trenc {
+			t.Errorf("ParseMsg(%q) piece-wise: CLenHdrCount() = %d,"+
+				" TrEncHdrCount() = %d, expected %d, %d", c.m,
+				msg.CLenHdrCount(), msg.TrEncHdrCount(), c.clen, c.trenc)
+		}
+	}
+}
+
+func TestParseMsgDeclaredBodyLen(t *testing.T) {
+	tests := [...]struct {
+		m    string
+		prvM HTTPMethod
+		l    int64
+		bt   MsgPState
+	}{
+		{"POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 42\r\n\r\n",
+			MUndef, 42, MsgBodyCLen},
+		{"GET / HTTP/1.1\r\nHost: a\r\n\r\n", MUndef, 0, MsgNoBody},
+		{"POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n",
+			MUndef, -1, MsgBodyChunked},
+		{"HTTP/1.1 200 OK\r\nServer: a\r\n\r\n", MGet, -1, MsgBodyEOF},
+		{"HTTP/1.1 200 OK\r\nContent-Length: 7\r\n\r\n", MHead, 0,
+			MsgNoBody},
+		{"HTTP/1.1 200 OK\r\nContent-Length: 7\r\n\r\n", MGet, 7,
+			MsgBodyCLen},
+		{"HTTP/1.1 200 OK\r\nServer: a\r\n\r\n", MConnect, 0, MsgNoBody},
+	}
+	for _, c := range tests {
+		buf := []byte(c.m)
+		for _, flags := range []MsgFlags{MsgSkipBodyF, MsgStopAfterHdrsF} {
+			var msg PMsg
+			msg.Init(nil, nil)
+			msg.PrevMethod = c.prvM
+			if l, bt := msg.DeclaredBodyLen(); l != -1 || bt != MsgErr {
+				t.Errorf("DeclaredBodyLen() = %d, %d before parsing", l, bt)
+			}
+			if _, err := ParseMsg(buf, 0, &msg, flags); err != 0 {
+				t.Errorf("ParseMsg(%q, 0, .., 0x%x) = %d(%q)",
+					buf, flags, err, err)
+				continue
+			}
+			if l, bt := msg.DeclaredBodyLen(); l != c.l || bt != c.bt {
+				t.Errorf("ParseMsg(%q, 0, .., 0x%x): DeclaredBodyLen() ="+
+					" %d, %d, expected %d, %d", buf, flags, l, bt, c.l, c.bt)
+			}
+		}
+	}
+}
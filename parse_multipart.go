@@ -0,0 +1,249 @@
+// Copyright 2021 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+import (
+	"bytes"
+
+	"github.com/intuitivelabs/bytescase"
+)
+
+// MPart contains a parsed multipart body part.
+type MPart struct {
+	Hdrs HdrLst // part headers (Hdrs.Hdrs can be pre-allocated)
+	Body PField // part body (without the delimiter CRLF)
+}
+
+// MultipartReader iterates over the parts of a complete multipart body
+// (rfc2046 5.1.1, rfc7578).
+// The body must be fully available and not chunked encoded.
+type MultipartReader struct {
+	Preamble PField // text before the first delimiter (ignored)
+	Epilogue PField // text after the closing delimiter (ignored)
+	N        int    // number of parts returned so far
+
+	buf      []byte // buffer containing the body
+	body     PField // complete multipart body
+	boundary []byte // boundary value (without the leading "--")
+	offs     int    // current offset
+	state    uint8  // internal state
+}
+
+// internal MultipartReader states
+const (
+	mpInit  uint8 = iota // looking for the first delimiter
+	mpParts              // inside the body parts
+	mpEnd                // closing delimiter found
+)
+
+// Init initializes the reader for iterating over the multipart body
+// that can be found at the body offset in buf, using the passed boundary
+// (the "boundary" Content-Type parameter value, unquoted).
+func (r *MultipartReader) Init(buf []byte, body PField, boundary []byte) {
+	*r = MultipartReader{}
+	r.buf = buf
+	r.body = body
+	r.boundary = boundary
+	r.offs = int(body.Offs)
+}
+
+// InitMsg initializes the reader for iterating over the body of the
+// passed parsed message, using the Content-Type boundary.
+// It returns ErrHdrValBad if the message does not have a multipart
+// Content-Type or the boundary is missing.
+func (r *MultipartReader) InitMsg(msg *PMsg) ErrorHdr {
+	ct := &msg.PV.CType
+	if !ct.Parsed() || !ct.IsMultipart(msg.Buf) || ct.Boundary.Empty() {
+		return ErrHdrValBad
+	}
+	r.Init(msg.Buf, msg.Body, ct.Boundary.Get(msg.Buf))
+	return 0
+}
+
+// Next parses the next body part, filling p.
+// The part headers are parsed using ParseHeaders() and p.Hdrs and hb (if
+// not nil) are reset-ed before.
+// It returns 0 on success, ErrHdrEmpty if there are no more parts
+// (closing delimiter reached), ErrHdrTrunc if the body ends before the
+// closing delimiter, ErrHdrBad if no delimiter can be found or some other
+// error from parsing the part headers.
+func (r *MultipartReader) Next(p *MPart, hb PHBodies) ErrorHdr {
+	p.Hdrs.Reset()
+	p.Body.Reset()
+	if hb != nil {
+		hb.Reset()
+	}
+	switch r.state {
+	case mpInit:
+		s, e, closing, found := r.findDelim(r.offs)
+		if !found {
+			return ErrHdrBad
+		}
+		r.Preamble.Set(int(r.body.Offs), s)
+		r.offs = e
+		r.state = mpParts
+		if closing {
+			r.state = mpEnd
+			r.Epilogue.Set(e, r.body.EndOffs())
+			return ErrHdrEmpty
+		}
+	case mpEnd:
+		return ErrHdrEmpty
+	}
+	// mpParts
+	s, e, closing, found := r.findDelim(r.offs)
+	if !found {
+		return ErrHdrTrunc
+	}
+	// part headers
+	o := r.offs
+	if s > o {
+		n, err := ParseHeaders(r.buf[:s], o, &p.Hdrs, hb)
+		switch err {
+		case 0, ErrHdrEmpty:
+			o = n
+		case ErrHdrMoreBytes:
+			// no end of headers found
+			return ErrHdrBad
+		default:
+			return err
+		}
+	}
+	p.Body.Set(o, s)
+	r.offs = e
+	r.N++
+	if closing {
+		r.state = mpEnd
+		r.Epilogue.Set(e, r.body.EndOffs())
+	}
+	return 0
+}
+
+// BRPart contains a parsed multipart/byteranges body part.
+type BRPart struct {
+	MPart
+	Range PContentRange // parsed part Content-Range
+}
+
+// ByteRangesReader iterates over the parts of a complete
+// multipart/byteranges body (a 206 reply with multiple ranges, see
+// rfc7233 4.1). It works like MultipartReader, but it also parses and
+// checks the Content-Range header of each part.
+type ByteRangesReader struct {
+	MultipartReader
+}
+
+// InitMsg initializes the reader for iterating over the body of the
+// passed parsed message, using the Content-Type boundary.
+// It returns ErrHdrValBad if the message does not have a
+// multipart/byteranges Content-Type or the boundary is missing.
+func (r *ByteRangesReader) InitMsg(msg *PMsg) ErrorHdr {
+	ct := &msg.PV.CType
+	if !ct.Parsed() || !ct.IsByteRanges(msg.Buf) {
+		return ErrHdrValBad
+	}
+	return r.MultipartReader.InitMsg(msg)
+}
+
+// Next parses the next body part, filling p (see MultipartReader.Next()).
+// p.Hdrs.Hdrs must have enough space for the part headers (the
+// Content-Range header is searched only in it).
+// Besides the MultipartReader.Next() errors it returns
+// ErrHdrMissingCRange if the part has no Content-Range header and
+// ErrHdrValBad if it has more than one, if the range is unsatisfied or
+// if its length is different from the part body length (or the errors
+// returned by ParseContentRange()).
+func (r *ByteRangesReader) Next(p *BRPart, hb PHBodies) ErrorHdr {
+	p.Range.Reset()
+	if err := r.MultipartReader.Next(&p.MPart, hb); err != 0 {
+		return err
+	}
+	n := p.Hdrs.N
+	if n > len(p.Hdrs.Hdrs) {
+		n = len(p.Hdrs.Hdrs)
+	}
+	for i := 0; i < n; i++ {
+		h := &p.Hdrs.Hdrs[i]
+		if h.Type != HdrOther || h.Name.Len != 13 ||
+			!bytescase.CmpEq(h.Name.Get(r.buf), []byte("content-range")) {
+			continue
+		}
+		if p.Range.Parsed() {
+			return ErrHdrValBad
+		}
+		if err := ParseContentRange(r.buf, h.Val, &p.Range); err != 0 {
+			return err
+		}
+	}
+	if !p.Range.Parsed() {
+		return ErrHdrMissingCRange
+	}
+	if p.Range.Unsatisfied() || p.Range.Len() != int64(p.Body.Len) {
+		return ErrHdrValBad
+	}
+	return 0
+}
+
+// findDelim looks for the next boundary delimiter line, starting at offs.
+// It returns the delimiter start (including the CRLF in front, if it
+// is after offs), the offset after the delimiter line, whether it is the
+// closing delimiter and true if found.
+func (r *MultipartReader) findDelim(offs int) (int, int, bool, bool) {
+	bstart := int(r.body.Offs)
+	end := r.body.EndOffs()
+	if len(r.boundary) == 0 {
+		return 0, 0, false, false
+	}
+	o := offs
+	for o < end {
+		i := bytes.Index(r.buf[o:end], r.boundary)
+		if i < 0 {
+			break
+		}
+		i += o
+		o = i + 1 // next search position
+		// check for "--" in front, at line start
+		s := i - 2
+		if s < offs || r.buf[s] != '-' || r.buf[s+1] != '-' {
+			continue
+		}
+		if s > bstart {
+			if r.buf[s-1] != '\n' {
+				continue
+			}
+			// include CRLF (or LF) in front, if part of the current part
+			if s-1 >= offs {
+				s--
+				if s-1 >= offs && r.buf[s-1] == '\r' {
+					s--
+				}
+			}
+		}
+		// check the rest of the delimiter line
+		j := i + len(r.boundary)
+		closing := false
+		if (j+1) < end && r.buf[j] == '-' && r.buf[j+1] == '-' {
+			closing = true
+			j += 2
+		}
+		for j < end && (r.buf[j] == ' ' || r.buf[j] == '\t') {
+			j++ // skip transport padding
+		}
+		if j < end {
+			if r.buf[j] == '\r' && (j+1) < end && r.buf[j+1] == '\n' {
+				j += 2
+			} else if r.buf[j] == '\n' {
+				j++
+			} else {
+				// not a delimiter, boundary followed by something else
+				continue
+			}
+		}
+		return s, j, closing, true
+	}
+	return 0, 0, false, false
+}
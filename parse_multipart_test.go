@@ -0,0 +1,300 @@
+// Copyright 2021 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestMultipartReader(t *testing.T) {
+	type mpPart struct {
+		hdrs  int    // number of part headers
+		fname string // Content-Disposition filename
+		body  string
+	}
+	type testCase struct {
+		msg      string // complete message, \r & \n escaped
+		err      ErrorHdr
+		preamble string
+		epilogue string
+		parts    []mpPart
+	}
+
+	tests := [...]testCase{
+		{msg: "POST /upload HTTP/1.1\r\nHost: foo.bar\r\n" +
+			"Content-Type: multipart/form-data; boundary=xYzZY\r\n" +
+			"Content-Length: 198\r\n\r\n" +
+			"--xYzZY\r\n" +
+			"Content-Disposition: form-data; name=\"field1\"\r\n\r\n" +
+			"value1\r\n" +
+			"--xYzZY\r\n" +
+			"Content-Disposition: form-data; name=\"f\"; filename=\"a.txt\"\r\n" +
+			"Content-Type: text/plain\r\n\r\n" +
+			"line1\r\nline2 --xYzZY\r\n\r\n" +
+			"--xYzZY--\r\n",
+			parts: []mpPart{
+				{hdrs: 1, body: "value1"},
+				{hdrs: 2, fname: "a.txt", body: "line1\r\nline2 --xYzZY\r\n"},
+			},
+		},
+		{msg: "HTTP/1.1 200 OK\r\n" +
+			"Content-Type: multipart/mixed; boundary=\"simple boundary\"\r\n" +
+			"Content-Length: 181\r\n\r\n" +
+			"This is the preamble.\r\n" +
+			"--simple boundary\r\n\r\n" +
+			"implicitly typed plain US-ASCII text.\r\n" +
+			"--simple boundary  \r\n" +
+			"Content-type: text/plain; charset=us-ascii\r\n\r\n" +
+			"\r\n" +
+			"--simple boundary--\r\n" +
+			"epilogue",
+			preamble: "This is the preamble.",
+			epilogue: "epilogue",
+			parts: []mpPart{
+				{hdrs: 0, body: "implicitly typed plain US-ASCII text."},
+				{hdrs: 1, body: ""},
+			},
+		},
+		{msg: "HTTP/1.1 200 OK\r\n" +
+			"Content-Type: multipart/mixed; boundary=b\r\n" +
+			"Content-Length: 5\r\n\r\n" +
+			"--b--",
+		},
+		{msg: "HTTP/1.1 200 OK\r\n" +
+			"Content-Type: multipart/mixed; boundary=b\r\n" +
+			"Content-Length: 12\r\n\r\n" +
+			"--b\r\n\r\nfoo\r\n",
+			err:   ErrHdrTrunc,
+			parts: []mpPart{},
+		},
+		{msg: "HTTP/1.1 200 OK\r\n" +
+			"Content-Type: multipart/mixed; boundary=b\r\n" +
+			"Content-Length: 11\r\n\r\n" +
+			"--bx\r\nfoo\r\n",
+			err: ErrHdrBad,
+		},
+	}
+
+	for _, c := range tests {
+		var msg PMsg
+		buf := []byte(c.msg)
+		o, err := ParseMsg(buf, 0, &msg, 0)
+		if err != 0 || o != len(buf) {
+			t.Fatalf("ParseMsg(%q, 0, ..) = [%d, %d(%q)] unexpected",
+				buf, o, err, err)
+		}
+		var r MultipartReader
+		if err = r.InitMsg(&msg); err != 0 {
+			t.Errorf("InitMsg(%q) failed: %d(%q)", buf, err, err)
+			continue
+		}
+		var p MPart
+		var pv PHdrVals
+		var hdrs [4]Hdr
+		p.Hdrs.Hdrs = hdrs[:]
+		i := 0
+		for {
+			err = r.Next(&p, &pv)
+			if err != 0 {
+				break
+			}
+			if i >= len(c.parts) {
+				t.Errorf("MultipartReader(%q): too many parts %d", buf, i+1)
+				break
+			}
+			e := &c.parts[i]
+			if p.Hdrs.N != e.hdrs {
+				t.Errorf("MultipartReader(%q): part %d: %d headers,"+
+					" expected %d", buf, i, p.Hdrs.N, e.hdrs)
+			}
+			if fn := pv.CDisp.GetFilename(nil, buf); string(fn) != e.fname {
+				t.Errorf("MultipartReader(%q): part %d: filename %q,"+
+					" expected %q", buf, i, fn, e.fname)
+			}
+			if string(p.Body.Get(buf)) != e.body {
+				t.Errorf("MultipartReader(%q): part %d: body %q,"+
+					" expected %q", buf, i, p.Body.Get(buf), e.body)
+			}
+			i++
+		}
+		eErr := c.err
+		if eErr == 0 {
+			eErr = ErrHdrEmpty
+		}
+		if err != eErr {
+			t.Errorf("MultipartReader(%q): error %d(%q), expected %q",
+				buf, err, err, eErr)
+		}
+		if i != len(c.parts) || r.N != i {
+			t.Errorf("MultipartReader(%q): %d parts (N %d), expected %d",
+				buf, i, r.N, len(c.parts))
+		}
+		if string(r.Preamble.Get(buf)) != c.preamble {
+			t.Errorf("MultipartReader(%q): preamble %q, expected %q",
+				buf, r.Preamble.Get(buf), c.preamble)
+		}
+		if string(r.Epilogue.Get(buf)) != c.epilogue {
+			t.Errorf("MultipartReader(%q): epilogue %q, expected %q",
+				buf, r.Epilogue.Get(buf), c.epilogue)
+		}
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := [...]struct {
+		v                     string
+		err                   ErrorHdr
+		first, last, complete int64
+	}{
+		{"bytes 0-499/1234", 0, 0, 499, 1234},
+		{"bytes 500-999/*", 0, 500, 999, -1},
+		{"BYTES 7-7/8", 0, 7, 7, 8},
+		{"bytes */1234", 0, -1, -1, 1234},
+		{"bytes */*", ErrHdrValBad, 0, 0, 0},
+		{"bytes 5-4/10", ErrHdrValBad, 0, 0, 0},
+		{"bytes 0-10/10", ErrHdrValBad, 0, 0, 0},
+		{"bytes 0-9", ErrHdrValBad, 0, 0, 0},
+		{"bytes 09/10", ErrHdrValBad, 0, 0, 0},
+		{"bytes a-9/10", ErrHdrValNotNumber, 0, 0, 0},
+		{"bytes -9/10", ErrHdrValNotNumber, 0, 0, 0},
+		{"bytes 0-99999999999999999999/*", ErrHdrNumTooBig, 0, 0, 0},
+		{"items 0-9/10", ErrHdrValBad, 0, 0, 0},
+		{"bytes", ErrHdrValBad, 0, 0, 0},
+	}
+	for _, c := range tests {
+		buf := []byte("X" + c.v)
+		var v PField
+		v.Set(1, len(buf))
+		var cr PContentRange
+		err := ParseContentRange(buf, v, &cr)
+		if err != c.err {
+			t.Errorf("ParseContentRange(%q) = %d(%q), expected %d(%q)",
+				c.v, err, err, c.err, c.err)
+			continue
+		}
+		if err != 0 {
+			if cr.Parsed() {
+				t.Errorf("ParseContentRange(%q) failed, but Parsed()", c.v)
+			}
+			continue
+		}
+		if !cr.Parsed() || cr.First != c.first || cr.Last != c.last ||
+			cr.Complete != c.complete || string(cr.Val.Get(buf)) != c.v {
+			t.Errorf("ParseContentRange(%q) = %+v", c.v, cr)
+		}
+		if l := cr.Len(); (c.first < 0 && l != 0) ||
+			(c.first >= 0 && l != c.last-c.first+1) {
+			t.Errorf("ParseContentRange(%q): Len() = %d", c.v, l)
+		}
+	}
+}
+
+func TestByteRangesReader(t *testing.T) {
+	type brPart struct {
+		first, last int64
+		body        string
+	}
+	tests := [...]struct {
+		ctype string
+		body  string
+		err   ErrorHdr
+		parts []brPart
+	}{
+		{"multipart/byteranges; boundary=THIS_STRING_SEPARATES",
+			"--THIS_STRING_SEPARATES\r\n" +
+				"Content-Type: application/pdf\r\n" +
+				"Content-Range: bytes 500-509/8000\r\n\r\n" +
+				"0123456789\r\n" +
+				"--THIS_STRING_SEPARATES\r\n" +
+				"Content-Type: application/pdf\r\n" +
+				"content-range: bytes 7000-7003/8000\r\n\r\n" +
+				"abcd\r\n" +
+				"--THIS_STRING_SEPARATES--\r\n",
+			0, []brPart{{500, 509, "0123456789"}, {7000, 7003, "abcd"}},
+		},
+		{"multipart/byteranges; boundary=b",
+			"--b\r\nContent-Range: bytes 0-1/2\r\n\r\nab\r\n" +
+				"--b\r\nContent-Type: text/plain\r\n\r\ncd\r\n--b--\r\n",
+			ErrHdrMissingCRange, []brPart{{0, 1, "ab"}},
+		},
+		{"multipart/byteranges; boundary=b",
+			"--b\r\nContent-Range: bytes 0-2/5\r\n\r\nab\r\n--b--\r\n",
+			ErrHdrValBad, nil,
+		},
+		{"multipart/byteranges; boundary=b",
+			"--b\r\nContent-Range: bytes 0-1/5\r\n" +
+				"Content-Range: bytes 0-1/5\r\n\r\nab\r\n--b--\r\n",
+			ErrHdrValBad, nil,
+		},
+		{"multipart/byteranges; boundary=b",
+			"--b\r\nContent-Range: bytes */5\r\n\r\n\r\n--b--\r\n",
+			ErrHdrValBad, nil,
+		},
+		{"multipart/byteranges; boundary=b",
+			"--b\r\nContent-Range: bytes x-1/5\r\n\r\nab\r\n--b--\r\n",
+			ErrHdrValNotNumber, nil,
+		},
+	}
+	for _, c := range tests {
+		m := "HTTP/1.1 206 Partial Content\r\n" +
+			"Content-Type: " + c.ctype + "\r\n" +
+			"Content-Length: " + strconv.Itoa(len(c.body)) + "\r\n\r\n" +
+			c.body
+		var msg PMsg
+		msg.Init(nil, nil)
+		buf := []byte(m)
+		if _, err := ParseMsg(buf, 0, &msg, 0); err != 0 {
+			t.Fatalf("ParseMsg(%q) failed: %d(%q)", m, err, err)
+		}
+		var r ByteRangesReader
+		if err := r.InitMsg(&msg); err != 0 {
+			t.Fatalf("InitMsg(%q) failed: %d(%q)", m, err, err)
+		}
+		var p BRPart
+		var hdrs [4]Hdr
+		p.Hdrs.Hdrs = hdrs[:]
+		var err ErrorHdr
+		i := 0
+		for ; ; i++ {
+			if err = r.Next(&p, nil); err != 0 {
+				break
+			}
+			if i >= len(c.parts) {
+				t.Fatalf("ByteRangesReader(%q): too many parts", m)
+			}
+			e := &c.parts[i]
+			if p.Range.First != e.first || p.Range.Last != e.last ||
+				string(p.Body.Get(buf)) != e.body {
+				t.Errorf("ByteRangesReader(%q): part %d: range %d-%d,"+
+					" body %q", m, i, p.Range.First, p.Range.Last,
+					p.Body.Get(buf))
+			}
+		}
+		eErr := c.err
+		if eErr == 0 {
+			eErr = ErrHdrEmpty
+		}
+		if err != eErr || i != len(c.parts) {
+			t.Errorf("ByteRangesReader(%q): %d parts, error %d(%q),"+
+				" expected %d, %q", m, i, err, err, len(c.parts), eErr)
+		}
+	}
+	// not multipart/byteranges
+	var msg PMsg
+	msg.Init(nil, nil)
+	buf := []byte("HTTP/1.1 200 OK\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n" +
+		"Content-Length: 5\r\n\r\n--b--")
+	if _, err := ParseMsg(buf, 0, &msg, 0); err != 0 {
+		t.Fatalf("ParseMsg(%q) failed: %d(%q)", buf, err, err)
+	}
+	var r ByteRangesReader
+	if err := r.InitMsg(&msg); err != ErrHdrValBad {
+		t.Errorf("InitMsg(%q) = %d(%q)", buf, err, err)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+import (
+	"github.com/intuitivelabs/bytescase"
+)
+
+// PPragma contains the parsed Pragma header values for one or more
+// different headers (rfc7234 5.4).
+// Only the "no-cache" directive is interpreted.
+type PPragma struct {
+	N       int  // no of  _values_ found
+	HNo     int  // no of different Pragma _headers_ found
+	NoCache bool // "no-cache" found
+	// parsed hdr content during the last ParseAll... call
+	// (contains a trimmed value or several values, overwritten by each
+	//  ParseAll.. call; it can also be empty, e.g. on ErrHdrMoreByte)
+	LastParsed PField
+	hValState  // temporary saved state (between calls)
+}
+
+// Reset re-initializes the parsed values.
+func (p *PPragma) Reset() {
+	*p = PPragma{}
+}
+
+// Empty returns true if no Pragma values have been parsed.
+func (p *PPragma) Empty() bool {
+	return p.N == 0
+}
+
+// Parsed returns true if there are some parsed Pragma values.
+func (p *PPragma) Parsed() bool {
+	return p.N > 0
+}
+
+// ParseAllPragmaValues tries to parse all the values in a Pragma header
+// situated at offs in buf and adds them to the passed PPragma values.
+// The return values are: a new offset after the parsed value (that can be
+// used to continue parsing), the number of header values parsed and an error.
+// It can return ErrHdrMoreBytes if more data is needed (the value is not
+// fully contained in buf).
+// Extension pragmas (token [ "=" ( token / quoted-string ) ]) are accepted
+// and ignored.
+func ParseAllPragmaValues(buf []byte, offs int, p *PPragma) (int, int, ErrorHdr) {
+	p.LastParsed.Reset() // clear LastParsed on each call
+	next, end, err := findHdrValEnd(buf, offs, &p.hValState)
+	if err != 0 {
+		return next, 0, err
+	}
+	var f PField
+	vstart := p.vstart
+	f.Set(vstart, end)
+	vNo := 0
+	noCache := false
+	err = ParseDirectiveList(buf, f, ',', func(name, val PField) bool {
+		n := name.Get(buf)
+		if len(n) == 8 && bytescase.CmpEq(n, []byte("no-cache")) {
+			noCache = true
+		}
+		vNo++
+		return true
+	})
+	p.hValState = hValState{} // prepare for the next header
+	if err != 0 {
+		return vstart, 0, err
+	}
+	p.LastParsed = f
+	p.N += vNo
+	p.NoCache = p.NoCache || noCache
+	return next, vNo, 0
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+// ParseProductTokens iterates over the product tokens and comments
+// from a Server or User-Agent header value (rfc7231 5.5.3 & 7.4.2):
+//
+//	product *( RWS ( product / comment ) )
+//	product = token ["/" product-version]
+//
+// The parameters are the buffer containing the value, the value field
+// (e.g. Hdr.Val) and a callback function that will be called for each
+// product found, with the product name, the version (empty if not present)
+// and the first comment following the product (empty if missing).
+// Comments that do not immediately follow a product are reported with an
+// empty product and version. The callback should return false to stop the
+// iteration.
+// Nested comments are supported and returned as a whole (including the
+// enclosing parentheses).
+// It returns 0 on success, ErrHdrBadChar if an invalid character was
+// encountered or ErrHdrValBad if a comment is not terminated.
+func ParseProductTokens(buf []byte, f PField,
+	fn func(product, version, comment PField) bool) ErrorHdr {
+
+	var prod, ver, comm PField
+	pending := false // product found, but not yet reported
+	i := int(f.Offs)
+	end := f.EndOffs()
+	for i < end {
+		switch buf[i] {
+		case ' ', '\t', '\r', '\n':
+			i++
+		case '(':
+			n, err := skipComment(buf, i, end)
+			if err != 0 {
+				return err
+			}
+			comm.Set(i, n)
+			i = n
+			cont := fn(prod, ver, comm)
+			pending = false
+			prod.Reset()
+			ver.Reset()
+			if !cont {
+				return 0
+			}
+		default:
+			if pending && !fn(prod, ver, PField{}) {
+				return 0
+			}
+			s := i
+			for i < end && tcharAllowed(buf[i]) {
+				i++
+			}
+			if i == s {
+				return ErrHdrBadChar
+			}
+			prod.Set(s, i)
+			ver.Reset()
+			if i < end && buf[i] == '/' {
+				i++
+				s = i
+				for i < end && tcharAllowed(buf[i]) {
+					i++
+				}
+				if i == s {
+					return ErrHdrBadChar
+				}
+				ver.Set(s, i)
+			}
+			if i < end && buf[i] != ' ' && buf[i] != '\t' &&
+				buf[i] != '\r' && buf[i] != '\n' && buf[i] != '(' {
+				return ErrHdrBadChar
+			}
+			pending = true
+		}
+	}
+	if pending {
+		fn(prod, ver, PField{})
+	}
+	return 0
+}
+
+// skipComment skips over a (possibly nested) comment, starting at offs
+// (that should point to the opening '(') and ending before end.
+// It returns the offset after the closing ')' and 0 on success.
+func skipComment(buf []byte, offs, end int) (int, ErrorHdr) {
+	depth := 0
+	for i := offs; i < end; i++ {
+		switch c := buf[i]; c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i + 1, 0
+			}
+		case '\\': // quoted-pair
+			i++
+			if i < end && (buf[i] == '\r' || buf[i] == '\n') {
+				return i, ErrHdrBadChar
+			}
+		default:
+			if (c < 0x20 && c != '\t') || c == 0x7f {
+				return i, ErrHdrBadChar
+			}
+		}
+	}
+	return end, ErrHdrValBad
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+import (
+	"testing"
+)
+
+func TestParseProductTokens(t *testing.T) {
+	type testCase struct {
+		v    string
+		err  ErrorHdr
+		prod []string // expected "product|version|comment" values
+	}
+
+	tests := [...]testCase{
+		{v: "Apache", prod: []string{"Apache||"}},
+		{v: "Apache/2.4.1 (Unix)",
+			prod: []string{"Apache|2.4.1|(Unix)"}},
+		{v: "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36" +
+			" (KHTML, like Gecko) Chrome/96.0 Safari/537.36",
+			prod: []string{"Mozilla|5.0|(X11; Linux x86_64)",
+				"AppleWebKit|537.36|(KHTML, like Gecko)",
+				"Chrome|96.0|", "Safari|537.36|"}},
+		{v: "(comment first) foo/1 (a (nested (twice)) \\) c) (extra)",
+			prod: []string{"||(comment first)",
+				"foo|1|(a (nested (twice)) \\) c)", "||(extra)"}},
+		{v: "Foo 	Bar 5.0", prod: []string{"Foo||", "Bar||", "5.0||"}},
+		{v: "curl/7.64.1(x)", prod: []string{"curl|7.64.1|(x)"}},
+		{v: "foo/", err: ErrHdrBadChar, prod: []string{}},
+		{v: "foo/1 (unterminated (x)", err: ErrHdrValBad,
+			prod: []string{}},
+		{v: "foo;bar", err: ErrHdrBadChar, prod: []string{}},
+		{v: "a/1 b@x", err: ErrHdrBadChar, prod: []string{"a|1|"}},
+	}
+
+	for _, c := range tests {
+		buf := []byte("X: " + c.v + "\r\n")
+		var f PField
+		f.Set(3, 3+len(c.v))
+		var res []string
+		err := ParseProductTokens(buf, f,
+			func(p, v, cm PField) bool {
+				res = append(res, string(p.Get(buf))+"|"+
+					string(v.Get(buf))+"|"+string(cm.Get(buf)))
+				return true
+			})
+		if err != c.err {
+			t.Errorf("ParseProductTokens(%q) = %d(%q), expected %q",
+				c.v, err, err, c.err)
+		}
+		if len(res) != len(c.prod) {
+			t.Errorf("ParseProductTokens(%q): %d products %q,"+
+				" expected %d %q", c.v, len(res), res, len(c.prod), c.prod)
+			continue
+		}
+		for i := range res {
+			if res[i] != c.prod[i] {
+				t.Errorf("ParseProductTokens(%q): product %d %q,"+
+					" expected %q", c.v, i, res[i], c.prod[i])
+			}
+		}
+	}
+	// stop the iteration after the first product
+	buf := []byte("a/1 b/2 c/3")
+	n := 0
+	ParseProductTokens(buf, PField{0, OffsT(len(buf))},
+		func(p, v, cm PField) bool { n++; return false })
+	if n != 1 {
+		t.Errorf("ParseProductTokens(%q): callback called %d times,"+
+			" expected 1", buf, n)
+	}
+}
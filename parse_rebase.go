@@ -0,0 +1,522 @@
+// Copyright 2022 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+// Clone returns a deep copy of the parsed message, that does not
+// reference the original buffer anymore: the parsed message data
+// (m.Buf starting from the message start) is copied into a newly allocated
+// buffer and all the parsed values are adjusted to point inside it
+// (the message will start at offset 0 in the new Buf).
+// The headers and the parsed values arrays (e.g. HL.Hdrs or
+// PV.TrEnc.Vals) are copied too, so m can be re-used after the call.
+// It is intended for keeping a parsed message after the input buffer is
+// re-used (e.g. for asynchronous logging). If m is not fully parsed, only
+// the parts already available in m.Buf are copied and the clone should
+// not be used for continuing the parsing.
+func (m *PMsg) Clone() *PMsg {
+	c := new(PMsg)
+	*c = *m
+	start := m.offs
+	if start > len(m.Buf) {
+		start = len(m.Buf)
+	}
+	if m.Buf != nil {
+		c.Buf = append([]byte{}, m.Buf[start:]...)
+	}
+	if m.RawMsg != nil {
+		c.RawMsg = c.Buf[len(c.Buf)-len(m.RawMsg):]
+	}
+	if len(m.HL.Hdrs) > 0 && len(m.HL.Hdrs) <= len(m.hdrs) &&
+		&m.HL.Hdrs[0] == &m.hdrs[0] {
+		// default internal array
+		c.HL.Hdrs = c.hdrs[:len(m.HL.Hdrs)]
+	} else {
+		c.HL.Hdrs = cloneHdrs(m.HL.Hdrs)
+	}
+	c.LastChunk.TrailerHdrs.Hdrs = cloneHdrs(m.LastChunk.TrailerHdrs.Hdrs)
+	if m.BodySegments != nil {
+		c.BodySegments = append([]PField{}, m.BodySegments...)
+	}
+	c.LastChunk.Val.cloneSlices()
+	c.PV.cloneSlices()
+	c.rebase(-start)
+	return c
+}
+
+// RebaseTo updates the message after its data was moved to newBuf, with
+// the bytes before oldStart in the original buffer dropped (newBuf[0:]
+// contains the original buffer data starting at offset oldStart).
+// All the parsed values and the saved internal offsets are adjusted, so
+// that they point inside newBuf and m.Buf and m.RawMsg are set to point
+// inside newBuf. It works both for fully and partially parsed messages
+// (in which case parsing can be continued using newBuf and the returned
+// offset minus oldStart).
+// It returns false and leaves m unchanged if oldStart is after the message
+// start (the parsed values would point to dropped bytes) or if newBuf is
+// too small.
+func (m *PMsg) RebaseTo(newBuf []byte, oldStart int) bool {
+	if oldStart < 0 || (m.state != MsgInit && oldStart > m.offs) ||
+		len(m.Buf)-oldStart > len(newBuf) {
+		return false
+	}
+	if m.Buf != nil {
+		end := len(m.Buf) - oldStart
+		if end < 0 {
+			end = 0
+		}
+		rawLen := len(m.RawMsg)
+		m.Buf = newBuf[:end]
+		if m.RawMsg != nil {
+			m.RawMsg = m.Buf[end-rawLen:]
+		}
+	}
+	m.rebase(-oldStart)
+	return true
+}
+
+// ShiftBuffer updates the message after the input buffer was compacted in
+// place, by moving its content delta bytes towards the start (e.g.
+// copy(buf, buf[delta:])). It allows long-lived streaming parsers to
+// re-use a fixed size buffer, by dropping the already processed bytes
+// (e.g. previous pipelined messages) between ParseMsg() calls, even if
+// the current message is only partially parsed (ErrHdrMoreBytes):
+//  n := copy(buf, buf[msgStart:end]) // msgStart: current message start
+//  msg.ShiftBuffer(msgStart)
+//  o -= msgStart // continue parsing from the adjusted offset
+//  end = n
+//  // ... read more data into buf[end:], then
+//  o, err = ParseMsg(buf[:end], o, &msg, flags)
+// Only bytes before the start of the current message can be dropped
+// (delta must be <= the message start offset, which is the offset
+// passed to the first ParseMsg() call for the message).
+// It returns false and leaves m unchanged if delta is too big
+// (see also RebaseTo()).
+func (m *PMsg) ShiftBuffer(delta int) bool {
+	return m.RebaseTo(m.Buf, delta)
+}
+
+// rebase adjusts all the offsets inside the message (parsed values and
+// internal parsing state) by delta.
+func (m *PMsg) rebase(delta int) {
+	m.FL.rebase(delta)
+	m.PV.rebase(delta)
+	m.HL.rebase(delta)
+	m.Body.rebase(delta)
+	for i := range m.BodySegments {
+		m.BodySegments[i].rebase(delta)
+	}
+	m.LastChunk.rebase(delta)
+	rebaseOffs(&m.offs, delta)
+	rebaseOffs(&m.hdrsOffs, delta)
+	rebaseOffs(&m.bodyOffs, delta)
+	rebaseOffs(&m.cnkOffs, delta)
+	rebaseOffs(&m.lastOffs, delta)
+}
+
+// rebaseOffs adds delta to the offset pointed by o (saturating at 0).
+func rebaseOffs(o *int, delta int) {
+	*o += delta
+	if *o < 0 {
+		*o = 0
+	}
+}
+
+// rebase adds delta to the PField offset. A PField that would start
+// before 0 is reset.
+func (p *PField) rebase(delta int) {
+	o := int(p.Offs) + delta
+	if o < 0 {
+		p.Reset()
+		return
+	}
+	p.Offs = OffsT(o)
+}
+
+func (h *Hdr) rebase(delta int) {
+	h.Name.rebase(delta)
+	h.Val.rebase(delta)
+	h.Raw.rebase(delta)
+}
+
+func (hl *HdrLst) rebase(delta int) {
+	for i := range hl.Hdrs {
+		hl.Hdrs[i].rebase(delta)
+	}
+	for i := range hl.h {
+		hl.h[i].rebase(delta)
+	}
+	hl.hdr.rebase(delta)
+	rebaseOffs(&hl.EndHdrsOffs, delta)
+}
+
+func (fl *PFLine) rebase(delta int) {
+	fl.Method.rebase(delta)
+	fl.URI.rebase(delta)
+	fl.Version.rebase(delta)
+	fl.StatusCode.rebase(delta)
+	fl.Reason.rebase(delta)
+	fl.absHost.rebase(delta)
+}
+
+func (p *PTokParam) rebase(delta int) {
+	p.All.rebase(delta)
+	p.Name.rebase(delta)
+	p.Val.rebase(delta)
+}
+
+func (t *PToken) rebase(delta int) {
+	t.V.rebase(delta)
+	if t.SepOffs != 0 { // 0 means no separator
+		t.SepOffs = OffsT(int(t.SepOffs) + delta)
+	}
+	t.Params.rebase(delta)
+	t.LastParam.rebase(delta)
+	for i := range t.ParamLst {
+		t.ParamLst[i].rebase(delta)
+	}
+	rebaseOffs(&t.soffs, delta)
+}
+
+func (s *hValState) rebase(delta int) {
+	rebaseOffs(&s.vstart, delta)
+}
+
+func (v *ChunkVal) rebase(delta int) {
+	v.Val.rebase(delta)
+	v.TrailerHdrs.rebase(delta)
+	rebaseOffs(&v.trOffs, delta)
+}
+
+func (hv *PHdrVals) rebase(delta int) {
+	hv.CLen.rebase(delta)
+	hv.Upgrade.rebase(delta)
+	hv.TrEnc.rebase(delta)
+	hv.WSProto.rebase(delta)
+	hv.WSExt.rebase(delta)
+	hv.CDisp.rebase(delta)
+	hv.CType.rebase(delta)
+	hv.Vary.rebase(delta)
+	hv.Pragma.rebase(delta)
+	hv.Warning.rebase(delta)
+	hv.Link.rebase(delta)
+	hv.ProxyAuthn.rebase(delta)
+	hv.ProxyAuthz.rebase(delta)
+	hv.ACReqMethod.rebase(delta)
+	hv.ACReqHdrs.rebase(delta)
+	hv.ACAllowOrigin.rebase(delta)
+	hv.ACAllowMethods.rebase(delta)
+	hv.ACAllowHdrs.rebase(delta)
+	hv.CLang.rebase(delta)
+	hv.Conn.rebase(delta)
+	hv.IfRange.rebase(delta)
+	hv.ExpectCT.rebase(delta)
+	hv.STS.rebase(delta)
+}
+
+func (b *PUIntBody) rebase(delta int) {
+	b.SVal.rebase(delta)
+	rebaseOffs(&b.soffs, delta)
+	rebaseOffs(&b.fstart, delta)
+}
+
+func (u *PUpgrade) rebase(delta int) {
+	for i := range u.Vals {
+		u.Vals[i].Val.rebase(delta)
+	}
+	u.LastParsed.rebase(delta)
+	u.tmp.Val.rebase(delta)
+	u.first.Val.rebase(delta)
+}
+
+func (u *PTrEnc) rebase(delta int) {
+	for i := range u.Vals {
+		u.Vals[i].Val.rebase(delta)
+	}
+	u.LastParsed.rebase(delta)
+	u.First.Val.rebase(delta)
+	u.Last.Val.rebase(delta)
+	u.tmp.Val.rebase(delta)
+}
+
+func (u *PWSProto) rebase(delta int) {
+	for i := range u.Vals {
+		u.Vals[i].Val.rebase(delta)
+	}
+	u.LastParsed.rebase(delta)
+	u.tmp.Val.rebase(delta)
+	u.first.Val.rebase(delta)
+}
+
+func (u *PWSExt) rebase(delta int) {
+	for i := range u.Vals {
+		u.Vals[i].Val.rebase(delta)
+	}
+	u.LastParsed.rebase(delta)
+	u.tmp.Val.rebase(delta)
+	u.first.Val.rebase(delta)
+}
+
+func (d *PContentDisposition) rebase(delta int) {
+	d.Val.rebase(delta)
+	d.TypeVal.rebase(delta)
+	d.Name.rebase(delta)
+	d.Filename.rebase(delta)
+	d.FilenameExt.rebase(delta)
+	d.FilenameCharset.rebase(delta)
+	d.FilenameLang.rebase(delta)
+	d.FilenameEnc.rebase(delta)
+	d.tok.rebase(delta)
+}
+
+func (c *PContentType) rebase(delta int) {
+	c.Val.rebase(delta)
+	c.MType.rebase(delta)
+	c.Type.rebase(delta)
+	c.SubType.rebase(delta)
+	c.Charset.rebase(delta)
+	c.Boundary.rebase(delta)
+	c.tok.rebase(delta)
+}
+
+func (u *PVary) rebase(delta int) {
+	for i := range u.Vals {
+		u.Vals[i].Val.rebase(delta)
+	}
+	u.LastParsed.rebase(delta)
+	u.tmp.Val.rebase(delta)
+	u.first.Val.rebase(delta)
+}
+
+func (p *PPragma) rebase(delta int) {
+	p.LastParsed.rebase(delta)
+	p.hValState.rebase(delta)
+}
+
+func (v *WarningVal) rebase(delta int) {
+	v.V.rebase(delta)
+	v.Agent.rebase(delta)
+	v.Text.rebase(delta)
+	v.Date.rebase(delta)
+}
+
+func (w *PWarning) rebase(delta int) {
+	for i := range w.Vals {
+		w.Vals[i].rebase(delta)
+	}
+	w.LastParsed.rebase(delta)
+	w.tmp.rebase(delta)
+	w.first.rebase(delta)
+}
+
+func (v *LinkVal) rebase(delta int) {
+	v.V.rebase(delta)
+	v.Target.rebase(delta)
+	v.AllPrms.rebase(delta)
+	for i := range v.Params {
+		v.Params[i].rebase(delta)
+	}
+	v.Rel.rebase(delta)
+	v.Type.rebase(delta)
+	v.Title.rebase(delta)
+}
+
+func (l *PLink) rebase(delta int) {
+	for i := range l.Vals {
+		l.Vals[i].rebase(delta)
+	}
+	l.LastParsed.rebase(delta)
+	l.tmp.rebase(delta)
+	l.first.rebase(delta)
+	l.param.rebase(delta)
+}
+
+func (v *AuthVal) rebase(delta int) {
+	v.V.rebase(delta)
+	v.Scheme.rebase(delta)
+	v.Token68.rebase(delta)
+	v.AllPrms.rebase(delta)
+	for i := range v.Params {
+		v.Params[i].rebase(delta)
+	}
+	v.Realm.rebase(delta)
+}
+
+func (a *PAuthChallenges) rebase(delta int) {
+	for i := range a.Vals {
+		a.Vals[i].rebase(delta)
+	}
+	a.LastParsed.rebase(delta)
+	a.tmp.rebase(delta)
+	a.first.rebase(delta)
+	a.hValState.rebase(delta)
+}
+
+func (a *PAuthCredentials) rebase(delta int) {
+	a.AuthVal.rebase(delta)
+	a.hValState.rebase(delta)
+}
+
+func (r *PACReqMethod) rebase(delta int) {
+	r.Val.rebase(delta)
+	r.tok.rebase(delta)
+}
+
+func (l *PHdrNameLst) rebase(delta int) {
+	l.LastParsed.rebase(delta)
+	l.tmp.rebase(delta)
+}
+
+func (o *PACAllowOrigin) rebase(delta int) {
+	o.Val.rebase(delta)
+	o.hValState.rebase(delta)
+}
+
+func (l *PMethodLst) rebase(delta int) {
+	l.LastParsed.rebase(delta)
+	l.tmp.rebase(delta)
+}
+
+func (l *PContentLanguage) rebase(delta int) {
+	for i := range l.Vals {
+		l.Vals[i].rebase(delta)
+	}
+	l.LastParsed.rebase(delta)
+	l.tmp.rebase(delta)
+	l.first.rebase(delta)
+}
+
+func (c *PConnection) rebase(delta int) {
+	c.LastParsed.rebase(delta)
+	c.tmp.rebase(delta)
+}
+
+func (r *PIfRange) rebase(delta int) {
+	r.Val.rebase(delta)
+	r.ETag.rebase(delta)
+	r.hValState.rebase(delta)
+}
+
+func (e *PExpectCT) rebase(delta int) {
+	e.Val.rebase(delta)
+	e.ReportURI.rebase(delta)
+	e.hValState.rebase(delta)
+}
+
+func (s *PSTS) rebase(delta int) {
+	s.Val.rebase(delta)
+	s.hValState.rebase(delta)
+}
+
+// cloneHdrs returns a copy of hdrs (nil for nil).
+func cloneHdrs(hdrs []Hdr) []Hdr {
+	if hdrs == nil {
+		return nil
+	}
+	return append([]Hdr{}, hdrs...)
+}
+
+// cloneParams returns a copy of params (nil for nil).
+func cloneParams(params []PTokParam) []PTokParam {
+	if params == nil {
+		return nil
+	}
+	return append([]PTokParam{}, params...)
+}
+
+// cloneSlices replaces the token parameters slice with a copy.
+func (t *PToken) cloneSlices() {
+	t.ParamLst = cloneParams(t.ParamLst)
+}
+
+// cloneSlices replaces all the parsed values slices (and the nested
+// parameters slices) with copies.
+func (hv *PHdrVals) cloneSlices() {
+	if hv.Upgrade.Vals != nil {
+		hv.Upgrade.Vals = append([]UpgProtoVal{}, hv.Upgrade.Vals...)
+	}
+	for i := range hv.Upgrade.Vals {
+		hv.Upgrade.Vals[i].Val.cloneSlices()
+	}
+	hv.Upgrade.tmp.Val.cloneSlices()
+	hv.Upgrade.first.Val.cloneSlices()
+
+	if hv.TrEnc.Vals != nil {
+		hv.TrEnc.Vals = append([]TrEncVal{}, hv.TrEnc.Vals...)
+	}
+	for i := range hv.TrEnc.Vals {
+		hv.TrEnc.Vals[i].Val.cloneSlices()
+	}
+	hv.TrEnc.First.Val.cloneSlices()
+	hv.TrEnc.Last.Val.cloneSlices()
+	hv.TrEnc.tmp.Val.cloneSlices()
+
+	if hv.WSProto.Vals != nil {
+		hv.WSProto.Vals = append([]WSProtoVal{}, hv.WSProto.Vals...)
+	}
+	for i := range hv.WSProto.Vals {
+		hv.WSProto.Vals[i].Val.cloneSlices()
+	}
+	hv.WSProto.tmp.Val.cloneSlices()
+	hv.WSProto.first.Val.cloneSlices()
+
+	if hv.WSExt.Vals != nil {
+		hv.WSExt.Vals = append([]WSExtVal{}, hv.WSExt.Vals...)
+	}
+	for i := range hv.WSExt.Vals {
+		hv.WSExt.Vals[i].Val.cloneSlices()
+	}
+	hv.WSExt.tmp.Val.cloneSlices()
+	hv.WSExt.first.Val.cloneSlices()
+
+	hv.CDisp.tok.cloneSlices()
+	hv.CType.tok.cloneSlices()
+
+	if hv.Vary.Vals != nil {
+		hv.Vary.Vals = append([]VaryVal{}, hv.Vary.Vals...)
+	}
+	for i := range hv.Vary.Vals {
+		hv.Vary.Vals[i].Val.cloneSlices()
+	}
+	hv.Vary.tmp.Val.cloneSlices()
+	hv.Vary.first.Val.cloneSlices()
+
+	if hv.Warning.Vals != nil {
+		hv.Warning.Vals = append([]WarningVal{}, hv.Warning.Vals...)
+	}
+
+	if hv.Link.Vals != nil {
+		hv.Link.Vals = append([]LinkVal{}, hv.Link.Vals...)
+	}
+	for i := range hv.Link.Vals {
+		hv.Link.Vals[i].Params = cloneParams(hv.Link.Vals[i].Params)
+	}
+	hv.Link.tmp.Params = cloneParams(hv.Link.tmp.Params)
+	hv.Link.first.Params = cloneParams(hv.Link.first.Params)
+
+	if hv.ProxyAuthn.Vals != nil {
+		hv.ProxyAuthn.Vals = append([]AuthVal{}, hv.ProxyAuthn.Vals...)
+	}
+	for i := range hv.ProxyAuthn.Vals {
+		hv.ProxyAuthn.Vals[i].Params =
+			cloneParams(hv.ProxyAuthn.Vals[i].Params)
+	}
+	hv.ProxyAuthn.tmp.Params = cloneParams(hv.ProxyAuthn.tmp.Params)
+	hv.ProxyAuthn.first.Params = cloneParams(hv.ProxyAuthn.first.Params)
+	hv.ProxyAuthz.Params = cloneParams(hv.ProxyAuthz.Params)
+
+	hv.ACReqMethod.tok.cloneSlices()
+	hv.ACReqHdrs.tmp.cloneSlices()
+	hv.ACAllowMethods.tmp.cloneSlices()
+	hv.ACAllowHdrs.tmp.cloneSlices()
+
+	if hv.CLang.Vals != nil {
+		hv.CLang.Vals = append([]PField{}, hv.CLang.Vals...)
+	}
+	hv.CLang.tmp.cloneSlices()
+
+	hv.Conn.tmp.cloneSlices()
+}
@@ -0,0 +1,219 @@
+// Copyright 2022 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+import (
+	"reflect"
+	"testing"
+)
+
+// message using most of the headers with specific parsers
+const rebaseTestMsg = "POST /upload?x=1 HTTP/1.1\r\n" +
+	"Host: www.example.com\r\n" +
+	"Upgrade: websocket, h2c\r\n" +
+	"Connection: Upgrade, keep-alive\r\n" +
+	"Sec-WebSocket-Protocol: chat, superchat\r\n" +
+	"Sec-WebSocket-Extensions: permessage-deflate; client_max_window_bits\r\n" +
+	"Content-Type: multipart/form-data; boundary=\"abc\"; charset=utf-8\r\n" +
+	"Content-Disposition: form-data; name=\"f\"; filename=\"a.txt\"\r\n" +
+	"Vary: Accept, User-Agent\r\n" +
+	"Pragma: no-cache\r\n" +
+	"Warning: 110 anderson/1.3.37 \"Response is stale\"\r\n" +
+	"Link: </a.css>; rel=preload; as=style, <b.js>; rel=next\r\n" +
+	"Proxy-Authorization: Basic dXNlcjpwYXNz\r\n" +
+	"Content-Language: en-US, de\r\n" +
+	"If-Range: \"xyz\"\r\n" +
+	"Transfer-Encoding: gzip, chunked\r\n" +
+	"\r\n" +
+	"3;ext=1\r\nabc\r\n0\r\nFoo: bar\r\n\r\n"
+
+// rebaseTestInit initializes msg using the given arrays.
+func rebaseTestInit(msg *PMsg, hdrs []Hdr) {
+	msg.Init(nil, hdrs)
+	msg.PV.Upgrade.Init(make([]UpgProtoVal, 4))
+	msg.PV.TrEnc.Init(make([]TrEncVal, 4))
+	msg.PV.WSProto.Init(make([]WSProtoVal, 4))
+	msg.PV.WSExt.Init(make([]WSExtVal, 4))
+	msg.PV.Vary.Init(make([]VaryVal, 4))
+	msg.PV.Warning.Init(make([]WarningVal, 4))
+	msg.PV.Link.Init(make([]LinkVal, 4))
+	msg.PV.CLang.Init(make([]PField, 4))
+	msg.LastChunk.TrailerHdrs.Hdrs = make([]Hdr, 4)
+}
+
+func TestPMsgClone(t *testing.T) {
+	const prefix = "GET /prev HTTP/1.1\r\nHost: foo\r\n\r\n"
+	for _, hdrs := range [][]Hdr{nil, make([]Hdr, 20)} {
+		var msg, emsg PMsg
+		// expected result: the message parsed at offset 0
+		var ehdrs []Hdr
+		if hdrs != nil {
+			ehdrs = make([]Hdr, len(hdrs))
+		}
+		rebaseTestInit(&emsg, ehdrs)
+		if _, err := ParseMsg([]byte(rebaseTestMsg), 0, &emsg, 0); err != 0 {
+			t.Fatalf("ParseMsg(%q) failed: %d(%q)", rebaseTestMsg, err, err)
+		}
+		// the message parsed after a previous message in the same buffer
+		buf := []byte(prefix + rebaseTestMsg)
+		rebaseTestInit(&msg, hdrs)
+		o, err := ParseMsg(buf, len(prefix), &msg, 0)
+		if err != 0 || o != len(buf) {
+			t.Fatalf("ParseMsg(%q, %d) = [%d, %d(%q)]", buf, len(prefix),
+				o, err, err)
+		}
+		c := msg.Clone()
+		// clobber the original buffer and re-use msg and its arrays
+		for i := range buf {
+			buf[i] = 'X'
+		}
+		msg.ResetState()
+		if _, err := ParseMsg([]byte(prefix), 0, &msg, 0); err != 0 {
+			t.Fatalf("ParseMsg(%q) failed: %d(%q)", prefix, err, err)
+		}
+		if !reflect.DeepEqual(c, &emsg) {
+			t.Errorf("Clone(): %+v\nexpected %+v", c, &emsg)
+		}
+		if string(c.RawMsg) != rebaseTestMsg || !c.FramingEqual(&emsg) ||
+			string(c.PV.CType.Boundary.Get(c.Buf)) != "abc" ||
+			string(c.PV.Link.Vals[1].Target.Get(c.Buf)) != "b.js" ||
+			c.LastChunk.TrailerHdrs.N != 1 {
+			t.Errorf("Clone(): raw %q, boundary %q, link %q, trailers %d",
+				c.RawMsg, c.PV.CType.Boundary.Get(c.Buf),
+				c.PV.Link.Vals[1].Target.Get(c.Buf),
+				c.LastChunk.TrailerHdrs.N)
+		}
+	}
+}
+
+func TestPMsgRebaseTo(t *testing.T) {
+	const prefix = "GET /prev HTTP/1.1\r\nHost: foo\r\n\r\n"
+	// stop parsing at different points, drop the prefix and continue
+	for _, stop := range []int{0, 10, 100, 400, 560, len(rebaseTestMsg)} {
+		var msg, emsg PMsg
+		// expected result: same parsing steps, without the prefix
+		rebaseTestInit(&emsg, nil)
+		ebuf := []byte(rebaseTestMsg)
+		eo, err := ParseMsg(ebuf[:stop], 0, &emsg, 0)
+		if err == ErrHdrMoreBytes {
+			eo, err = ParseMsg(ebuf, eo, &emsg, 0)
+		}
+		if err != 0 {
+			t.Fatalf("ParseMsg(%q, %d) failed: %d(%q)", ebuf, eo, err, err)
+		}
+		rebaseTestInit(&msg, nil)
+		buf := []byte(prefix + rebaseTestMsg)
+		end := len(prefix) + stop
+		o, err := ParseMsg(buf[:end], len(prefix), &msg, 0)
+		if stop < len(rebaseTestMsg) && err != ErrHdrMoreBytes ||
+			stop == len(rebaseTestMsg) && err != 0 {
+			t.Fatalf("ParseMsg(%q, %d) = [%d, %d(%q)]", buf[:end],
+				len(prefix), o, err, err)
+		}
+		if msg.state != MsgInit && msg.RebaseTo(buf, len(prefix)+1) {
+			t.Errorf("RebaseTo(.., %d) succeeded for a message starting"+
+				" at %d", len(prefix)+1, len(prefix))
+		}
+		nbuf := []byte(rebaseTestMsg)
+		if !msg.RebaseTo(nbuf, len(prefix)) {
+			t.Fatalf("RebaseTo(.., %d) failed, stop %d", len(prefix), stop)
+		}
+		o -= len(prefix)
+		if err == ErrHdrMoreBytes {
+			if o, err = ParseMsg(nbuf, o, &msg, 0); err != 0 {
+				t.Fatalf("ParseMsg(%q, %d) after RebaseTo() ="+
+					" [%d, %d(%q)], stop %d", nbuf, o, o, err, err, stop)
+			}
+		}
+		if o != len(nbuf) || !reflect.DeepEqual(&msg, &emsg) {
+			t.Errorf("RebaseTo() stop %d: offset %d, %+v\nexpected %+v",
+				stop, o, &msg, &emsg)
+		}
+	}
+}
+
+func TestPMsgShiftBuffer(t *testing.T) {
+	msgs := [...]string{
+		"GET /a HTTP/1.1\r\nHost: foo\r\n\r\n",
+		rebaseTestMsg,
+		"PUT /c HTTP/1.1\r\nHost: foo\r\nContent-Length: 3\r\n" +
+			"Content-Type: text/plain; charset=utf-8\r\n\r\nabc",
+		rebaseTestMsg,
+		"GET /d HTTP/1.1\r\nHost: foo\r\n\r\n",
+	}
+	var stream []byte
+	for _, m := range msgs {
+		stream = append(stream, m...)
+	}
+	// buffer big enough for 1 message + 1 read
+	const readSz = 37
+	buf := make([]byte, len(rebaseTestMsg)+readSz)
+	var msg PMsg
+	rebaseTestInit(&msg, nil)
+	start, end, o, in := 0, 0, 0, 0 // msg start, data end, offset, stream
+	parsed := 0
+	shifts := 0
+	for parsed < len(msgs) {
+		if end+readSz > len(buf) {
+			// compact: drop everything before the current message
+			if start == 0 {
+				t.Fatalf("buffer full for message %d", parsed)
+			}
+			n := copy(buf, buf[start:end])
+			if !msg.ShiftBuffer(start) {
+				t.Fatalf("ShiftBuffer(%d) failed for message %d, state %d",
+					start, parsed, msg.state)
+			}
+			o -= start
+			start = 0
+			end = n
+			shifts++
+		}
+		// read
+		n := copy(buf[end:end+readSz], stream[in:])
+		end += n
+		in += n
+		var err ErrorHdr
+		for o < end {
+			o, err = ParseMsg(buf[:end], o, &msg, 0)
+			if err == ErrHdrMoreBytes {
+				break
+			}
+			if err != 0 {
+				t.Fatalf("ParseMsg() for message %d: %d(%q)", parsed, err, err)
+			}
+			// fully parsed
+			var emsg PMsg
+			rebaseTestInit(&emsg, nil)
+			ebuf := []byte(msgs[parsed])
+			if _, err = ParseMsg(ebuf, 0, &emsg, 0); err != 0 {
+				t.Fatalf("ParseMsg(%q) failed: %d(%q)", ebuf, err, err)
+			}
+			if string(msg.RawMsg) != msgs[parsed] || !msg.FramingEqual(&emsg) ||
+				string(msg.PV.CType.Charset.Get(msg.Buf)) !=
+					string(emsg.PV.CType.Charset.Get(ebuf)) {
+				t.Errorf("message %d: %q, expected %q", parsed, msg.RawMsg,
+					msgs[parsed])
+			}
+			parsed++
+			start = o
+			msg.ResetState()
+		}
+	}
+	if shifts == 0 {
+		t.Errorf("buffer never compacted")
+	}
+	// dropping bytes from the current message is not allowed
+	msg.ResetState()
+	copy(buf, msgs[1])
+	if _, err := ParseMsg(buf[:100], 0, &msg, 0); err != ErrHdrMoreBytes {
+		t.Fatalf("ParseMsg(%q) = %d(%q)", buf[:100], err, err)
+	}
+	if msg.ShiftBuffer(1) {
+		t.Errorf("ShiftBuffer(1) succeeded for a message starting at 0")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2022 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+// PMsgStats contains parsing statistics for one message (see
+// PMsg.Stats()) or, accumulated with Add(), for several messages.
+type PMsgStats struct {
+	Msgs      int // number of messages (1 for a single message)
+	Bytes     int // bytes consumed (from the message start)
+	Hdrs      int // number of headers (including the dropped ones)
+	BodyBytes int // body bytes consumed (including the chunked framing)
+	Chunks    int // number of chunks (without the last zero-length one)
+	Resumes   int // number of ErrHdrMoreBytes returned while parsing
+	Chunked   int // number of messages with a chunked body
+	EOFBody   int // number of messages with a body ending at conn. close
+	Tunnels   int // number of established tunnels (2xx to CONNECT)
+}
+
+// Add accumulates the statistics in o into s (e.g. for collecting the
+// statistics of all the messages received on a connection).
+func (s *PMsgStats) Add(o *PMsgStats) {
+	s.Msgs += o.Msgs
+	s.Bytes += o.Bytes
+	s.Hdrs += o.Hdrs
+	s.BodyBytes += o.BodyBytes
+	s.Chunks += o.Chunks
+	s.Resumes += o.Resumes
+	s.Chunked += o.Chunked
+	s.EOFBody += o.EOFBody
+	s.Tunnels += o.Tunnels
+}
+
+// Stats returns the parsing statistics for the message, up to the last
+// ParseMsg() call (the message does not need to be fully parsed).
+// Bytes, BodyBytes and Resumes are updated only by ParseMsg() (and not
+// by the other parsing functions, e.g. SkipBody() called directly).
+// Note that Reset() and ResetState() clear the statistics.
+func (m *PMsg) Stats() PMsgStats {
+	var s PMsgStats
+	if m.state == MsgInit {
+		return s
+	}
+	s.Msgs = 1
+	if m.lastOffs > m.offs {
+		s.Bytes = m.lastOffs - m.offs
+	}
+	s.Hdrs = m.HL.N
+	if m.ParsedHdrs() && m.lastOffs > m.bodyOffs {
+		s.BodyBytes = m.lastOffs - m.bodyOffs
+	}
+	s.Chunks = m.cnkNo
+	s.Resumes = m.resumes
+	switch m.bodyType {
+	case MsgBodyChunked:
+		s.Chunked = 1
+	case MsgBodyEOF:
+		s.EOFBody = 1
+	}
+	if m.ParsedHdrs() && m.IsTunnelEstablished(m.PrevMethod) {
+		s.Tunnels = 1
+	}
+	return s
+}
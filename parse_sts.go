@@ -0,0 +1,90 @@
+// Copyright 2021 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+import (
+	"github.com/intuitivelabs/bytescase"
+)
+
+// PSTS contains a parsed Strict-Transport-Security header value
+// (rfc6797 6.1):
+//
+//	Strict-Transport-Security = [ directive ] *( ";" [ directive ] )
+//	directive = directive-name [ "=" directive-value ]
+//
+// The known directives are max-age (required), includeSubDomains and
+// preload. Unknown directives are ignored.
+type PSTS struct {
+	Val               PField // trimmed value
+	MaxAge            int64  // max-age value in seconds
+	IncludeSubDomains bool   // includeSubDomains directive present
+	Preload           bool   // preload directive present
+	hValState
+}
+
+// Reset re-initializes the parsed value and internal parsing state.
+func (s *PSTS) Reset() {
+	*s = PSTS{}
+}
+
+// Empty returns true if nothing was parsed yet.
+func (s *PSTS) Empty() bool {
+	return s.state == hvInit && s.Val.Empty()
+}
+
+// Parsed returns true if the value is fully parsed.
+func (s *PSTS) Parsed() bool {
+	return !s.Val.Empty()
+}
+
+// ParseSTSVal parses a Strict-Transport-Security header value, starting
+// at offs in buf and filling s.
+// It returns a new offset pointing after the part that was parsed and
+// an error.
+// A missing or invalid max-age directive is rejected with
+// ErrHdrValNotNumber (or ErrHdrNumTooBig for a too big value).
+// It can return ErrHdrMoreBytes if more data is needed (the value is not
+// fully contained in buf). In this case it should be called again
+// with the same s and the returned offset, after more bytes were added.
+func ParseSTSVal(buf []byte, offs int, s *PSTS) (int, ErrorHdr) {
+	next, end, err := findHdrValEnd(buf, offs, &s.hValState)
+	if err != 0 {
+		return next, err
+	}
+	var f PField
+	var derr ErrorHdr
+	maxAge := false
+	f.Set(s.vstart, end)
+	err = ParseDirectiveList(buf, f, ';', func(name, val PField) bool {
+		n := name.Get(buf)
+		switch {
+		case len(n) == 7 && bytescase.CmpEq(n, []byte("max-age")):
+			v, _ := unquotePField(buf, val)
+			if s.MaxAge, derr = parseDeltaSeconds(v.Get(buf)); derr != 0 {
+				next = int(val.Offs)
+				return false
+			}
+			maxAge = true
+		case len(n) == 17 && bytescase.CmpEq(n, []byte("includesubdomains")):
+			s.IncludeSubDomains = true
+		case len(n) == 7 && bytescase.CmpEq(n, []byte("preload")):
+			s.Preload = true
+		}
+		return true
+	})
+	if err != 0 {
+		return s.vstart, err
+	}
+	if derr != 0 {
+		return next, derr
+	}
+	if !maxAge {
+		return s.vstart, ErrHdrValNotNumber
+	}
+	s.Val = f
+	return next, 0
+}
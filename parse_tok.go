@@ -66,8 +66,8 @@ func (pt *PToken) Name() PField {
 // E.g.: for HTTP/1.1 it would return only "1.1" and for sip  "".
 func (pt *PToken) Suffix() PField {
 	if pt.SepOffs != 0 {
-		s := pt.V
-		s.Offs = pt.SepOffs + 1
+		var s PField
+		s.Set(int(pt.SepOffs)+1, pt.V.EndOffs())
 		return s
 	}
 	return PField{0, 0}
@@ -171,6 +171,31 @@ func tokAllowedChar(c byte) bool {
 	return true
 }
 
+// returns true if c is a valid rfc7230 "tchar" (the only characters allowed
+// in a method name or in a header name):
+//  tchar = "!" / "#" / "$" / "%" / "&" / "'" / "*" / "+" / "-" / "." /
+//          "^" / "_" / "`" / "|" / "~" / DIGIT / ALPHA
+func tcharAllowed(c byte) bool {
+	switch c {
+	case '!', '#', '$', '%', '&', '\'', '*', '+', '-', '.', '^', '_', '`',
+		'|', '~':
+		return true
+	}
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') ||
+		(c >= 'A' && c <= 'Z')
+}
+
+// badTCharOffs returns the offset in buf of the first character inside
+// the field f that is not a valid "tchar" or -1 if all are valid.
+func badTCharOffs(buf []byte, f PField) int {
+	for i := int(f.Offs); i < f.EndOffs(); i++ {
+		if !tcharAllowed(buf[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
 // ParseTokenLst iterates through a comma or space separated token list,
 // returning each token in turn. The "flags" parameter controls whether
 // it is supposed to parse a comma separated token list (PTokCommaSepF),
@@ -980,3 +1005,92 @@ endOfHdr: // end of header found
 	}
 	return n + crl, ErrHdrEOH
 }
+
+// ParseHdrTokenList parses the value of an already parsed header h (e.g. a
+// header not specially recognized, with Type == HdrOther) as a token list,
+// calling fn for each token, in order. If fn returns false, the parsing
+// stops.
+// The flags are ParseTokenLst() flags (e.g. PTokCommaSepF,
+// PTokAllowParamsF). PTokInputEndF is always added, the list ends at the
+// header value end.
+// It returns 0 on success (including when stopped by fn), ErrHdrEmpty if
+// the header value is empty, or a parsing error.
+func ParseHdrTokenList(buf []byte, h *Hdr, flags uint,
+	fn func(tok PToken) bool) ErrorHdr {
+	if h.Val.Empty() {
+		return ErrHdrEmpty
+	}
+	vbuf := buf[:h.Val.EndOffs()]
+	o := int(h.Val.Offs)
+	var tok PToken
+	for {
+		tok.Reset()
+		n, err := ParseTokenLst(vbuf, o, &tok, flags|PTokInputEndF)
+		switch err {
+		case 0, ErrHdrMoreValues:
+			if !fn(tok) || err == 0 {
+				return 0
+			}
+			o = n
+		default:
+			return err
+		}
+	}
+}
+
+// ParseDirectiveList parses the value f (inside buf) as a list of
+// directives separated by sep (',' or ';'), of the form:
+//
+//	directive = name [ "=" value ]
+//
+// where value is a token or a quoted string (e.g. Cache-Control,
+// Strict-Transport-Security or Expect-CT values).
+// fn is called for each directive, in order, with the directive name and
+// value (the value still contains the quotes if quoted and it is empty
+// if missing). If fn returns false, the parsing stops.
+// Empty list elements are ignored.
+// It returns 0 on success (including when stopped by fn), ErrHdrBadChar
+// if a different separator is used or some other parsing error.
+func ParseDirectiveList(buf []byte, f PField, sep byte,
+	fn func(name, val PField) bool) ErrorHdr {
+	flags := PTokInputEndF
+	switch sep {
+	case ',':
+		flags |= PTokCommaSepF
+	case ';':
+	default:
+		return ErrHdrBug // unsupported separator
+	}
+	end := f.EndOffs()
+	pbuf := buf[:end]
+	var p PTokParam
+	o := int(f.Offs)
+	for {
+		// skip over empty list elements
+		for o < end && (pbuf[o] == sep || pbuf[o] == ' ' ||
+			pbuf[o] == '\t' || pbuf[o] == '\r' || pbuf[o] == '\n') {
+			o++
+		}
+		if o >= end {
+			return 0
+		}
+		p.Reset()
+		n, err := ParseTokenParam(pbuf, o, &p, flags)
+		switch err {
+		case ErrHdrOk, ErrHdrEOH:
+		case ErrHdrMoreValues:
+			if sep != ';' {
+				return ErrHdrBadChar // ';' used as separator
+			}
+		default:
+			return err
+		}
+		if !fn(p.Name, p.Val) {
+			return 0
+		}
+		if n <= o {
+			return ErrHdrBug
+		}
+		o = n
+	}
+}
@@ -7,6 +7,7 @@
 package httpsp
 
 import (
+	"strings"
 	"testing"
 
 	"bytes"
@@ -480,3 +481,119 @@ func TestTokParamN(t *testing.T) {
 		}
 	}
 }
+
+func TestParseHdrTokenList(t *testing.T) {
+	tests := [...]struct {
+		v     string
+		flags uint
+		err   ErrorHdr
+		toks  []string
+	}{
+		{"no", PTokCommaSepF, 0, []string{"no"}},
+		{"a, b,c", PTokCommaSepF, 0, []string{"a", "b", "c"}},
+		{"a ,  b,\r\n c", PTokCommaSepF, 0, []string{"a", "b", "c"}},
+		{"a b  c", PTokSpSepF, 0, []string{"a", "b", "c"}},
+		{"a;q=1, b", PTokCommaSepF | PTokAllowParamsF, 0,
+			[]string{"a", "b"}},
+		{"a b", PTokCommaSepF, ErrHdrBadChar, []string{}},
+	}
+	for _, c := range tests {
+		var h Hdr
+		buf := []byte("X-Foo: " + c.v + "\r\n\r\n")
+		if o, err := ParseHdrLine(buf, 0, &h, nil); err != 0 {
+			t.Fatalf("ParseHdrLine(%q, ..) = [%d, %d(%q)]", buf, o, err, err)
+		}
+		var toks []string
+		err := ParseHdrTokenList(buf, &h, c.flags, func(tok PToken) bool {
+			toks = append(toks, string(tok.V.Get(buf)))
+			return true
+		})
+		if err != c.err {
+			t.Errorf("ParseHdrTokenList(%q, .., 0x%x) = %d(%q),"+
+				" expected %q", buf, c.flags, err, err, c.err)
+			continue
+		}
+		if err != 0 {
+			continue
+		}
+		if strings.Join(toks, "|") != strings.Join(c.toks, "|") {
+			t.Errorf("ParseHdrTokenList(%q, .., 0x%x): tokens %q,"+
+				" expected %q", buf, c.flags, toks, c.toks)
+		}
+	}
+	// stop after the first token
+	var h Hdr
+	buf := []byte("X-Accel-Buffering: yes, no\r\n\r\n")
+	ParseHdrLine(buf, 0, &h, nil)
+	n := 0
+	err := ParseHdrTokenList(buf, &h, PTokCommaSepF, func(tok PToken) bool {
+		n++
+		return false
+	})
+	if err != 0 || n != 1 {
+		t.Errorf("ParseHdrTokenList(%q, ..) stop = %d(%q), %d calls",
+			buf, err, err, n)
+	}
+	// empty value
+	h.Reset()
+	if err := ParseHdrTokenList(buf, &h, PTokCommaSepF,
+		func(PToken) bool { return true }); err != ErrHdrEmpty {
+		t.Errorf("ParseHdrTokenList(empty) = %d(%q)", err, err)
+	}
+}
+
+func TestParseDirectiveList(t *testing.T) {
+	tests := [...]struct {
+		v    string
+		sep  byte
+		err  ErrorHdr
+		dirs []string // name=val
+	}{
+		{"no-cache", ',', 0, []string{"no-cache="}},
+		{"max-age=5, private, x=\"a,b\"", ',', 0,
+			[]string{"max-age=5", "private=", "x=\"a,b\""}},
+		{", a ,,\r\n b = 1,", ',', 0, []string{"a=", "b=1"}},
+		{"max-age=5; includeSubDomains;; x=\"a;b\"", ';', 0,
+			[]string{"max-age=5", "includeSubDomains=", "x=\"a;b\""}},
+		{"a=1; b", ',', ErrHdrBadChar, nil},
+		{"a=1, b", ';', ErrHdrBadChar, nil},
+		{"a", ' ', ErrHdrBug, nil},
+	}
+	for _, c := range tests {
+		var h Hdr
+		buf := []byte("X-Foo: " + c.v + "\r\n\r\n")
+		if o, err := ParseHdrLine(buf, 0, &h, nil); err != 0 {
+			t.Fatalf("ParseHdrLine(%q, ..) = [%d, %d(%q)]", buf, o, err, err)
+		}
+		var dirs []string
+		err := ParseDirectiveList(buf, h.Val, c.sep, func(n, v PField) bool {
+			dirs = append(dirs, string(n.Get(buf))+"="+string(v.Get(buf)))
+			return true
+		})
+		if err != c.err {
+			t.Errorf("ParseDirectiveList(%q, .., %q) = %d(%q), expected %q",
+				buf, c.sep, err, err, c.err)
+			continue
+		}
+		if err != 0 {
+			continue
+		}
+		if strings.Join(dirs, "|") != strings.Join(c.dirs, "|") {
+			t.Errorf("ParseDirectiveList(%q, .., %q): directives %q,"+
+				" expected %q", buf, c.sep, dirs, c.dirs)
+		}
+	}
+	// stop after the first directive
+	buf := []byte("a, b=\"")
+	var f PField
+	f.Set(0, len(buf))
+	n := 0
+	err := ParseDirectiveList(buf, f, ',', func(_, _ PField) bool {
+		n++
+		return false
+	})
+	if err != 0 || n != 1 {
+		t.Errorf("ParseDirectiveList(%q, ..) stop = %d(%q), %d calls",
+			buf, err, err, n)
+	}
+}
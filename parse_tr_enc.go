@@ -119,6 +119,40 @@ func (u *PTrEnc) GetExt(n int) *TrEncVal {
 	return nil
 }
 
+// Codings returns the parsed transfer codings, in the order in which they
+// were applied (the order in the message).
+// Only the values that fit in Vals are returned (see VNo() and More()).
+// buf is used to resolve values without a numeric encoding.
+func (u *PTrEnc) Codings(buf []byte) []TrEncT {
+	n := u.VNo()
+	if n == 0 {
+		return nil
+	}
+	c := make([]TrEncT, n)
+	for i := 0; i < n; i++ {
+		c[i] = u.Vals[i].Enc
+		if c[i] == TrEncNone {
+			c[i] = TrEncResolve(u.Vals[i].Val.V.Get(buf))
+		}
+	}
+	return c
+}
+
+// FinalCoding returns the last applied transfer coding (the one that
+// determines the message body length, e.g. TrEncChunkedF) or TrEncNone
+// if no Transfer-Encoding values were parsed.
+func (u *PTrEnc) FinalCoding() TrEncT {
+	return u.Last.Enc
+}
+
+// ChunkedIsFinal returns true if chunked is the final transfer coding,
+// meaning that the message body is delimited by the chunked encoding
+// (rfc7230 3.3.3). It returns false if no Transfer-Encoding values were
+// parsed.
+func (u *PTrEnc) ChunkedIsFinal() bool {
+	return u.Encodings&TrEncChunkedF != 0 && u.Last.Enc == TrEncChunkedF
+}
+
 // More returns true if there are more values that did not fit in Vals.
 func (u *PTrEnc) More() bool {
 	return u.N > len(u.Vals)
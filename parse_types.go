@@ -7,9 +7,20 @@
 //Package httpsp implements HTTP message statefull parsing.
 package httpsp
 
+import (
+	"unicode/utf8"
+)
+
 //OffsT is the type used for offset and length used internally in PField.
 type OffsT uint16 // uint16 since max buf & msg size <= 65k
 
+// MaxBufSize is the maximum supported input buffer size (all the offsets
+// inside it must fit in OffsT).
+// The main parsing functions (ParseMsg(), ParseFLine(), ParseHeaders(),
+// ParseHdrLine(), SkipBody() and ParseChunk()) return ErrHdrTooBig for
+// bigger buffers.
+const MaxBufSize = int(^OffsT(0))
+
 // PField is the type for parsed fields (like host, to body a.s.o.).
 // it holds and offset an a length inside a buffer.
 type PField struct {
@@ -67,6 +78,24 @@ func (p PField) Get(buf []byte) []byte {
 	return GetPField(buf, p)
 }
 
+// SafeGet is a version of Get() that checks if the PField fits inside buf.
+// It returns the corresponding byte slice and true on success, or nil and
+// false if the PField points outside buf (e.g. a stale PField used with
+// a truncated or re-allocated buffer), instead of panicking.
+func (p PField) SafeGet(buf []byte) ([]byte, bool) {
+	if p.EndOffs() > len(buf) {
+		return nil, false
+	}
+	return buf[p.Offs:p.EndOffs()], true
+}
+
+// IsValidUTF8 returns true if the field content (inside buf) is valid
+// UTF-8. Note that HTTP itself allows any non-ASCII bytes in header values
+// (obs-text), this is an application level check.
+func (p PField) IsValidUTF8(buf []byte) bool {
+	return utf8.Valid(p.Get(buf))
+}
+
 // GetPField returns a byte slice for the corresponding field f, pointing
 // inside buf.
 func GetPField(buf []byte, f PField) []byte {
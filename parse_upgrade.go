@@ -25,6 +25,11 @@ const (
 
 // UpgProtoGet will try to resolve the protocol name to a numeriv UpgProtoT
 // flag.
+// The protocol can include a version suffix (protocol-name "/"
+// protocol-version): the version is taken into account only for
+// "HTTP/2.0" (UProtoHTTP2F), other versioned protocols (e.g. "HTTP/1.1"
+// or "RTA/x11") resolve to UProtoOtherF (see UpgProtoVal.Name() and
+// UpgProtoVal.Version() for getting the name and the version).
 func UpgProtoResolve(n []byte) UpgProtoT {
 	if len(n) == 9 && bytescase.CmpEq(n, []byte("websocket")) {
 		return UProtoWSockF
@@ -48,6 +53,21 @@ func (v *UpgProtoVal) Reset() {
 	v.Proto = UProtoNone
 }
 
+// Name returns the protocol name, without the version suffix
+// (e.g. "HTTP" for "HTTP/2.0" or "RTA" for "RTA/x11").
+// buf is the buffer the header was parsed from.
+func (v *UpgProtoVal) Name(buf []byte) []byte {
+	return v.Val.Name().Get(buf)
+}
+
+// Version returns the protocol version suffix (the part after '/', e.g.
+// "2.0" for "HTTP/2.0" or "x11" for "RTA/x11") or an empty slice if the
+// protocol has no version.
+// buf is the buffer the header was parsed from.
+func (v *UpgProtoVal) Version(buf []byte) []byte {
+	return v.Val.Suffix().Get(buf)
+}
+
 // PUpgrade contains the parsed Upgrade header values for one or more
 // different Upgrade headers (all the upgrade protocols in the message that
 // fit in the parsed value array).
@@ -83,6 +103,19 @@ func (u *PUpgrade) GetProto(n int) *UpgProtoVal {
 	return nil
 }
 
+// Offers returns true if the protocol p is in the list of upgrade
+// protocols (e.g. offered by the client in a request).
+func (u *PUpgrade) Offers(p UpgProtoT) bool {
+	return u.Protos&p != 0
+}
+
+// Only returns true if exactly one upgrade protocol value was parsed and
+// it is p (e.g. for checking that a 101 reply switches to exactly the
+// requested protocol).
+func (u *PUpgrade) Only(p UpgProtoT) bool {
+	return u.N == 1 && u.GetProto(0).Proto == p
+}
+
 // More returns true if there are more values that did not fit in Vals.
 func (u *PUpgrade) More() bool {
 	return u.N > len(u.Vals)
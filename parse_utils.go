@@ -107,6 +107,36 @@ func skipCRLF(buf []byte, offs int) (int, int, ErrorHdr) {
 	return i, 0, ErrHdrNoCR
 }
 
+// SkipLWS jumps over linear white space (SP, HTAB and folded line
+// continuations: CRLF followed by SP or HTAB), using the same rules as the
+// header parsing functions.
+// It returns:
+//  - an offset pointing after the white space, 0 and ErrHdrOk if a non
+//    white space character was found.
+//  - the CR (or LF) offset, the line end length (CRLF, CR or LF) and
+//    ErrHdrEOH if the end of the header (line end not followed by white
+//    space) was found.
+//  - a "continuation" offset, 0 and ErrHdrMoreBytes if the buffer was
+//    exhausted or is not big enough to check for CRLF SP. The function
+//    should be called again with this offset when more bytes are
+//    available.
+// If the PTokInputEndF flag is set, the end of the buffer is considered
+// the end of the header: ErrHdrEOH, len(buf) and 0 are returned instead
+// of ErrHdrMoreBytes for a line end at the end of buf.
+func SkipLWS(buf []byte, offs int, flags uint) (int, int, ErrorHdr) {
+	return skipLWS(buf, offs, flags)
+}
+
+// SkipCRLF skips over the line end (CRLF, single CR or single LF) at
+// buf[offs].
+// It returns the offset immediately after the line end, its length (2 or
+// 1) and ErrHdrOk on success. ErrHdrMoreBytes is returned if there are
+// not enough bytes to decide between CR and CRLF and ErrHdrNoCR if
+// there is no CR or LF at buf[offs].
+func SkipCRLF(buf []byte, offs int) (int, int, ErrorHdr) {
+	return skipCRLF(buf, offs)
+}
+
 // skipWS jumps over white space.
 // It stops at the first non-whitespace (' ' , '\t') , CR or LF or at the
 // end of the string.
@@ -163,3 +193,129 @@ func skipLine(buf []byte, offs int) (int, int, ErrorHdr) {
 	}
 	return skipCRLF(buf, offs)
 }
+
+// hValState contains the internal state for findHdrValEnd.
+type hValState struct {
+	state    uint8 // internal state
+	inQuotes bool  // inside a quoted string
+	vstart   int   // value start offset
+}
+
+// internal findHdrValEnd states
+const (
+	hvInit uint8 = iota // look for value start
+	hvVal               // look for value end
+)
+
+// findHdrValEnd looks for the end of a complete header value, starting at
+// offs and using the passed state (quoted strings are skipped, so they can
+// contain ',' or other separators).
+// It returns the offset after the end of the header (CRLF included), the
+// trimmed value end and 0 on success. The value start is saved in
+// s.vstart.
+// If the value is empty it returns ErrHdrEmpty.
+// On ErrHdrMoreBytes the returned offset can be used to resume the search
+// (with the same s).
+func findHdrValEnd(buf []byte, offs int, s *hValState) (int, int, ErrorHdr) {
+	var n, crl int
+	var err ErrorHdr
+	i := offs
+	if s.state == hvInit {
+		i, crl, err = skipLWS(buf, i, 0)
+		switch err {
+		case 0:
+			s.state = hvVal
+			s.vstart = i
+			s.inQuotes = false
+		case ErrHdrEOH:
+			return i + crl, 0, ErrHdrEmpty
+		default:
+			return i, 0, err
+		}
+	}
+	for i < len(buf) {
+		if s.inQuotes {
+			i, err = SkipQuoted(buf, i)
+			if err != 0 {
+				if err != ErrHdrMoreBytes {
+					s.state = hvInit
+				}
+				return i, 0, err
+			}
+			s.inQuotes = false
+			continue
+		}
+		switch buf[i] {
+		case '"':
+			s.inQuotes = true
+		case '\r', '\n':
+			n, crl, err = skipLWS(buf, i, 0)
+			if err == 0 {
+				i = n
+				continue
+			}
+			if err == ErrHdrEOH {
+				// trim trailing whitespace
+				e := i
+				for e > s.vstart && (buf[e-1] == ' ' || buf[e-1] == '\t') {
+					e--
+				}
+				s.state = hvInit
+				return n + crl, e, 0
+			}
+			if err != ErrHdrMoreBytes {
+				s.state = hvInit
+			}
+			return i, 0, err
+		}
+		i++
+	}
+	return i, 0, ErrHdrMoreBytes
+}
+
+// skipEmptyLines skips over empty lines (CRLF or LF) starting at offs.
+// It returns the offset of the first non-empty line start and 0, or
+// ErrHdrMoreBytes and the offset of the last incomplete CRLF if the end
+// of buf is reached while inside a CRLF.
+// Note that it stops at the end of buf without reporting ErrHdrMoreBytes
+// if there is no incomplete CRLF.
+func skipEmptyLines(buf []byte, offs int) (int, ErrorHdr) {
+	i := offs
+	for i < len(buf) {
+		switch buf[i] {
+		case '\n':
+			i++
+		case '\r':
+			if (i + 1) >= len(buf) {
+				return i, ErrHdrMoreBytes
+			}
+			if buf[i+1] != '\n' {
+				return i, 0 // not an empty line, let the caller handle it
+			}
+			i += 2
+		default:
+			return i, 0
+		}
+	}
+	return i, 0
+}
+
+// isBase64 returns true if v is the padded base64 encoding (rfc4648 4)
+// of a n bytes value.
+func isBase64(v []byte, n int) bool {
+	if len(v) != (n+2)/3*4 {
+		return false
+	}
+	pad := (3 - n%3) % 3
+	for i, c := range v {
+		if i >= len(v)-pad {
+			if c != '=' {
+				return false
+			}
+		} else if !((c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') ||
+			(c >= '0' && c <= '9') || c == '+' || c == '/') {
+			return false
+		}
+	}
+	return true
+}
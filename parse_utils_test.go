@@ -95,3 +95,71 @@ func TestSkipLWS(t *testing.T) {
 		}
 	}
 }
+
+func TestSkipExported(t *testing.T) {
+	tests := [...]struct {
+		s    string
+		f    uint
+		offs int      // expected offset
+		l    int      // expected CRLF length
+		err  ErrorHdr // expected error
+	}{
+		{"  x", 0, 2, 0, ErrHdrOk},
+		{" \r\n x", 0, 4, 0, ErrHdrOk},
+		{" \r\nx", 0, 1, 2, ErrHdrEOH},
+		{" \nx", 0, 1, 1, ErrHdrEOH},
+		{" \r\n", 0, 1, 0, ErrHdrMoreBytes},
+		{" \r\n", PTokInputEndF, 3, 0, ErrHdrEOH},
+		{" \r", 0, 1, 0, ErrHdrMoreBytes},
+	}
+	for _, c := range tests {
+		buf := []byte(c.s)
+		o, l, err := SkipLWS(buf, 0, c.f)
+		if o != c.offs || l != c.l || err != c.err {
+			t.Errorf("SkipLWS(%q, 0, %d) = [%d, %d, %d(%q)],"+
+				" expected [%d, %d, %d(%q)]", buf, c.f, o, l, err, err,
+				c.offs, c.l, c.err, c.err)
+		}
+		if err == ErrHdrEOH && l > 0 {
+			// SkipCRLF should skip exactly the same line end
+			if n, crl, e := SkipCRLF(buf, o); e != 0 || crl != l ||
+				n != o+l {
+				t.Errorf("SkipCRLF(%q, %d) = [%d, %d, %d(%q)]",
+					buf, o, n, crl, e, e)
+			}
+		}
+	}
+}
+
+func TestPFieldSafeGet(t *testing.T) {
+	buf := []byte("foo bar")
+	tests := [...]struct {
+		offs, l int
+		ok      bool
+	}{
+		{0, 0, true},
+		{0, 3, true},
+		{4, 3, true},
+		{7, 0, true},
+		{4, 4, false},
+		{8, 0, false},
+		{MaxBufSize, MaxBufSize, false},
+	}
+	for _, c := range tests {
+		f := PField{Offs: OffsT(c.offs), Len: OffsT(c.l)}
+		v, ok := f.SafeGet(buf)
+		if ok != c.ok {
+			t.Errorf("SafeGet(%q) for [%d:%d] = %q, %v, expected %v",
+				buf, c.offs, c.l, v, ok, c.ok)
+			continue
+		}
+		if ok && string(v) != string(f.Get(buf)) {
+			t.Errorf("SafeGet(%q) for [%d:%d] = %q, expected %q",
+				buf, c.offs, c.l, v, f.Get(buf))
+		}
+		if !ok && v != nil {
+			t.Errorf("SafeGet(%q) for [%d:%d] = %q, expected nil",
+				buf, c.offs, c.l, v)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2021 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+// VaryVal contains a parsed "Vary" value (a header name or "*").
+type VaryVal struct {
+	Val  PToken // header name token
+	Type HdrT   // resolved header type (HdrOther if unknown or "*")
+}
+
+// Reset  re-initializes the internal parsed token.
+func (v *VaryVal) Reset() {
+	v.Val.Reset()
+	v.Type = HdrNone
+}
+
+// PVary contains the parsed Vary header values for one or more different
+// headers (all the field names in the message that fit in the parsed
+// value array).
+type PVary struct {
+	Vals []VaryVal // parsed field names
+	N    int       // no of  _values_ found, can be >len(Vals)
+	HNo  int       // no of different Vary _headers_ found
+	// Hdrs contains flags for the known header types found in the list.
+	// HdrOtherF is set if an unknown header name is present.
+	Hdrs HdrFlags
+	All  bool // "*" found
+	// parsed hdr content during the last ParseAll... call
+	// (contains a trimmed value or several values, overwritten by each
+	//  ParseAll.. call; it can also be empty, e.g. on ErrHdrMoreByte)
+	LastParsed PField
+	tmp        VaryVal // temporary saved state (between calls)
+	first      VaryVal // even if Vals is nil, we remember the first val.
+}
+
+// VNo returns the number of parsed Vary values.
+func (u *PVary) VNo() int {
+	if u.N > len(u.Vals) {
+		return len(u.Vals)
+	}
+	return u.N
+}
+
+// GetVal returns the requested parsed Vary value or nil.
+func (u *PVary) GetVal(n int) *VaryVal {
+	if u.VNo() > n {
+		return &u.Vals[n]
+	}
+	if u.Empty() {
+		return nil
+	}
+	if n == 0 {
+		return &u.first
+	}
+	return nil
+}
+
+// More returns true if there are more values that did not fit in Vals.
+func (u *PVary) More() bool {
+	return u.N > len(u.Vals)
+}
+
+// Reset re-initializes the parsed values.
+func (u *PVary) Reset() {
+	for i := 0; i < u.VNo(); i++ {
+		u.Vals[i].Reset()
+	}
+	v := u.Vals
+	*u = PVary{}
+	u.Vals = v
+}
+
+// Init initializes the parsed Vary values buf from an array.
+func (u *PVary) Init(valbuf []VaryVal) {
+	u.Vals = valbuf
+}
+
+// Empty returns true if no Vary values have been parsed.
+func (u *PVary) Empty() bool {
+	return u.N == 0
+}
+
+// Parsed returns true if there are some parsed Vary values.
+func (u *PVary) Parsed() bool {
+	return u.N > 0
+}
+
+// Varies returns true if the header type t is listed in a Vary header
+// or if "*" was present.
+func (u *PVary) Varies(t HdrT) bool {
+	return u.All || u.Hdrs.Test(t)
+}
+
+// VariesAll returns true if the "*" wildcard was present (the response
+// varies on things beyond the request headers).
+func (u *PVary) VariesAll() bool {
+	return u.All
+}
+
+// ParseAllVaryValues tries to parse all the values in a Vary header
+// situated at offs in buf and adds them to the passed PVary values.
+// The return values are: a new offset after the parsed value (that can be
+// used to continue parsing), the number of header values parsed and an error.
+// It can return ErrHdrMoreBytes if more data is needed (the value is not
+// fully contained in buf).
+func ParseAllVaryValues(buf []byte, offs int, u *PVary) (int, int, ErrorHdr) {
+	const flags = PTokCommaSepF // parsing token list flags
+	var next int
+	var err ErrorHdr
+	var pv *VaryVal
+
+	vNo := 0             // number of values parsed during the current call
+	u.LastParsed.Reset() // clear LastParsed on each call
+	for {
+		if u.N < len(u.Vals) {
+			pv = &u.Vals[u.N]
+		} else {
+			pv = &u.tmp
+		}
+		next, err = ParseTokenLst(buf, offs, &pv.Val, flags)
+		switch err {
+		case 0, ErrHdrMoreValues:
+			if vNo == 0 {
+				u.LastParsed = pv.Val.V
+			} else {
+				u.LastParsed.Extend(int(pv.Val.V.Offs + pv.Val.V.Len))
+			}
+			n := pv.Val.V.Get(buf)
+			if len(n) == 1 && n[0] == '*' {
+				pv.Type = HdrOther
+				u.All = true
+			} else {
+				pv.Type = GetHdrType(n)
+				u.Hdrs.Set(pv.Type)
+			}
+			vNo++
+			u.N++ // next value, continue parsing
+			if u.N == 1 && len(u.Vals) == 0 {
+				u.first = *pv //set u.first
+			}
+			if pv == &u.tmp {
+				u.tmp.Reset() // prepare for next value (cleanup tmp state)
+			}
+			if err == ErrHdrMoreValues {
+				offs = next
+				continue // get next value
+			}
+		case ErrHdrMoreBytes:
+			// do nothing, just for readability
+		default:
+			pv.Reset() // some error -> clear the crt tmp state
+		}
+		break
+	}
+	return next, vNo, err
+}
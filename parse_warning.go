@@ -0,0 +1,279 @@
+// Copyright 2021 Intuitive Labs GmbH. All rights reserved.
+//
+// Use of this source code is governed by a source-available license
+// that can be found in the LICENSE.txt file in the root of the source
+// tree.
+
+package httpsp
+
+// WarningVal contains a parsed Warning value (rfc7234 5.5):
+//
+//	warn-code SP warn-agent SP warn-text [ SP warn-date ]
+type WarningVal struct {
+	V     PField // complete warn-value
+	Code  uint16 // 3 digits warn-code
+	Agent PField // warn-agent (host[:port] or pseudonym)
+	Text  PField // warn-text, without the enclosing quotes
+	Date  PField // warn-date, without the enclosing quotes (can be empty)
+}
+
+// Reset re-initializes the parsed value.
+func (v *WarningVal) Reset() {
+	*v = WarningVal{}
+}
+
+// PWarning contains the parsed Warning header values for one or more
+// different headers (all the warn-values in the message that fit in the
+// parsed value array).
+type PWarning struct {
+	Vals []WarningVal // parsed warn-values
+	N    int          // no of  _values_ found, can be >len(Vals)
+	HNo  int          // no of different Warning _headers_ found
+	// parsed hdr content during the last ParseAll... call
+	// (contains a trimmed value or several values, overwritten by each
+	//  ParseAll.. call; it can also be empty, e.g. on ErrHdrMoreByte)
+	LastParsed PField
+	tmp        WarningVal // temporary saved state (between calls)
+	first      WarningVal // even if Vals is nil, we remember the first val.
+	state      uint8      // internal parsing state
+}
+
+// VNo returns the number of parsed Warning values.
+func (w *PWarning) VNo() int {
+	if w.N > len(w.Vals) {
+		return len(w.Vals)
+	}
+	return w.N
+}
+
+// GetWarning returns the requested parsed warn-value or nil.
+func (w *PWarning) GetWarning(n int) *WarningVal {
+	if w.VNo() > n {
+		return &w.Vals[n]
+	}
+	if w.Empty() {
+		return nil
+	}
+	if n == 0 {
+		return &w.first
+	}
+	return nil
+}
+
+// More returns true if there are more values that did not fit in Vals.
+func (w *PWarning) More() bool {
+	return w.N > len(w.Vals)
+}
+
+// Reset re-initializes the parsed values.
+func (w *PWarning) Reset() {
+	for i := 0; i < w.VNo(); i++ {
+		w.Vals[i].Reset()
+	}
+	v := w.Vals
+	*w = PWarning{}
+	w.Vals = v
+}
+
+// Init initializes the parsed Warning values buf from an array.
+func (w *PWarning) Init(valbuf []WarningVal) {
+	w.Vals = valbuf
+}
+
+// Empty returns true if no Warning values have been parsed.
+func (w *PWarning) Empty() bool {
+	return w.N == 0
+}
+
+// Parsed returns true if there are some parsed Warning values.
+func (w *PWarning) Parsed() bool {
+	return w.N > 0
+}
+
+// internal Warning parser states
+const (
+	warnInit       uint8 = iota // look for warn-value start
+	warnCode                    // inside warn-code
+	warnAgentStart              // look for warn-agent start
+	warnAgent                   // inside warn-agent
+	warnTextStart               // look for warn-text start
+	warnText                    // inside quoted warn-text
+	warnDateStart               // look for warn-date start or value end
+	warnDate                    // inside quoted warn-date
+	warnNext                    // look for value end (',' or end of header)
+	warnFNxt                    // ',' found, look for the next value start
+)
+
+// ParseAllWarningValues tries to parse all the values in a Warning header
+// situated at offs in buf and adds them to the passed PWarning values.
+// The return values are: a new offset after the parsed value (that can be
+// used to continue parsing), the number of header values parsed and an error.
+// It can return ErrHdrMoreBytes if more data is needed (the value is not
+// fully contained in buf).
+func ParseAllWarningValues(buf []byte, offs int, w *PWarning) (int, int, ErrorHdr) {
+	var n, crl int
+	var err ErrorHdr
+
+	vNo := 0             // number of values parsed during the current call
+	w.LastParsed.Reset() // clear LastParsed on each call
+	i := offs
+	for i < len(buf) {
+		c := buf[i]
+		switch w.state {
+		case warnInit, warnFNxt, warnAgentStart, warnTextStart,
+			warnDateStart, warnNext:
+			switch c {
+			case ' ', '\t', '\r', '\n':
+				n, crl, err = skipLWS(buf, i, 0)
+				if err == 0 {
+					i = n
+					continue
+				}
+				if err == ErrHdrEOH {
+					goto endOfHdr
+				}
+				if err == ErrHdrMoreBytes {
+					goto moreBytes
+				}
+				goto errBad
+			case ',':
+				switch w.state {
+				case warnInit, warnFNxt:
+					// skip over extra ','
+				case warnDateStart, warnNext:
+					w.addVal(vNo)
+					vNo++
+					w.state = warnFNxt
+				default:
+					err = ErrHdrBadChar
+					goto errBad
+				}
+			case '"':
+				switch w.state {
+				case warnTextStart:
+					w.tmp.Text.Set(i+1, i+1)
+					w.state = warnText
+				case warnDateStart:
+					w.tmp.Date.Set(i+1, i+1)
+					w.state = warnDate
+				default:
+					err = ErrHdrBadChar
+					goto errBad
+				}
+			default:
+				switch w.state {
+				case warnInit, warnFNxt:
+					if c < '0' || c > '9' {
+						err = ErrHdrBadChar
+						goto errBad
+					}
+					w.tmp.V.Set(i, i)
+					w.state = warnCode
+					continue
+				case warnAgentStart:
+					w.tmp.Agent.Set(i, i)
+					w.state = warnAgent
+					continue
+				}
+				err = ErrHdrBadChar
+				goto errBad
+			}
+		case warnCode:
+			if c >= '0' && c <= '9' {
+				if (i - int(w.tmp.V.Offs)) >= 3 {
+					err = ErrHdrBadChar
+					goto errBad
+				}
+				w.tmp.Code = w.tmp.Code*10 + uint16(c-'0')
+			} else if (c == ' ' || c == '\t') &&
+				(i-int(w.tmp.V.Offs)) == 3 {
+				w.state = warnAgentStart
+			} else {
+				err = ErrHdrBadChar
+				goto errBad
+			}
+		case warnAgent:
+			switch c {
+			case ' ', '\t':
+				w.tmp.Agent.Extend(i)
+				w.state = warnTextStart
+			case ',', '"', '\r', '\n':
+				err = ErrHdrBadChar
+				goto errBad
+			default:
+				if !tokAllowedChar(c) {
+					err = ErrHdrBadChar
+					goto errBad
+				}
+			}
+		case warnText, warnDate:
+			n, err = SkipQuoted(buf, i)
+			if err == ErrHdrMoreBytes {
+				i = n
+				goto moreBytes
+			}
+			if err != 0 {
+				i = n
+				goto errBad
+			}
+			if w.state == warnText {
+				w.tmp.Text.Extend(n - 1)
+				w.state = warnDateStart
+			} else {
+				w.tmp.Date.Extend(n - 1)
+				w.state = warnNext
+			}
+			w.tmp.V.Extend(n)
+			i = n
+			continue
+		default:
+			return i, vNo, ErrHdrBug
+		}
+		i++
+	}
+moreBytes:
+	return i, vNo, ErrHdrMoreBytes
+endOfHdr:
+	// here i will point to first WS char (including CR & LF)
+	//      n will point to the line end (CR or LF)
+	//      crl will contain the line end length (1 or 2)
+	switch w.state {
+	case warnInit:
+		// end of header without finding a value
+		return n + crl, vNo, ErrHdrEmpty
+	case warnFNxt:
+		// do nothing (allow trailing ',')
+	case warnDateStart, warnNext:
+		w.addVal(vNo)
+		vNo++
+	default:
+		// premature end
+		err = ErrHdrBad
+		i = n
+		goto errBad
+	}
+	w.state = warnInit
+	return n + crl, vNo, 0
+errBad:
+	w.tmp.Reset()
+	w.state = warnInit
+	return i, vNo, err
+}
+
+// addVal adds the current parsed value (w.tmp) to the parsed values list.
+// vNo is the number of values parsed during the current
+// ParseAllWarningValues call.
+func (w *PWarning) addVal(vNo int) {
+	if vNo == 0 {
+		w.LastParsed = w.tmp.V
+	} else {
+		w.LastParsed.Extend(w.tmp.V.EndOffs())
+	}
+	if w.N < len(w.Vals) {
+		w.Vals[w.N] = w.tmp
+	} else if w.N == 0 {
+		w.first = w.tmp
+	}
+	w.N++
+	w.tmp.Reset()
+}
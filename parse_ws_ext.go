@@ -31,16 +31,35 @@ func WSExtResolve(n []byte) WSExtT {
 	return WSExtOtherF
 }
 
+// PMDeflateParams contains the parsed permessage-deflate extension
+// parameters (rfc7692 7.1).
+type PMDeflateParams struct {
+	SrvNoCtxTakeover bool  // server_no_context_takeover
+	CliNoCtxTakeover bool  // client_no_context_takeover
+	SrvMaxWBits      uint8 // server_max_window_bits value or 0 if missing
+	// client_max_window_bits value or 0 if missing or without value
+	// (see CliMaxWBitsF)
+	CliMaxWBits  uint8
+	CliMaxWBitsF bool // client_max_window_bits present (even w/o value)
+}
+
+// Reset re-initializes the parsed parameters.
+func (p *PMDeflateParams) Reset() {
+	*p = PMDeflateParams{}
+}
+
 // WSExtVal contains a parsed "Sec-WebSocket-Extension" value.
 type WSExtVal struct {
-	Val PToken // extension token
-	Ext WSExtT // parsed numeric extension value
+	Val     PToken          // extension token
+	Ext     WSExtT          // parsed numeric extension value
+	Deflate PMDeflateParams // permessage-deflate params (if Ext matches)
 }
 
 // Reset  re-initializes the internal parsed token.
 func (v *WSExtVal) Reset() {
 	v.Val.Reset()
 	v.Ext = WSExtNone
+	v.Deflate.Reset()
 }
 
 // PWSExt contains the parsed Sec-WebSocket-Extensions header values for one
@@ -143,6 +162,13 @@ func ParseAllWSExtValues(buf []byte, offs int, u *PWSExt) (int, int, ErrorHdr) {
 				u.LastParsed.Extend(int(pv.Val.V.Offs + pv.Val.V.Len))
 			}
 			pv.Ext = WSExtResolve(pv.Val.V.Get(buf))
+			if pv.Ext == WSExtPMsgDeflateF {
+				if o, e := parsePMDeflateParams(buf, &pv.Val,
+					&pv.Deflate); e != 0 {
+					pv.Reset()
+					return o, vNo, e
+				}
+			}
 			u.Extensions |= pv.Ext
 			vNo++
 			u.N++ // next value, continue parsing
@@ -165,3 +191,94 @@ func ParseAllWSExtValues(buf []byte, offs int, u *PWSExt) (int, int, ErrorHdr) {
 	}
 	return next, vNo, err
 }
+
+// parsePMDeflateParams parses the permessage-deflate parameters from the
+// already parsed extension token t and fills p.
+// It returns 0 and 0 on success or the offset of the offending parameter
+// and an error: ErrHdrParams for unknown or duplicate parameters or
+// missing/extra values, ErrHdrValNotNumber or ErrHdrValBad for invalid
+// window bits values (they must be between 8 and 15).
+func parsePMDeflateParams(buf []byte, t *PToken,
+	p *PMDeflateParams) (int, ErrorHdr) {
+	p.Reset()
+	if t.Params.Empty() {
+		return 0, 0
+	}
+	o := int(t.Params.Offs)
+	pbuf := buf[:t.Params.EndOffs()]
+	// parameter flags (used for detecting duplicates)
+	const (
+		srvNoCtxF uint8 = 1 << iota
+		cliNoCtxF
+		srvMaxWBitsF
+		cliMaxWBitsF
+	)
+	var param PTokParam
+	var seen uint8 // parameters already found, as flags
+	for o < len(pbuf) {
+		param.Reset()
+		n, err := ParseTokenParam(pbuf, o, &param, PTokInputEndF)
+		switch err {
+		case ErrHdrOk, ErrHdrEOH, ErrHdrMoreValues:
+		case ErrHdrEmpty:
+			return 0, 0
+		default:
+			return n, err
+		}
+		name := param.Name.Get(buf)
+		val, _ := unquotePField(buf, param.Val)
+		var f uint8
+		switch {
+		case bytescase.CmpEq(name, []byte("server_no_context_takeover")):
+			f = srvNoCtxF
+			p.SrvNoCtxTakeover = true
+		case bytescase.CmpEq(name, []byte("client_no_context_takeover")):
+			f = cliNoCtxF
+			p.CliNoCtxTakeover = true
+		case bytescase.CmpEq(name, []byte("server_max_window_bits")):
+			f = srvMaxWBitsF
+			if val.Empty() {
+				// value required
+				return int(param.All.Offs), ErrHdrParams
+			}
+		case bytescase.CmpEq(name, []byte("client_max_window_bits")):
+			f = cliMaxWBitsF
+			p.CliMaxWBitsF = true
+		default:
+			return int(param.All.Offs), ErrHdrParams
+		}
+		if seen&f != 0 {
+			// duplicate parameter
+			return int(param.All.Offs), ErrHdrParams
+		}
+		seen |= f
+		if (f == srvNoCtxF || f == cliNoCtxF) && !param.Val.Empty() {
+			// no_context_takeover params have no value
+			return int(param.Val.Offs), ErrHdrParams
+		}
+		if !val.Empty() && (f == srvMaxWBitsF || f == cliMaxWBitsF) {
+			var bits uint8
+			for _, c := range val.Get(buf) {
+				if c < '0' || c > '9' {
+					return int(val.Offs), ErrHdrValNotNumber
+				}
+				if bits <= 15 { // avoid overflow, already too big
+					bits = bits*10 + c - '0'
+				}
+			}
+			if bits < 8 || bits > 15 {
+				return int(val.Offs), ErrHdrValBad
+			}
+			if f == srvMaxWBitsF {
+				p.SrvMaxWBits = bits
+			} else {
+				p.CliMaxWBits = bits
+			}
+		}
+		if err != ErrHdrMoreValues {
+			break
+		}
+		o = n
+	}
+	return 0, 0
+}
@@ -90,6 +90,24 @@ func (u *PWSProto) GetProto(n int) *WSProtoVal {
 	return nil
 }
 
+// Negotiated returns the sub-protocol selected by the server (in a reply
+// there must be exactly one value, rfc6455 4.2.2).
+// It returns WSProtoNone if no value or more than one value were parsed
+// (invalid reply) and WSProtoOtherF for unknown protocols (use GetProto(0)
+// to get the protocol name).
+func (u *PWSProto) Negotiated() WSProtoT {
+	if u.N != 1 {
+		return WSProtoNone
+	}
+	return u.GetProto(0).Proto
+}
+
+// Offers returns true if the protocol p is in the list of sub-protocols
+// offered by the client (request side check).
+func (u *PWSProto) Offers(p WSProtoT) bool {
+	return u.Protos&p != 0
+}
+
 // More returns true if there are more values that did not fit in Vals.
 func (u *PWSProto) More() bool {
 	return u.N > len(u.Vals)